@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	indexFile = "index.json"
+	// startOrderFile lists the bundles of containers that depend on each
+	// other in the order they have to be started in, one per line.
+	startOrderFile = "start-order"
+)
+
+// validContainerName matches the names docker allows for containers.
+var validContainerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// indexEntry describes the result of converting one container in batch mode.
+type indexEntry struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Bundle string `json:"bundle,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validateBatchFlags makes sure --all and --filter are not combined with
+// another way to pick the containers, they would be ignored.
+func validateBatchFlags(args []string) error {
+	if fromFile != "" || fromDisk {
+		return errors.New("--all and --filter convert the containers of the daemon, they cannot be used with --from-file or --from-disk")
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("--all and --filter pick the containers to convert, they cannot be used with container %s", args[0])
+	}
+	return nil
+}
+
+// convertAll converts every container matching the filters into its own
+// bundle below the bundle directory.
+func convertAll(ctx context.Context, cli *client.Client, f filters.Args) error {
+	list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: f,
+	})
+	if err != nil {
+		return fmt.Errorf("listing containers failed: %v", err)
+	}
+
+	var (
+		ctrs   []container
+		failed []indexEntry
+	)
+	for _, c := range list {
+		ctr, err := inspectContainer(ctx, cli, c.ID, logrus.StandardLogger())
+		if err != nil {
+			// keep going, the failure will be recorded in the index
+			logrus.Warnf("inspecting container (%s) failed: %v", c.ID, err)
+			entry := indexEntry{
+				ID:    c.ID,
+				Error: err.Error(),
+			}
+			if len(c.Names) > 0 {
+				entry.Name = strings.TrimPrefix(c.Names[0], "/")
+			}
+			failed = append(failed, entry)
+			continue
+		}
+		ctrs = append(ctrs, ctr)
+	}
+
+	// the containers that are not converted along are joined where they run,
+	// the ones that cannot join them do not stop the others
+	errs := map[int]error{}
+	for i := range ctrs {
+		if err := joinNamespaces(ctx, cli, &ctrs[i], ctrs); err != nil {
+			errs[i] = err
+		}
+	}
+	ctrs, dropped := dropFailed(ctrs, errs)
+	failed = append(failed, dropped...)
+
+	if err := linkBundles(ctrs, bundle); err != nil {
+		return err
+	}
+
+	return writeBundles(ctx, bundle, ctrs, failed)
+}
+
+// dropFailed removes the containers that failed with the errors by their
+// index, along with the ones sharing their namespaces, and returns the
+// entries of the index for them.
+func dropFailed(ctrs []container, errs map[int]error) ([]container, []indexEntry) {
+	for changed := true; changed; {
+		changed = false
+		for i, ctr := range ctrs {
+			if errs[i] != nil {
+				continue
+			}
+			for _, ns := range sharedNamespaces(ctr) {
+				if j := findContainer(ctrs, ns.ref); j >= 0 && errs[j] != nil {
+					errs[i] = fmt.Errorf("container %s shares the %s namespace of container %s, which failed to convert", bundleName(ctr.ContainerJSON), ns.t, bundleName(ctrs[j].ContainerJSON))
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var (
+		kept   []container
+		failed []indexEntry
+	)
+	for i, ctr := range ctrs {
+		if errs[i] == nil {
+			kept = append(kept, ctr)
+			continue
+		}
+		logrus.Warnf("converting container (%s) failed: %v", bundleName(ctr.ContainerJSON), errs[i])
+		failed = append(failed, indexEntry{
+			ID:    ctr.ID,
+			Name:  bundleName(ctr.ContainerJSON),
+			Error: errs[i].Error(),
+		})
+	}
+	return kept, failed
+}
+
+// linkBundles makes the containers sharing namespaces with each other join
+// them through their bundles in outdir, and writes the order they have to be
+// started in if any of them depend on another.
+func linkBundles(ctrs []container, outdir string) error {
+	deps, err := linkNamespaces(ctrs, outdir)
+	if err != nil {
+		return err
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, ctr := range ctrs {
+		names = append(names, bundleName(ctr.ContainerJSON))
+	}
+	order, err := startOrder(names, deps)
+	if err != nil {
+		return err
+	}
+	return writeStartOrder(outdir, order)
+}
+
+// writeBundles converts the containers into <outdir>/<name>/config.json and
+// writes an index of the results to <outdir>/index.json. A container that
+// fails to convert does not stop the others.
+func writeBundles(ctx context.Context, outdir string, ctrs []container, failed []indexEntry) error {
+	index := []indexEntry{}
+	for _, ctr := range ctrs {
+		entry := indexEntry{
+			ID:     ctr.ID,
+			Name:   bundleName(ctr.ContainerJSON),
+			Bundle: filepath.Join(outdir, bundleName(ctr.ContainerJSON)),
+		}
+
+		if err := convert(ctx, ctr, entry.Bundle); err != nil {
+			logrus.Warnf("converting container (%s) failed: %v", entry.Name, err)
+			entry.Error = err.Error()
+		} else {
+			fmt.Printf("%s has been saved.\n", filepath.Join(entry.Bundle, specConfig))
+		}
+
+		index = append(index, entry)
+	}
+	index = append(index, failed...)
+
+	if err := writeIndex(outdir, index); err != nil {
+		return err
+	}
+	fmt.Printf("%s has been saved.\n", filepath.Join(outdir, indexFile))
+
+	var errored int
+	for _, entry := range index {
+		if entry.Error != "" {
+			errored++
+		}
+	}
+	if errored > 0 {
+		return fmt.Errorf("%d of %d containers failed to convert, see %s", errored, len(index), filepath.Join(outdir, indexFile))
+	}
+	return nil
+}
+
+// writeIndex writes the index of the bundles to <outdir>/index.json.
+func writeIndex(outdir string, index []indexEntry) error {
+	if outdir != "" {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			return fmt.Errorf("creating bundle directory %s failed: %v", outdir, err)
+		}
+	}
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outdir, indexFile), data, 0666)
+}
+
+// bundleName returns the name of the directory for the container's bundle.
+// The inspect data can come from anywhere, so only names docker accepts for
+// containers are used, which cannot leave the bundle directory.
+func bundleName(ctr types.ContainerJSON) string {
+	if name := strings.TrimPrefix(ctr.Name, "/"); validContainerName.MatchString(name) {
+		return name
+	}
+	if id := shortID(ctr.ID); validContainerName.MatchString(id) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(ctr.Name + "/" + ctr.ID))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// startOrder sorts the containers so each one comes after the ones it
+// depends on, keeping the given order otherwise.
+func startOrder(names []string, deps map[string][]string) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+
+	var (
+		order []string
+		state = map[string]int{}
+		visit func(name string, path []string) error
+	)
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("containers depend on each other: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if !known[dep] {
+				continue
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// writeStartOrder writes the bundles in the order they have to be started in
+// to <outdir>/start-order.
+func writeStartOrder(outdir string, order []string) error {
+	if outdir != "" {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			return fmt.Errorf("creating bundle directory %s failed: %v", outdir, err)
+		}
+	}
+
+	file := filepath.Join(outdir, startOrderFile)
+	if err := ioutil.WriteFile(file, []byte(strings.Join(order, "\n")+"\n"), 0666); err != nil {
+		return err
+	}
+	fmt.Printf("%s has been saved.\n", file)
+	return nil
+}
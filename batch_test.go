@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+)
+
+func TestBundleName(t *testing.T) {
+	tests := []struct {
+		name, id string
+		expected string
+	}{
+		{name: "/web", id: "aaaa1111bbbb2222", expected: "web"},
+		{name: "", id: "aaaa1111bbbb2222", expected: "aaaa1111bbbb"},
+		{name: "/../../x", id: "aaaa1111bbbb2222", expected: "aaaa1111bbbb"},
+		{name: "/a/b", id: "cccc", expected: "cccc"},
+		// neither can be used, the name is made up from both
+		{name: "..", id: "../.."},
+	}
+
+	for _, test := range tests {
+		ctr := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{Name: test.name, ID: test.id},
+		}
+		name := bundleName(ctr)
+		if test.expected == "" && len(name) == 12 && validContainerName.MatchString(name) {
+			continue
+		}
+		if name != test.expected {
+			t.Fatalf("expected bundle name %s for %q (%s), got %s", test.expected, test.name, test.id, name)
+		}
+	}
+}
+
+func TestValidateBatchFlags(t *testing.T) {
+	defer func(file string, disk bool) { fromFile, fromDisk = file, disk }(fromFile, fromDisk)
+
+	tests := []struct {
+		file  string
+		disk  bool
+		args  []string
+		valid bool
+	}{
+		{valid: true},
+		{file: "inspect.json"},
+		{disk: true},
+		{args: []string{"web"}},
+	}
+	for _, test := range tests {
+		fromFile, fromDisk = test.file, test.disk
+		err := validateBatchFlags(test.args)
+		if test.valid && err != nil {
+			t.Fatalf("expected %+v to be valid, got %v", test, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("expected %+v to be rejected", test)
+		}
+	}
+}
+
+func TestStartOrder(t *testing.T) {
+	tests := []struct {
+		names    []string
+		deps     map[string][]string
+		expected []string
+		cycle    bool
+	}{
+		{
+			names:    []string{"app", "db", "cache"},
+			deps:     map[string][]string{"app": {"db", "cache"}},
+			expected: []string{"db", "cache", "app"},
+		},
+		{
+			// the dependencies that are not converted along are left out
+			names:    []string{"app", "db"},
+			deps:     map[string][]string{"app": {"proxy"}, "db": {"app"}},
+			expected: []string{"app", "db"},
+		},
+		{
+			names: []string{"a", "b", "c"},
+			deps:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			cycle: true,
+		},
+		{
+			names: []string{"a"},
+			deps:  map[string][]string{"a": {"a"}},
+			cycle: true,
+		},
+	}
+
+	for _, test := range tests {
+		order, err := startOrder(test.names, test.deps)
+		if test.cycle {
+			if err == nil {
+				t.Fatalf("expected a cycle for %v, got the order %v", test.deps, order)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order, test.expected) {
+			t.Fatalf("expected start order %v for %v, got %v", test.expected, test.deps, order)
+		}
+	}
+}
+
+func TestWriteBundlesIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newContainer := func(id, name string) container {
+		return container{ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         id,
+				Name:       name,
+				Path:       "sh",
+				HostConfig: &containertypes.HostConfig{},
+			},
+			Config: &containertypes.Config{},
+		}}
+	}
+	ctrs := []container{
+		newContainer("aaaa1111bbbb2222", "/web"),
+		newContainer("cccc3333dddd4444", ""),
+	}
+	failed := []indexEntry{{ID: "eeee5555", Name: "db", Error: "inspecting failed"}}
+
+	err = writeBundles(context.Background(), dir, ctrs, failed)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 containers failed") {
+		t.Fatalf("expected the failed container to be reported, got %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []indexEntry
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	expected := []indexEntry{
+		{ID: "aaaa1111bbbb2222", Name: "web", Bundle: filepath.Join(dir, "web")},
+		{ID: "cccc3333dddd4444", Name: "cccc3333dddd", Bundle: filepath.Join(dir, "cccc3333dddd")},
+		failed[0],
+	}
+	if !reflect.DeepEqual(index, expected) {
+		t.Fatalf("expected index %+v, got %+v", expected, index)
+	}
+	for _, entry := range expected[:2] {
+		if _, err := os.Stat(filepath.Join(entry.Bundle, specConfig)); err != nil {
+			t.Fatalf("expected the bundle of %s: %v", entry.Name, err)
+		}
+	}
+}
+
+func TestDropFailed(t *testing.T) {
+	newContainer := func(name, network string) container {
+		return container{ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         name + "1111",
+				Name:       "/" + name,
+				HostConfig: &containertypes.HostConfig{NetworkMode: containertypes.NetworkMode(network)},
+			},
+		}}
+	}
+	ctrs := []container{
+		newContainer("app", "container:proxy"),
+		newContainer("sidecar", "container:app"),
+		newContainer("db", "bridge"),
+	}
+
+	// app cannot join the network of proxy, which is not running
+	kept, failed := dropFailed(ctrs, map[int]error{0: errors.New("proxy is not running")})
+	if len(kept) != 1 || kept[0].ID != "db1111" {
+		t.Fatalf("expected only db to be kept, got %v", kept)
+	}
+	if len(failed) != 2 || failed[0].Name != "app" || failed[1].Name != "sidecar" {
+		t.Fatalf("expected app and sidecar to fail, got %+v", failed)
+	}
+	if failed[0].Error != "proxy is not running" || !strings.Contains(failed[1].Error, "namespace of container app") {
+		t.Fatalf("expected the errors of app and sidecar, got %+v", failed)
+	}
+}
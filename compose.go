@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/genuinetools/riddler/inspect"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const composeHelp = `Convert the services of a docker-compose file, or the running containers of a project, into a bundle each.`
+
+func (cmd *composeCommand) Name() string      { return "compose" }
+func (cmd *composeCommand) Args() string      { return "[OPTIONS] [COMPOSE_FILE]" }
+func (cmd *composeCommand) ShortHelp() string { return composeHelp }
+func (cmd *composeCommand) LongHelp() string  { return composeHelp }
+func (cmd *composeCommand) Hidden() bool      { return false }
+
+func (cmd *composeCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.project, "project", "", "Name of the compose project, without a compose file the running containers of the project are converted")
+}
+
+type composeCommand struct {
+	project string
+}
+
+func (cmd *composeCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 && cmd.project == "" {
+		return errors.New("pass the compose file or the --project to convert the containers of")
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		ccs []inspect.ComposeContainer
+		// the changes to the specs of the running containers, by id
+		fixups = map[string]func(*specs.Spec){}
+	)
+	if len(args) > 0 {
+		// the containers do not exist, so they cannot be exported
+		if rootfsMode != "" && rootfsMode != rootfsImage {
+			return fmt.Errorf("only --rootfs %s is supported for compose files", rootfsImage)
+		}
+
+		p, err := inspect.ReadCompose(args[0], cmd.project, logrus.StandardLogger())
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(bundle)
+		if err != nil {
+			return err
+		}
+
+		ccs, err = inspect.FromCompose(p, inspect.ComposeOptions{
+			VolumesDir: filepath.Join(abs, inspect.VolumesDir),
+			// fill in what the services leave out from the images, if the
+			// daemon has them
+			ImageConfig: imageConfigFunc(ctx, cli),
+			Log:         logrus.StandardLogger(),
+		})
+		if err != nil {
+			return fmt.Errorf("converting compose project %s failed: %v", p.Name, err)
+		}
+	} else {
+		list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", inspect.ComposeProjectLabel+"="+cmd.project)),
+		})
+		if err != nil {
+			return fmt.Errorf("listing containers failed: %v", err)
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("no containers found for compose project %s", cmd.project)
+		}
+
+		var dcs []types.ContainerJSON
+		for _, c := range list {
+			ctr, err := inspectContainer(ctx, cli, c.ID, logrus.StandardLogger())
+			if err != nil {
+				return fmt.Errorf("inspecting container (%s) failed: %v", c.ID, err)
+			}
+			dcs = append(dcs, ctr.ContainerJSON)
+			fixups[ctr.ID] = ctr.fixup
+		}
+
+		ccs, err = inspect.FromComposeContainers(dcs)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ctrs []container
+	for _, cc := range ccs {
+		ctrs = append(ctrs, container{ContainerJSON: cc.ContainerJSON, fixup: fixups[cc.ID]})
+
+		// the volumes of the containers that only exist in the compose
+		// file are shared directories in the bundle directory
+		if len(args) > 0 {
+			if err := createVolumeDirs(cc.ContainerJSON, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the containers outside of the project are joined where they run, the
+	// ones that cannot join them do not stop the others
+	errs := map[int]error{}
+	for i := range ctrs {
+		if err := joinNamespaces(ctx, cli, &ctrs[i], ctrs); err != nil {
+			errs[i] = err
+		}
+	}
+	ctrs, failed := dropFailed(ctrs, errs)
+
+	deps, err := linkNamespaces(ctrs, bundle)
+	if err != nil {
+		return err
+	}
+	var (
+		names    []string
+		services = map[string][]string{}
+		kept     = map[string]bool{}
+	)
+	for _, ctr := range ctrs {
+		kept[bundleName(ctr.ContainerJSON)] = true
+	}
+	for _, cc := range ccs {
+		name := bundleName(cc.ContainerJSON)
+		if !kept[name] {
+			continue
+		}
+		names = append(names, name)
+		services[cc.Service] = append(services[cc.Service], name)
+	}
+	for _, cc := range ccs {
+		name := bundleName(cc.ContainerJSON)
+		for _, service := range cc.DependsOn {
+			deps[name] = append(deps[name], services[service]...)
+		}
+	}
+
+	order, err := startOrder(names, deps)
+	if err != nil {
+		return err
+	}
+	if err := writeStartOrder(bundle, order); err != nil {
+		return err
+	}
+
+	return writeBundles(ctx, bundle, ctrs, failed)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+const (
+	// defaultContext is the context of the docker CLI that uses DOCKER_HOST,
+	// or the default socket.
+	defaultContext = "default"
+	// contextsDir holds the contexts in the config directory of the docker
+	// CLI, their metadata in meta/<id>/meta.json and their TLS material in
+	// tls/<id>/docker, where the id is the sha256 of the name of the context.
+	contextsDir = "contexts"
+)
+
+// dockerFlags are the flags that choose the docker daemon, named like the
+// ones of the docker CLI.
+type dockerFlags struct {
+	config    string
+	context   string
+	host      string
+	tls       bool
+	tlsVerify bool
+	tlsCACert string
+	tlsCert   string
+	tlsKey    string
+}
+
+// endpoint returns the daemon the flags choose, the way the docker CLI does:
+// the context, or else the host, or else DOCKER_HOST, or else DOCKER_CONTEXT,
+// or else the current context of the config. The default context is the
+// default socket. The TLS flags only go with the host, the other contexts
+// have TLS settings of their own.
+func (f dockerFlags) endpoint() (*dockerEndpoint, error) {
+	if f.host != "" && f.context != "" {
+		return nil, errors.New("pass either --host or --context, not both")
+	}
+
+	configDir := f.config
+	if configDir == "" {
+		configDir = dockerConfigDir()
+	}
+
+	if f.host == "" {
+		name := f.context
+		if name == "" {
+			var err error
+			name, err = currentContext(configDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if name != defaultContext {
+			// the context has TLS settings of its own
+			if f.tlsSet() {
+				return nil, fmt.Errorf("--tls, --tlsverify, --tlscacert, --tlscert and --tlskey cannot be used with context %s, pass --host instead", name)
+			}
+			return contextEndpoint(configDir, name)
+		}
+	}
+
+	ep := &dockerEndpoint{Host: f.host}
+	if ep.Host == "" {
+		ep.Host = os.Getenv("DOCKER_HOST")
+	}
+	if ep.Host == "" {
+		ep.Host = client.DefaultDockerHost
+	}
+
+	// verifying implies TLS
+	verify := f.tlsVerify || os.Getenv("DOCKER_TLS_VERIFY") != ""
+	ep.TLS = f.tls || verify
+	ep.SkipTLSVerify = !verify
+	if !ep.TLS {
+		return ep, nil
+	}
+
+	// the TLS material defaults to the files in DOCKER_CERT_PATH, or the
+	// config directory
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		certPath = configDir
+	}
+	ep.CAFile = flagOrFile(f.tlsCACert, filepath.Join(certPath, "ca.pem"))
+	ep.CertFile = flagOrFile(f.tlsCert, filepath.Join(certPath, "cert.pem"))
+	ep.KeyFile = flagOrFile(f.tlsKey, filepath.Join(certPath, "key.pem"))
+	return ep, nil
+}
+
+// tlsSet returns whether any of the TLS flags was passed.
+func (f dockerFlags) tlsSet() bool {
+	return f.tls || f.tlsVerify || f.tlsCACert != "" || f.tlsCert != "" || f.tlsKey != ""
+}
+
+// dockerEndpoint is the address of a docker daemon, along with the TLS
+// material to connect to it with.
+type dockerEndpoint struct {
+	Host          string
+	TLS           bool
+	SkipTLSVerify bool
+	CAFile        string
+	CertFile      string
+	KeyFile       string
+}
+
+// clientOpts returns the options for a client of the endpoint.
+func (ep dockerEndpoint) clientOpts() ([]func(*client.Client) error, error) {
+	if strings.HasPrefix(ep.Host, "ssh://") {
+		dial, err := sshDialer(ep.Host)
+		if err != nil {
+			return nil, err
+		}
+		// the connection goes through ssh, the host only names the daemon
+		return []func(*client.Client) error{
+			client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: dial}}),
+			client.WithHost("http://docker"),
+			client.WithDialContext(dial),
+		}, nil
+	}
+
+	var opts []func(*client.Client) error
+	if ep.TLS || ep.CAFile != "" || ep.CertFile != "" || ep.KeyFile != "" {
+		tlsc, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             ep.CAFile,
+			CertFile:           ep.CertFile,
+			KeyFile:            ep.KeyFile,
+			InsecureSkipVerify: ep.SkipTLSVerify,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS config for %s failed: %v", ep.Host, err)
+		}
+		// the host sets up the transport, so it has to come first
+		opts = append(opts, client.WithHTTPClient(&http.Client{
+			Transport:     &http.Transport{TLSClientConfig: tlsc},
+			CheckRedirect: client.CheckRedirect,
+		}))
+	}
+	if ep.Host != "" {
+		opts = append(opts, client.WithHost(ep.Host))
+	}
+	return opts, nil
+}
+
+// dockerConfigDir returns the config directory of the docker CLI.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".docker"
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// currentContext returns the context the docker CLI uses when none is
+// passed.
+func currentContext(configDir string) (string, error) {
+	// DOCKER_HOST wins over DOCKER_CONTEXT and the context of the config
+	if os.Getenv("DOCKER_HOST") != "" {
+		return defaultContext, nil
+	}
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return defaultContext, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("decoding %s failed: %v", filepath.Join(configDir, "config.json"), err)
+	}
+	if config.CurrentContext == "" {
+		return defaultContext, nil
+	}
+	return config.CurrentContext, nil
+}
+
+// contextEndpoint returns the docker endpoint of the context, from the
+// context store of the docker CLI.
+func contextEndpoint(configDir, name string) (*dockerEndpoint, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir, contextsDir, "meta", id, "meta.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("context %s does not exist", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host          string
+			SkipTLSVerify bool
+		}
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("decoding metadata of context %s failed: %v", name, err)
+	}
+	docker, ok := meta.Endpoints["docker"]
+	if !ok {
+		return nil, fmt.Errorf("context %s has no docker endpoint", name)
+	}
+
+	ep := &dockerEndpoint{
+		Host:          docker.Host,
+		SkipTLSVerify: docker.SkipTLSVerify,
+	}
+	tlsDir := filepath.Join(configDir, contextsDir, "tls", id, "docker")
+	ep.CAFile = existingFile(filepath.Join(tlsDir, "ca.pem"))
+	ep.CertFile = existingFile(filepath.Join(tlsDir, "cert.pem"))
+	ep.KeyFile = existingFile(filepath.Join(tlsDir, "key.pem"))
+	return ep, nil
+}
+
+// flagOrFile returns the value of the flag if it is set, or else path if
+// the file exists.
+func flagOrFile(flag, path string) string {
+	if flag != "" {
+		return flag
+	}
+	return existingFile(path)
+}
+
+// existingFile returns path if the file exists.
+func existingFile(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
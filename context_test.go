@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+// setEnv sets the environment variables for a test, an empty value unsets
+// one. It returns the function that restores them.
+func setEnv(env map[string]string) func() {
+	old := map[string]*string{}
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+// writeContext writes a context of the docker CLI into the config directory.
+func writeContext(t *testing.T, configDir, name, host string) {
+	sum := sha256.Sum256([]byte(name))
+	dir := filepath.Join(configDir, contextsDir, "meta", hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	meta := `{"Name": "` + name + `", "Endpoints": {"docker": {"Host": "` + host + `"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "riddler-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+	writeContext(t, configDir, "remote", "tcp://remote:2375")
+	writeContext(t, configDir, "current", "tcp://current:2375")
+	if err := ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"currentContext": "current"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyDir, err := ioutil.TempDir("", "riddler-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(emptyDir)
+
+	tests := []struct {
+		name    string
+		flags   dockerFlags
+		env     map[string]string
+		host    string
+		tls     bool
+		wantErr bool
+	}{
+		{
+			name:  "context flag wins over DOCKER_HOST",
+			flags: dockerFlags{config: configDir, context: "remote"},
+			env:   map[string]string{"DOCKER_HOST": "tcp://env:2375"},
+			host:  "tcp://remote:2375",
+		},
+		{
+			name:  "host flag wins over the environment",
+			flags: dockerFlags{config: configDir, host: "tcp://flag:2375"},
+			env:   map[string]string{"DOCKER_HOST": "tcp://env:2375", "DOCKER_CONTEXT": "remote"},
+			host:  "tcp://flag:2375",
+		},
+		{
+			name:  "DOCKER_HOST wins over DOCKER_CONTEXT",
+			flags: dockerFlags{config: configDir},
+			env:   map[string]string{"DOCKER_HOST": "tcp://env:2375", "DOCKER_CONTEXT": "remote"},
+			host:  "tcp://env:2375",
+		},
+		{
+			name:  "DOCKER_CONTEXT wins over the config",
+			flags: dockerFlags{config: configDir},
+			env:   map[string]string{"DOCKER_CONTEXT": "remote"},
+			host:  "tcp://remote:2375",
+		},
+		{
+			name:  "current context of the config",
+			flags: dockerFlags{config: configDir},
+			host:  "tcp://current:2375",
+		},
+		{
+			name:  "default context",
+			flags: dockerFlags{config: configDir, context: defaultContext},
+			host:  client.DefaultDockerHost,
+		},
+		{
+			name:  "no config",
+			flags: dockerFlags{config: emptyDir},
+			host:  client.DefaultDockerHost,
+		},
+		{
+			name:  "DOCKER_TLS_VERIFY",
+			flags: dockerFlags{config: emptyDir},
+			env:   map[string]string{"DOCKER_HOST": "tcp://env:2376", "DOCKER_TLS_VERIFY": "1"},
+			host:  "tcp://env:2376",
+			tls:   true,
+		},
+		{
+			name:    "host and context flags",
+			flags:   dockerFlags{config: configDir, host: "tcp://flag:2375", context: "remote"},
+			wantErr: true,
+		},
+		{
+			name:  "TLS flags with the default context",
+			flags: dockerFlags{config: configDir, context: defaultContext, tlsVerify: true},
+			host:  client.DefaultDockerHost,
+			tls:   true,
+		},
+		{
+			name:    "TLS flags with the context flag",
+			flags:   dockerFlags{config: configDir, context: "remote", tlsCert: "cert.pem"},
+			wantErr: true,
+		},
+		{
+			name:    "TLS flags with the current context",
+			flags:   dockerFlags{config: configDir, tls: true},
+			wantErr: true,
+		},
+		{
+			name:    "context that does not exist",
+			flags:   dockerFlags{config: configDir},
+			env:     map[string]string{"DOCKER_CONTEXT": "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		env := map[string]string{
+			"DOCKER_HOST":       "",
+			"DOCKER_CONTEXT":    "",
+			"DOCKER_TLS_VERIFY": "",
+			"DOCKER_CERT_PATH":  "",
+		}
+		for k, v := range test.env {
+			env[k] = v
+		}
+		restore := setEnv(env)
+		ep, err := test.flags.endpoint()
+		restore()
+
+		if test.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected an error, got %#v", test.name, ep)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if ep.Host != test.host || ep.TLS != test.tls {
+			t.Fatalf("%s: expected host %s with tls %v, got %s with tls %v", test.name, test.host, test.tls, ep.Host, ep.TLS)
+		}
+	}
+}
@@ -7,16 +7,17 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/docker/distribution v0.0.0-20180920194744-16128bbac47f // indirect
 	github.com/docker/docker v0.0.0-20180924202107-a9c061deec0f
-	github.com/docker/go-connections v0.0.0-20180821093606-97c2040d34df // indirect
-	github.com/docker/go-units v0.3.3 // indirect
+	github.com/docker/go-connections v0.0.0-20180821093606-97c2040d34df
+	github.com/docker/go-units v0.3.3
 	github.com/genuinetools/pkg v0.0.0-20180910213200-1c141f661797
+	github.com/ghodss/yaml v1.0.0
 	github.com/gogo/protobuf v1.1.1 // indirect
 	github.com/google/go-cmp v0.2.0 // indirect
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2 // indirect
 	github.com/onsi/gomega v1.4.2 // indirect
-	github.com/opencontainers/go-digest v0.0.0-20180430190053-c9281466c8b2 // indirect
-	github.com/opencontainers/image-spec v1.0.1 // indirect
+	github.com/opencontainers/go-digest v0.0.0-20180430190053-c9281466c8b2
+	github.com/opencontainers/image-spec v1.0.1
 	github.com/opencontainers/runc v0.0.0-20180920170208-00dc70017d22
 	github.com/opencontainers/runtime-spec v0.0.0-20180913141938-5806c3563733
 	github.com/opencontainers/selinux v0.0.0-20180628160156-b6fa367ed7f5
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/genuinetools/riddler/rootfs"
+	"github.com/sirupsen/logrus"
+)
+
+const imageHelp = `Convert an image into a spec, without creating a container.`
+
+func (cmd *imageCommand) Name() string      { return "image" }
+func (cmd *imageCommand) Args() string      { return "[OPTIONS] IMAGE" }
+func (cmd *imageCommand) ShortHelp() string { return imageHelp }
+func (cmd *imageCommand) LongHelp() string  { return imageHelp }
+func (cmd *imageCommand) Hidden() bool      { return false }
+
+func (cmd *imageCommand) Register(fs *flag.FlagSet) {}
+
+type imageCommand struct{}
+
+func (cmd *imageCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("pass the image name or ID")
+	}
+	if rootfsMode == rootfsExport {
+		return fmt.Errorf("--rootfs %s needs a container, try --rootfs %s", rootfsExport, rootfsImage)
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// get image info
+	img, _, err := cli.ImageInspectWithRaw(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspecting image (%s) failed: %v", args[0], err)
+	}
+
+	ctr, err := inspect.FromImage(img, args[0])
+	if err != nil {
+		return fmt.Errorf("converting image (%s) failed: %v", args[0], err)
+	}
+
+	spec, err := convertSpec(container{ContainerJSON: ctr}, bundle)
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(bundle, spec.Root.Path)
+	if err := populateRootfs(ctx, ctr, root); err != nil {
+		return err
+	}
+
+	if err := createImageVolumes(ctr, bundle, root); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has been saved.\n", filepath.Join(bundle, specConfig))
+	return nil
+}
+
+// createImageVolumes creates the directories in the bundle dir that hold the
+// volumes declared by an image. The new volumes get what the rootfs in root
+// has at their destination, like docker does, if it was populated. The
+// volumes hide that content otherwise.
+func createImageVolumes(ctr types.ContainerJSON, dir, root string) error {
+	for _, m := range ctr.Mounts {
+		if m.Type != mounttypes.TypeVolume {
+			continue
+		}
+		vol := filepath.Join(dir, m.Source)
+		if rootfsMode == "" {
+			logrus.Warnf("Volume %s starts empty and hides what the image has there, pass --rootfs %s to copy it into %s", m.Destination, rootfsImage, vol)
+			continue
+		}
+		// the content of an existing volume is kept
+		if checkEmptyDir(vol) == nil {
+			if err := rootfs.CopyFrom(root, m.Destination, vol); err != nil {
+				return fmt.Errorf("filling volume directory for %s failed: %v", m.Destination, err)
+			}
+		}
+	}
+	return createVolumeDirs(ctr, dir)
+}
+
+// createVolumeDirs creates the directories in the bundle dir that hold the
+// volumes declared by an image.
+func createVolumeDirs(ctr types.ContainerJSON, dir string) error {
+	for _, m := range ctr.Mounts {
+		if m.Type != mounttypes.TypeVolume {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(dir, m.Source), 0755); err != nil {
+			return fmt.Errorf("creating volume directory for %s failed: %v", m.Destination, err)
+		}
+	}
+	return nil
+}
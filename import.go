@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/genuinetools/riddler/rootfs"
+	"github.com/sirupsen/logrus"
+)
+
+const importHelp = `Create a docker container from an OCI bundle.`
+
+func (cmd *importCommand) Name() string      { return "import" }
+func (cmd *importCommand) Args() string      { return "[OPTIONS] BUNDLE" }
+func (cmd *importCommand) ShortHelp() string { return importHelp }
+func (cmd *importCommand) LongHelp() string  { return importHelp }
+func (cmd *importCommand) Hidden() bool      { return false }
+
+func (cmd *importCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.name, "name", "", "Name of the container, docker picks one if not set")
+	fs.StringVar(&cmd.image, "image", "", "Image to create the container from, or the tag of the image built with --from-rootfs")
+	fs.BoolVar(&cmd.fromRootfs, "from-rootfs", false, "Build a single layer image from the rootfs of the bundle and create the container from it")
+	fs.BoolVar(&cmd.strict, "strict", false, "Fail instead of warning when the spec has settings docker cannot create the container with")
+}
+
+type importCommand struct {
+	name       string
+	image      string
+	fromRootfs bool
+	strict     bool
+}
+
+func (cmd *importCommand) Run(ctx context.Context, args []string) error {
+	dir := bundle
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if dir == "" {
+		return errors.New("pass the bundle directory")
+	}
+	if cmd.image == "" && !cmd.fromRootfs {
+		return errors.New("pass the image with --image, or build one from the rootfs with --from-rootfs")
+	}
+
+	ctr, err := inspect.FromBundle(dir, inspect.BundleOptions{
+		Capabilities: defaultCapabilities(),
+	})
+	if err != nil {
+		return fmt.Errorf("converting bundle %s failed: %v", dir, err)
+	}
+
+	// never drop what docker cannot express without telling
+	for _, u := range ctr.Unsupported {
+		logrus.Warnf("Not supported by docker: %s", u)
+	}
+	if cmd.strict && len(ctr.Unsupported) > 0 {
+		return fmt.Errorf("bundle %s has %d settings docker cannot create the container with", dir, len(ctr.Unsupported))
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	image := cmd.image
+	if cmd.fromRootfs {
+		if image == "" {
+			image = importTag(dir)
+		}
+		if err := importRootfs(ctx, cli, ctr.Rootfs, image); err != nil {
+			return err
+		}
+		fmt.Printf("%s has been built from %s.\n", image, ctr.Rootfs)
+	}
+	ctr.Config.Image = image
+
+	if ctr.HostConfigExtra.CgroupnsMode == "private" && versions.LessThan(cli.ClientVersion(), "1.41") {
+		msg := fmt.Sprintf("cgroup namespace, the daemon speaks API %s and needs 1.41", cli.ClientVersion())
+		if cmd.strict {
+			return fmt.Errorf("bundle %s has settings docker cannot create the container with: %s", dir, msg)
+		}
+		logrus.Warnf("Not supported by docker: %s", msg)
+	}
+
+	resp, err := createContainer(ctx, cli, ctr, cmd.name)
+	if err != nil {
+		return fmt.Errorf("creating container from %s failed: %v", dir, err)
+	}
+	for _, w := range resp.Warnings {
+		logrus.Warn(w)
+	}
+
+	fmt.Printf("%s has been created.\n", resp.ID)
+	return nil
+}
+
+// createContainer creates the container of the bundle. The vendored client
+// cannot send the settings of newer daemons in the host config, so the
+// request is made with its connection instead.
+func createContainer(ctx context.Context, cli *client.Client, ctr *inspect.BundleContainer, name string) (containertypes.ContainerCreateCreatedBody, error) {
+	var resp containertypes.ContainerCreateCreatedBody
+
+	body, err := json.Marshal(struct {
+		*containertypes.Config
+		HostConfig struct {
+			*containertypes.HostConfig
+			inspect.HostConfigExtra
+		}
+	}{
+		Config: ctr.Config,
+		HostConfig: struct {
+			*containertypes.HostConfig
+			inspect.HostConfigExtra
+		}{ctr.HostConfig, ctr.HostConfigExtra},
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	u, err := client.ParseHostURL(cli.DaemonHost())
+	if err != nil {
+		return resp, err
+	}
+	// the transport dials the socket whatever the host is, like the client
+	// does it
+	scheme, host := "http", "docker"
+	switch u.Scheme {
+	case "tcp":
+		host = u.Host
+		if t, ok := cli.HTTPClient().Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+			scheme = "https"
+		}
+	case "http", "https":
+		scheme, host = u.Scheme, u.Host
+	}
+	p := path.Join(u.Path, "/containers/create")
+	if v := cli.ClientVersion(); v != "" {
+		p = path.Join(u.Path, "/v"+strings.TrimPrefix(v, "v"), "/containers/create")
+	}
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	target := (&url.URL{Scheme: scheme, Host: host, Path: p, RawQuery: query.Encode()}).String()
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cli.CustomHTTPHeaders() {
+		req.Header.Set(k, v)
+	}
+	r, err := cli.HTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return resp, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode/100 != 2 {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.Message == "" {
+			return resp, fmt.Errorf("the daemon returned %s", r.Status)
+		}
+		return resp, errors.New(msg.Message)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("decoding the response failed: %v", err)
+	}
+	return resp, nil
+}
+
+// importTag returns the tag of the image built from the rootfs of a bundle,
+// named after the bundle directory.
+func importTag(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		dir = abs
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, filepath.Base(dir))
+	return "riddler/" + strings.Trim(name, ".-_") + ":latest"
+}
+
+// importRootfs builds a single layer image tagged ref from the rootfs
+// directory.
+func importRootfs(ctx context.Context, cli *client.Client, dir, ref string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("rootfs of the bundle: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(rootfs.Pack(dir, pw))
+	}()
+	defer pr.Close()
+
+	resp, err := cli.ImageImport(ctx, types.ImageImportSource{
+		Source:     pr,
+		SourceName: "-",
+	}, ref, types.ImageImportOptions{
+		Message: "imported by riddler from " + dir,
+	})
+	if err != nil {
+		return fmt.Errorf("importing rootfs %s failed: %v", dir, err)
+	}
+	defer resp.Close()
+
+	// the daemon reports the errors of the import in the stream
+	dec := json.NewDecoder(resp)
+	for {
+		var msg struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading the import of rootfs %s failed: %v", dir, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("importing rootfs %s failed: %s", dir, msg.Error)
+		}
+		logrus.Debugf("import: %s", msg.Status)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/genuinetools/riddler/inspect"
+)
+
+func TestCreateContainer(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.41/containers/create" || r.URL.Query().Get("name") != "web" {
+			http.Error(w, `{"message": "unexpected request `+r.URL.String()+`"}`, http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"message": "bad body"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"Id": "abc", "Warnings": ["careful"]}`))
+	}))
+	defer srv.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")), client.WithVersion("1.41"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctr := &inspect.BundleContainer{
+		Config:          &containertypes.Config{Image: "alpine", Hostname: "web"},
+		HostConfig:      &containertypes.HostConfig{ShmSize: 1 << 20},
+		HostConfigExtra: inspect.HostConfigExtra{CgroupnsMode: "private"},
+	}
+
+	resp, err := createContainer(context.Background(), cli, ctr, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "abc" || len(resp.Warnings) != 1 {
+		t.Fatalf("unexpected response %#v", resp)
+	}
+	if body["Image"] != "alpine" || body["Hostname"] != "web" {
+		t.Fatalf("expected the config at the top of the request, got %v", body)
+	}
+	hc, _ := body["HostConfig"].(map[string]interface{})
+	if hc["CgroupnsMode"] != "private" || hc["ShmSize"] != float64(1<<20) {
+		t.Fatalf("expected the host config along with its extra settings, got %v", hc)
+	}
+
+	if _, err := createContainer(context.Background(), cli, ctr, "db"); err == nil || !strings.Contains(err.Error(), "unexpected request") {
+		t.Fatalf("expected the error of the daemon, got %v", err)
+	}
+}
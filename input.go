@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/genuinetools/riddler/inspect"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	inputDocker = "docker"
+	inputPodman = "podman"
+	inputCRI    = "cri"
+)
+
+func validateInput(format string) error {
+	switch format {
+	case "":
+		return nil
+	case inputDocker, inputPodman, inputCRI:
+		if fromFile == "" {
+			return fmt.Errorf("--input only applies to the JSON read with --from-file")
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid input format, try %q, %q or %q", format, inputDocker, inputPodman, inputCRI)
+	}
+}
+
+// readContainers reads the saved inspect output at path in the format, or
+// the one it looks like if format is empty. The pod sandbox of CRI containers
+// is read from sandboxPath, if set.
+func readContainers(path, format, sandboxPath string) ([]container, error) {
+	data, err := inspect.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format = detectInput(data, format)
+
+	var sandbox *inspect.CRISandbox
+	if sandboxPath != "" {
+		if format != inputCRI {
+			return nil, fmt.Errorf("--sandbox only applies to the %s input", inputCRI)
+		}
+		sd, err := inspect.ReadFile(sandboxPath)
+		if err != nil {
+			return nil, err
+		}
+		sandbox, err = inspect.DecodeCRISandbox(bytes.NewReader(sd))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decodeContainers(data, format, inspect.CRIOptions{Sandbox: sandbox}, logrus.StandardLogger())
+}
+
+// detectInput returns the format of the inspect output in data, if format
+// is empty.
+func detectInput(data []byte, format string) string {
+	if format != "" {
+		return format
+	}
+	switch {
+	case inspect.IsPodman(data):
+		return inputPodman
+	case inspect.IsCRI(data):
+		return inputCRI
+	}
+	return inputDocker
+}
+
+// decodeContainers decodes the inspect output in data in the format, CRI
+// containers with the options. The warnings about it go to log, as well as
+// the ones of changing the specs of the containers later.
+func decodeContainers(data []byte, format string, cri inspect.CRIOptions, log logrus.FieldLogger) ([]container, error) {
+	var ctrs []container
+	switch format {
+	case inputPodman:
+		pcs, err := inspect.DecodePodman(bytes.NewReader(data), log)
+		if err != nil {
+			return nil, err
+		}
+		for _, pc := range pcs {
+			ctrs = append(ctrs, container{
+				ContainerJSON: pc.ContainerJSON,
+				fixup:         pc.Apply,
+			})
+		}
+	case inputCRI:
+		ccs, err := inspect.DecodeCRI(bytes.NewReader(data), cri, log)
+		if err != nil {
+			return nil, err
+		}
+		for _, cc := range ccs {
+			ctrs = append(ctrs, container{
+				ContainerJSON: cc.ContainerJSON,
+				fixup:         cc.Apply,
+			})
+		}
+	default:
+		dcs, err := inspect.Decode(bytes.NewReader(data), log)
+		if err != nil {
+			return nil, err
+		}
+		for _, dc := range dcs {
+			dc := dc
+			ctrs = append(ctrs, container{
+				ContainerJSON: dc.ContainerJSON,
+				fixup: func(config *specs.Spec) {
+					dc.Apply(config, log)
+				},
+			})
+		}
+	}
+	return ctrs, nil
+}
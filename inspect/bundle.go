@@ -0,0 +1,640 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/daemon/caps"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+	"github.com/genuinetools/riddler/parse"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// BundleContainer is the container docker would create from an OCI bundle.
+type BundleContainer struct {
+	Config     *containertypes.Config
+	HostConfig *containertypes.HostConfig
+	// HostConfigExtra holds the settings of the host config of newer
+	// daemons, daemons that do not know them ignore them.
+	HostConfigExtra HostConfigExtra
+	// Rootfs is the path of the root filesystem of the bundle.
+	Rootfs string
+	// Unsupported lists the settings of the spec that docker cannot create
+	// the container with.
+	Unsupported []string
+}
+
+// BundleOptions are the settings for converting a bundle that the spec does
+// not hold.
+type BundleOptions struct {
+	// Capabilities are the capabilities docker gives a container by
+	// default, the ones of the spec are added and dropped from them.
+	Capabilities []string
+}
+
+// unsupported records a setting of the spec that docker cannot express.
+func (c *BundleContainer) unsupported(format string, args ...interface{}) {
+	c.Unsupported = append(c.Unsupported, fmt.Sprintf(format, args...))
+}
+
+// FromBundle converts the spec of the OCI bundle in dir into the config and
+// host config docker would create the container with. The settings docker
+// has no way to express are listed in Unsupported, not dropped silently.
+func FromBundle(dir string, opts BundleOptions) (*BundleContainer, error) {
+	file := filepath.Join(dir, "config.json")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", file, err)
+	}
+	var spec specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("decoding %s failed: %v", file, err)
+	}
+	if spec.Process == nil {
+		return nil, fmt.Errorf("%s has no process", file)
+	}
+	if spec.Root == nil {
+		return nil, fmt.Errorf("%s has no root", file)
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &BundleContainer{
+		Config: &containertypes.Config{
+			Hostname:   spec.Hostname,
+			Env:        spec.Process.Env,
+			WorkingDir: spec.Process.Cwd,
+			Tty:        spec.Process.Terminal,
+		},
+		HostConfig: &containertypes.HostConfig{
+			ReadonlyRootfs: spec.Root.Readonly,
+			OomScoreAdj:    intValue(spec.Process.OOMScoreAdj),
+		},
+		Rootfs: spec.Root.Path,
+	}
+	if !filepath.IsAbs(c.Rootfs) {
+		c.Rootfs = filepath.Join(dir, c.Rootfs)
+	}
+	// docker keeps the stdin of interactive containers open
+	c.Config.OpenStdin = c.Config.Tty
+	c.Config.AttachStdin = c.Config.Tty
+
+	c.process(&spec)
+	c.annotations(spec.Annotations)
+	c.mounts(spec.Mounts, dir)
+	c.capabilities(spec.Process.Capabilities, opts.Capabilities)
+	if spec.Hooks != nil {
+		for _, h := range append(append(append([]specs.Hook{}, spec.Hooks.Prestart...), spec.Hooks.Poststart...), spec.Hooks.Poststop...) {
+			c.unsupported("hook %s, docker does not run hooks", h.Path)
+		}
+	}
+	if spec.Linux != nil {
+		if err := c.linux(spec.Linux); err != nil {
+			return nil, err
+		}
+	} else {
+		c.unsupported("spec without linux settings, docker creates linux containers")
+	}
+	if spec.Solaris != nil || spec.Windows != nil || spec.VM != nil {
+		c.unsupported("solaris, windows or vm settings, only the linux ones are converted")
+	}
+	return c, nil
+}
+
+// process converts the process of the spec.
+func (c *BundleContainer) process(spec *specs.Spec) {
+	p := spec.Process
+
+	args := p.Args
+	// the init of `docker run --init` is mounted in by docker
+	if len(args) > 2 && args[0] == parse.InitPath && args[1] == "--" {
+		init := true
+		c.HostConfig.Init = &init
+		args = args[2:]
+	}
+	// the process runs exactly the args, whatever the image says
+	c.Config.Entrypoint = strslice.StrSlice(args)
+	c.Config.Cmd = strslice.StrSlice{}
+
+	if p.ConsoleSize != nil {
+		c.HostConfig.ConsoleSize = [2]uint{p.ConsoleSize.Height, p.ConsoleSize.Width}
+	}
+
+	c.Config.User = fmt.Sprintf("%d:%d", p.User.UID, p.User.GID)
+	if p.User.Username != "" {
+		c.Config.User = p.User.Username
+	}
+	for _, gid := range p.User.AdditionalGids {
+		c.HostConfig.GroupAdd = append(c.HostConfig.GroupAdd, strconv.FormatUint(uint64(gid), 10))
+	}
+
+	for _, r := range p.Rlimits {
+		c.HostConfig.Ulimits = append(c.HostConfig.Ulimits, &units.Ulimit{
+			Name: strings.ToLower(strings.TrimPrefix(r.Type, "RLIMIT_")),
+			Hard: int64(r.Hard),
+			Soft: int64(r.Soft),
+		})
+	}
+
+	if p.NoNewPrivileges {
+		c.HostConfig.SecurityOpt = append(c.HostConfig.SecurityOpt, "no-new-privileges")
+	}
+	// docker confines the containers without a profile with its own
+	apparmor := p.ApparmorProfile
+	if apparmor == "" {
+		apparmor = "unconfined"
+	}
+	c.HostConfig.SecurityOpt = append(c.HostConfig.SecurityOpt, "apparmor="+apparmor)
+	if p.SelinuxLabel != "" {
+		opts, err := labelOpts(p.SelinuxLabel)
+		if err != nil {
+			c.unsupported("selinux label %s: %v", p.SelinuxLabel, err)
+		}
+		c.HostConfig.SecurityOpt = append(c.HostConfig.SecurityOpt, opts...)
+	}
+}
+
+// labelOpts turns an selinux label into the security options of docker.
+func labelOpts(label string) ([]string, error) {
+	parts := strings.SplitN(label, ":", 4)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("it is not user:role:type[:level]")
+	}
+	opts := []string{"label=user:" + parts[0], "label=role:" + parts[1], "label=type:" + parts[2]}
+	if len(parts) == 4 {
+		opts = append(opts, "label=level:"+parts[3])
+	}
+	return opts, nil
+}
+
+// annotations converts the annotations riddler keeps the settings without a
+// place in the spec in, the others become labels.
+func (c *BundleContainer) annotations(annotations map[string]string) {
+	for k, v := range annotations {
+		switch k {
+		case parse.AnnotationStopSignal:
+			c.Config.StopSignal = v
+		case parse.AnnotationExposedPorts:
+			c.Config.ExposedPorts = nat.PortSet{}
+			for _, port := range strings.Split(v, ",") {
+				c.Config.ExposedPorts[nat.Port(port)] = struct{}{}
+			}
+		default:
+			if c.Config.Labels == nil {
+				c.Config.Labels = map[string]string{}
+			}
+			c.Config.Labels[k] = v
+		}
+	}
+}
+
+// mounts converts the mounts of the spec, the ones docker adds to every
+// container are left out.
+func (c *BundleContainer) mounts(mounts []specs.Mount, dir string) {
+	defaults := map[string]specs.Mount{}
+	for _, m := range append(append([]specs.Mount{}, parse.DefaultMounts...), parse.NetworkMounts...) {
+		defaults[m.Destination] = m
+	}
+
+	for _, m := range mounts {
+		if d, ok := defaults[m.Destination]; ok && d.Type == m.Type {
+			c.defaultMount(m, d)
+			continue
+		}
+		// added by docker for --init
+		if m.Destination == parse.InitPath && c.HostConfig.Init != nil {
+			continue
+		}
+
+		switch m.Type {
+		case "bind":
+			source := m.Source
+			// riddler writes volumes, secrets and configs into the bundle
+			if !filepath.IsAbs(source) {
+				source = filepath.Join(dir, source)
+			}
+			mount := mounttypes.Mount{
+				Type:   mounttypes.TypeBind,
+				Source: source,
+				Target: m.Destination,
+			}
+			for _, o := range m.Options {
+				switch o {
+				case "bind", "rbind", "rw":
+				case "ro":
+					mount.ReadOnly = true
+				case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+					mount.BindOptions = &mounttypes.BindOptions{Propagation: mounttypes.Propagation(o)}
+				default:
+					c.unsupported("option %s of the bind mount of %s", o, m.Destination)
+				}
+			}
+			c.HostConfig.Mounts = append(c.HostConfig.Mounts, mount)
+		case "tmpfs":
+			if c.HostConfig.Tmpfs == nil {
+				c.HostConfig.Tmpfs = map[string]string{}
+			}
+			c.HostConfig.Tmpfs[m.Destination] = strings.Join(m.Options, ",")
+		default:
+			c.unsupported("%s mount of %s, docker only creates bind and tmpfs mounts", m.Type, m.Destination)
+		}
+	}
+}
+
+// runtimeMountOptions are the options of the default mounts that depend on
+// the user namespace, docker sets them itself.
+var runtimeMountOptions = map[string]string{
+	"/sys/fs/cgroup": "ro",
+	"/dev/pts":       "gid=5",
+}
+
+// defaultMount converts a mount docker adds to every container. The size of
+// /dev/shm is the shm size, the other options docker sets itself.
+func (c *BundleContainer) defaultMount(m, d specs.Mount) {
+	// the size is the one docker gives the mount, which is left out
+	defaultSize := ""
+	for _, o := range d.Options {
+		if strings.HasPrefix(o, "size=") {
+			defaultSize = o
+		}
+	}
+
+	opts := map[string]bool{}
+	for _, o := range d.Options {
+		opts[o] = true
+	}
+	for _, o := range m.Options {
+		if o == runtimeMountOptions[m.Destination] {
+			continue
+		}
+		if opts[o] {
+			delete(opts, o)
+			continue
+		}
+		if m.Destination == "/dev/shm" && strings.HasPrefix(o, "size=") {
+			size, err := units.RAMInBytes(strings.TrimPrefix(o, "size="))
+			if err != nil {
+				c.unsupported("size %s of %s: %v", o, m.Destination, err)
+				continue
+			}
+			c.HostConfig.ShmSize = size
+			delete(opts, defaultSize)
+			continue
+		}
+		c.unsupported("option %s of the %s mount of %s, docker sets the options of its own mounts", o, m.Type, m.Destination)
+	}
+	for o := range opts {
+		c.unsupported("%s mount of %s without option %s, docker sets the options of its own mounts", m.Type, m.Destination, o)
+	}
+}
+
+// capabilities converts the capabilities of the spec into the ones to add
+// to and drop from the defaults of docker.
+func (c *BundleContainer) capabilities(lc *specs.LinuxCapabilities, defaults []string) {
+	if lc == nil {
+		c.HostConfig.CapDrop = strslice.StrSlice{"ALL"}
+		return
+	}
+
+	set := map[string]bool{}
+	for _, cap := range lc.Bounding {
+		set[strings.TrimPrefix(strings.ToUpper(cap), "CAP_")] = true
+	}
+	for name, caps := range map[string][]string{
+		"effective":   lc.Effective,
+		"permitted":   lc.Permitted,
+		"inheritable": lc.Inheritable,
+	} {
+		if !sameCaps(caps, lc.Bounding) {
+			c.unsupported("%s capabilities that differ from the bounding set, docker gives the same ones", name)
+		}
+	}
+	if len(lc.Ambient) > 0 {
+		c.unsupported("ambient capabilities %s", strings.Join(lc.Ambient, ","))
+	}
+
+	all := caps.GetAllCapabilities()
+	if len(set) == 0 {
+		c.HostConfig.CapDrop = strslice.StrSlice{"ALL"}
+		return
+	}
+	if sameCaps(lc.Bounding, all) {
+		c.HostConfig.CapAdd = strslice.StrSlice{"ALL"}
+		return
+	}
+
+	def := map[string]bool{}
+	for _, cap := range defaults {
+		def[strings.TrimPrefix(cap, "CAP_")] = true
+	}
+	for cap := range set {
+		if !def[cap] {
+			c.HostConfig.CapAdd = append(c.HostConfig.CapAdd, cap)
+		}
+	}
+	for cap := range def {
+		if !set[cap] {
+			c.HostConfig.CapDrop = append(c.HostConfig.CapDrop, cap)
+		}
+	}
+	sort.Strings(c.HostConfig.CapAdd)
+	sort.Strings(c.HostConfig.CapDrop)
+}
+
+// sameCaps reports whether a and b hold the same capabilities.
+func sameCaps(a, b []string) bool {
+	set := map[string]bool{}
+	for _, cap := range a {
+		set[strings.TrimPrefix(strings.ToUpper(cap), "CAP_")] = true
+	}
+	other := map[string]bool{}
+	for _, cap := range b {
+		cap = strings.TrimPrefix(strings.ToUpper(cap), "CAP_")
+		if !set[cap] {
+			return false
+		}
+		other[cap] = true
+	}
+	return len(set) == len(other)
+}
+
+// linux converts the linux settings of the spec.
+func (c *BundleContainer) linux(l *specs.Linux) error {
+	hc := c.HostConfig
+	hc.Sysctls = l.Sysctl
+	hc.MaskedPaths = l.MaskedPaths
+	hc.ReadonlyPaths = l.ReadonlyPaths
+
+	c.namespaces(l)
+
+	if l.CgroupsPath != "" {
+		// docker names the cgroup after the container, under the parent
+		hc.CgroupParent = cgroupParent(l.CgroupsPath)
+	}
+
+	if l.Seccomp == nil {
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp=unconfined")
+	} else {
+		// the seccomp profiles of docker have the format of the spec
+		profile, err := json.Marshal(l.Seccomp)
+		if err != nil {
+			return fmt.Errorf("encoding seccomp profile failed: %v", err)
+		}
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp="+string(profile))
+	}
+
+	if l.RootfsPropagation != "" {
+		c.unsupported("rootfs propagation %s", l.RootfsPropagation)
+	}
+	if l.MountLabel != "" && !hasLabelOpt(hc.SecurityOpt) {
+		c.unsupported("mount label %s without a process label", l.MountLabel)
+	}
+	if l.IntelRdt != nil {
+		c.unsupported("intel rdt settings")
+	}
+
+	c.devices(l)
+	c.resources(l.Resources)
+	return nil
+}
+
+// hasLabelOpt reports whether the security options set an selinux label.
+func hasLabelOpt(opts []string) bool {
+	for _, o := range opts {
+		if strings.HasPrefix(o, "label=") {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupParent returns the parent of the cgroup of the path, for the
+// cgroupfs driver /parent/name and for the systemd one slice:prefix:name.
+func cgroupParent(path string) string {
+	parent := filepath.Dir(path)
+	if parts := strings.Split(path, ":"); len(parts) == 3 {
+		parent = parts[0]
+	}
+	// the default parents are left to the daemon, which may use the other
+	// cgroup driver
+	if parent == parse.DefaultCgroupParent || parent == parse.DefaultSystemdCgroupParent {
+		return ""
+	}
+	return parent
+}
+
+// namespaces converts the namespaces of the spec into the modes of docker.
+func (c *BundleContainer) namespaces(l *specs.Linux) {
+	hc := c.HostConfig
+	has := map[specs.LinuxNamespaceType]bool{}
+	for _, ns := range l.Namespaces {
+		has[ns.Type] = true
+		if ns.Path != "" {
+			c.unsupported("%s namespace at %s, docker only joins the namespaces of other containers", ns.Type, ns.Path)
+		}
+	}
+
+	if !has[specs.NetworkNamespace] {
+		hc.NetworkMode = "host"
+	}
+	if !has[specs.PIDNamespace] {
+		hc.PidMode = "host"
+	}
+	if !has[specs.IPCNamespace] {
+		hc.IpcMode = "host"
+	}
+	if !has[specs.UTSNamespace] {
+		hc.UTSMode = "host"
+	}
+	if !has[specs.MountNamespace] {
+		c.unsupported("no mount namespace, docker always creates one")
+	}
+	// the daemon picks the mode for its cgroup version if it is not set
+	c.HostConfigExtra.CgroupnsMode = "host"
+	if has[specs.CgroupNamespace] {
+		c.HostConfigExtra.CgroupnsMode = "private"
+	}
+	if has[specs.UserNamespace] || len(l.UIDMappings) > 0 || len(l.GIDMappings) > 0 {
+		// the mappings are set for the whole daemon with --userns-remap
+		c.unsupported("user namespace and its id mappings, docker sets them for the daemon with --userns-remap")
+	}
+}
+
+// devices converts the devices of the spec, along with the rules of the
+// devices cgroup. The devices docker gives every container are left out.
+func (c *BundleContainer) devices(l *specs.Linux) {
+	defaults := map[string]bool{"/dev/tty": true}
+	for _, d := range configs.DefaultSimpleDevices {
+		defaults[d.Path] = true
+	}
+
+	// the access of the devices is in the devices cgroup
+	type key struct {
+		t            string
+		major, minor int64
+	}
+	access := map[key]string{}
+	var rules []specs.LinuxDeviceCgroup
+	if l.Resources != nil {
+		for _, r := range l.Resources.Devices {
+			if r.Major != nil && r.Minor != nil && r.Allow {
+				access[key{r.Type, *r.Major, *r.Minor}] = r.Access
+			}
+			rules = append(rules, r)
+		}
+	}
+
+	devices := map[key]bool{}
+	for _, d := range l.Devices {
+		k := key{d.Type, d.Major, d.Minor}
+		devices[k] = true
+		if defaults[d.Path] {
+			continue
+		}
+		permissions, ok := access[k]
+		if !ok {
+			permissions = "rwm"
+		}
+		c.HostConfig.Devices = append(c.HostConfig.Devices, containertypes.DeviceMapping{
+			PathOnHost:        d.Path,
+			PathInContainer:   d.Path,
+			CgroupPermissions: permissions,
+		})
+	}
+
+	for i, r := range rules {
+		// docker denies all devices first, then allows its own
+		if i == 0 && !r.Allow && r.Type == "" && r.Major == nil && r.Minor == nil {
+			continue
+		}
+		if r.Major != nil && r.Minor != nil && devices[key{r.Type, *r.Major, *r.Minor}] {
+			continue
+		}
+		if !r.Allow {
+			c.unsupported("devices cgroup rule denying %s, docker only adds rules that allow", deviceRule(r))
+			continue
+		}
+		c.HostConfig.DeviceCgroupRules = append(c.HostConfig.DeviceCgroupRules, deviceRule(r))
+	}
+}
+
+// deviceRule formats the devices cgroup rule like `docker run
+// --device-cgroup-rule` takes it.
+func deviceRule(r specs.LinuxDeviceCgroup) string {
+	t := r.Type
+	if t == "" {
+		t = "a"
+	}
+	major, minor := "*", "*"
+	if r.Major != nil {
+		major = strconv.FormatInt(*r.Major, 10)
+	}
+	if r.Minor != nil {
+		minor = strconv.FormatInt(*r.Minor, 10)
+	}
+	return fmt.Sprintf("%s %s:%s %s", t, major, minor, r.Access)
+}
+
+// resources converts the cgroup resources of the spec.
+func (c *BundleContainer) resources(r *specs.LinuxResources) {
+	if r == nil {
+		return
+	}
+	res := &c.HostConfig.Resources
+
+	if m := r.Memory; m != nil {
+		res.Memory = int64Value(m.Limit)
+		res.MemoryReservation = int64Value(m.Reservation)
+		res.MemorySwap = int64Value(m.Swap)
+		res.KernelMemory = int64Value(m.Kernel)
+		res.OomKillDisable = m.DisableOOMKiller
+		if m.Swappiness != nil {
+			swappiness := int64(*m.Swappiness)
+			res.MemorySwappiness = &swappiness
+		}
+		if int64Value(m.KernelTCP) != 0 {
+			c.unsupported("kernel TCP memory limit %d", *m.KernelTCP)
+		}
+	}
+
+	if cpu := r.CPU; cpu != nil {
+		res.CPUShares = int64(uint64Value(cpu.Shares))
+		res.CPUQuota = int64Value(cpu.Quota)
+		res.CPUPeriod = int64(uint64Value(cpu.Period))
+		res.CPURealtimeRuntime = int64Value(cpu.RealtimeRuntime)
+		res.CPURealtimePeriod = int64(uint64Value(cpu.RealtimePeriod))
+		res.CpusetCpus = cpu.Cpus
+		res.CpusetMems = cpu.Mems
+	}
+
+	if r.Pids != nil {
+		res.PidsLimit = r.Pids.Limit
+	}
+
+	if b := r.BlockIO; b != nil {
+		if b.Weight != nil {
+			res.BlkioWeight = *b.Weight
+		}
+		if b.LeafWeight != nil && *b.LeafWeight != 0 {
+			c.unsupported("block IO leaf weight %d", *b.LeafWeight)
+		}
+		// docker names the devices by path, the spec by number
+		for _, d := range b.WeightDevice {
+			c.unsupported("block IO weight of device %d:%d", d.Major, d.Minor)
+		}
+		for name, devices := range map[string][]specs.LinuxThrottleDevice{
+			"read bps":   b.ThrottleReadBpsDevice,
+			"write bps":  b.ThrottleWriteBpsDevice,
+			"read iops":  b.ThrottleReadIOPSDevice,
+			"write iops": b.ThrottleWriteIOPSDevice,
+		} {
+			for _, d := range devices {
+				c.unsupported("block IO %s limit of device %d:%d", name, d.Major, d.Minor)
+			}
+		}
+	}
+
+	for _, h := range r.HugepageLimits {
+		c.unsupported("hugepage limit of %s", h.Pagesize)
+	}
+	if r.Network != nil {
+		c.unsupported("network class id and priorities")
+	}
+	for name := range r.Rdma {
+		c.unsupported("rdma limit of %s", name)
+	}
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func int64Value(i *int64) int64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func uint64Value(i *uint64) uint64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
@@ -0,0 +1,122 @@
+package inspect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFromBundle(t *testing.T) {
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path: "nginx",
+			Args: []string{"-g", "daemon off;"},
+			HostConfig: &containertypes.HostConfig{
+				NetworkMode: "host",
+				ShmSize:     128 << 20,
+				Tmpfs:       map[string]string{"/run": "size=64m"},
+				Resources: containertypes.Resources{
+					Memory:    1 << 30,
+					PidsLimit: 100,
+				},
+			},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mounttypes.TypeBind, Source: "/srv/www", Destination: "/usr/share/nginx/html", Mode: "ro"},
+		},
+		Config: &containertypes.Config{
+			Hostname:   "web",
+			Env:        []string{"A=b"},
+			User:       "101:101",
+			StopSignal: "SIGQUIT",
+		},
+	}
+	spec, err := parse.Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Hooks = &specs.Hooks{Prestart: []specs.Hook{{Path: "/usr/bin/netns"}}}
+	spec.Process.ApparmorProfile = ""
+	for i, m := range spec.Mounts {
+		if m.Destination == "/dev/mqueue" {
+			spec.Mounts[i].Options = append(m.Options, "ro")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "riddler-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := FromBundle(dir, BundleOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ctr.Config.Entrypoint, strslice.StrSlice{"nginx", "-g", "daemon off;"}) {
+		t.Fatalf("expected the entrypoint to be the args, got %v", ctr.Config.Entrypoint)
+	}
+	if ctr.Config.User != "101:101" || ctr.Config.StopSignal != "SIGQUIT" || ctr.Config.Hostname != "web" {
+		t.Fatalf("expected user, stop signal and hostname to be kept, got %#v", ctr.Config)
+	}
+	if ctr.Rootfs != filepath.Join(dir, "rootfs") {
+		t.Fatalf("expected the rootfs in the bundle, got %s", ctr.Rootfs)
+	}
+
+	hc := ctr.HostConfig
+	if hc.NetworkMode != "host" || hc.PidMode != "" {
+		t.Fatalf("expected the host network only, got network %q and pid %q", hc.NetworkMode, hc.PidMode)
+	}
+	if hc.Memory != 1<<30 || hc.PidsLimit != 100 {
+		t.Fatalf("expected the memory and pids limits, got %d and %d", hc.Memory, hc.PidsLimit)
+	}
+	if hc.Tmpfs["/run"] != "noexec,nosuid,nodev,size=64m" {
+		t.Fatalf("expected the tmpfs of /run, got %v", hc.Tmpfs)
+	}
+	expectedMounts := []mounttypes.Mount{
+		{Type: mounttypes.TypeBind, Source: "/srv/www", Target: "/usr/share/nginx/html", ReadOnly: true, BindOptions: &mounttypes.BindOptions{Propagation: "rprivate"}},
+	}
+	if !reflect.DeepEqual(hc.Mounts, expectedMounts) {
+		t.Fatalf("expected mounts %#v, got %#v", expectedMounts, hc.Mounts)
+	}
+	if len(hc.Ulimits) != 1 || hc.Ulimits[0].Name != "nofile" {
+		t.Fatalf("expected the nofile ulimit, got %v", hc.Ulimits)
+	}
+	if hc.ShmSize != 128<<20 {
+		t.Fatalf("expected the shm size of /dev/shm, got %d", hc.ShmSize)
+	}
+	if ctr.HostConfigExtra.CgroupnsMode != "host" {
+		t.Fatalf("expected the cgroup namespace of the host, got %q", ctr.HostConfigExtra.CgroupnsMode)
+	}
+	apparmor := false
+	for _, o := range hc.SecurityOpt {
+		apparmor = apparmor || o == "apparmor=unconfined"
+	}
+	if !apparmor {
+		t.Fatalf("expected no apparmor profile to be unconfined, got %v", hc.SecurityOpt)
+	}
+
+	// docker does not run hooks, nor changes the options of its mounts
+	if len(ctr.Unsupported) != 2 {
+		t.Fatalf("expected the hook and the option of /dev/mqueue to be unsupported, got %v", ctr.Unsupported)
+	}
+}
@@ -0,0 +1,939 @@
+package inspect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+	"github.com/genuinetools/riddler/parse"
+	"github.com/ghodss/yaml"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ComposeProjectLabel is the label docker-compose puts on the containers
+	// of a project, holding the name of the project.
+	ComposeProjectLabel = "com.docker.compose.project"
+
+	composeServiceLabel   = "com.docker.compose.service"
+	composeNumberLabel    = "com.docker.compose.container-number"
+	composeDependsOnLabel = "com.docker.compose.depends_on"
+)
+
+var (
+	composeProjectChars = regexp.MustCompile("[^a-z0-9]")
+
+	// composeIgnoredKeys are the keys of services that have no place in
+	// the spec, so they are not warned about.
+	composeIgnoredKeys = map[string]bool{
+		"build":       true,
+		"healthcheck": true,
+		"logging":     true,
+		"networks":    true,
+		"restart":     true,
+	}
+)
+
+// ComposeContainer is a container of a service of a compose project.
+type ComposeContainer struct {
+	types.ContainerJSON
+	// Service is the name of the service.
+	Service string
+	// DependsOn are the services that have to be started first.
+	DependsOn []string
+}
+
+// ComposeProject is the part of a compose file that can be converted.
+type ComposeProject struct {
+	// Name is the name of the project.
+	Name string `json:"-"`
+	// Dir is the directory relative paths are resolved against.
+	Dir      string                    `json:"-"`
+	Services map[string]ComposeService `json:"services"`
+}
+
+// ComposeService is a service of a compose file.
+type ComposeService struct {
+	Image         string         `json:"image"`
+	ContainerName string         `json:"container_name"`
+	Command       composeCommand `json:"command"`
+	Entrypoint    composeCommand `json:"entrypoint"`
+	Environment   composeMap     `json:"environment"`
+	Labels        composeMap     `json:"labels"`
+	WorkingDir    string         `json:"working_dir"`
+	User          string         `json:"user"`
+	Hostname      string         `json:"hostname"`
+	Tty           bool           `json:"tty"`
+	StdinOpen     bool           `json:"stdin_open"`
+	StopSignal    string         `json:"stop_signal"`
+
+	Privileged  bool                     `json:"privileged"`
+	ReadOnly    bool                     `json:"read_only"`
+	CapAdd      []string                 `json:"cap_add"`
+	CapDrop     []string                 `json:"cap_drop"`
+	SecurityOpt []string                 `json:"security_opt"`
+	Sysctls     composeMap               `json:"sysctls"`
+	Ulimits     map[string]composeUlimit `json:"ulimits"`
+	Devices     []string                 `json:"devices"`
+	Tmpfs       composeList              `json:"tmpfs"`
+	Volumes     []composeVolume          `json:"volumes"`
+	Expose      []composeString          `json:"expose"`
+	Ports       []composePort            `json:"ports"`
+	DependsOn   composeDependsOn         `json:"depends_on"`
+	NetworkMode string                   `json:"network_mode"`
+	Ipc         string                   `json:"ipc"`
+	Pid         string                   `json:"pid"`
+
+	MemLimit       composeBytes   `json:"mem_limit"`
+	MemReservation composeBytes   `json:"mem_reservation"`
+	ShmSize        composeBytes   `json:"shm_size"`
+	Cpus           composeString  `json:"cpus"`
+	CPUShares      int64          `json:"cpu_shares"`
+	Deploy         *composeDeploy `json:"deploy"`
+}
+
+type composeDeploy struct {
+	Resources struct {
+		Limits struct {
+			Cpus   composeString `json:"cpus"`
+			Memory composeBytes  `json:"memory"`
+		} `json:"limits"`
+		Reservations struct {
+			Memory composeBytes `json:"memory"`
+		} `json:"reservations"`
+	} `json:"resources"`
+}
+
+// ComposeOptions are the settings for converting a compose project that
+// the compose file does not hold.
+type ComposeOptions struct {
+	// VolumesDir is the directory holding the named and anonymous volumes.
+	VolumesDir string
+	// ImageConfig returns the config of the image, used for the defaults
+	// the service does not set. It can be nil.
+	ImageConfig func(image string) (*containertypes.Config, error)
+	// Log gets the warnings of the conversion. It can be nil, they go to
+	// the standard logger then.
+	Log logrus.FieldLogger
+}
+
+// ReadCompose reads the compose file at path. Variables in the values of the
+// file are replaced with the ones in the environment, or else the ones in the
+// .env file next to it, like docker-compose does. If project is empty the
+// project is named after the directory of the file. The keys of the services
+// that are not converted are warned about to log.
+func ReadCompose(path, project string, log logrus.FieldLogger) (*ComposeProject, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", path, err)
+	}
+
+	var p ComposeProject
+	if p.Dir, err = filepath.Abs(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	env, err := readProjectEnv(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the values are replaced after parsing, so the ones of the variables
+	// cannot change the structure of the file
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decoding compose file failed: %v", err)
+	}
+	raw, err = interpolate(raw, func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decoding compose file failed: %v", err)
+	}
+	if len(p.Services) == 0 {
+		return nil, errors.New("compose file has no services")
+	}
+	warnComposeKeys(raw, log)
+
+	p.Name = project
+	if p.Name == "" {
+		p.Name = composeProjectChars.ReplaceAllString(strings.ToLower(filepath.Base(p.Dir)), "")
+	}
+	return &p, nil
+}
+
+// FromCompose builds the docker inspect data of a container for each of the
+// services of the project, sorted by name. Services sharing the namespaces
+// of another service, ex. with network_mode: service:db, get the
+// container:<service> mode docker would give them.
+func FromCompose(p *ComposeProject, opts ComposeOptions) ([]ComposeContainer, error) {
+	opts.Log = logger(opts.Log)
+
+	var names []string
+	for name := range p.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ctrs []ComposeContainer
+	for _, name := range names {
+		ctr, err := p.container(name, p.Services[name], opts)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %v", name, err)
+		}
+		ctrs = append(ctrs, ctr)
+	}
+	return ctrs, nil
+}
+
+func (p *ComposeProject) container(name string, svc ComposeService, opts ComposeOptions) (ComposeContainer, error) {
+	image := svc.Image
+	if image == "" {
+		// services that are only built get images named after them
+		image = p.Name + "_" + name
+	}
+
+	img := &containertypes.Config{}
+	if opts.ImageConfig != nil {
+		config, err := opts.ImageConfig(image)
+		switch {
+		case err == nil:
+			img = config
+		case svc.Command == nil && svc.Entrypoint == nil:
+			return ComposeContainer{}, fmt.Errorf("getting the command of image %s failed: %v", image, err)
+		default:
+			opts.Log.Warnf("Getting the config of image %s failed, using the defaults: %v", image, err)
+		}
+	}
+
+	// like docker run, a new entrypoint drops the cmd of the image
+	entrypoint := append([]string{}, img.Entrypoint...)
+	cmd := append([]string{}, img.Cmd...)
+	if svc.Entrypoint != nil {
+		entrypoint = svc.Entrypoint
+		cmd = nil
+	}
+	if svc.Command != nil {
+		cmd = svc.Command
+	}
+	process := append(append([]string{}, entrypoint...), cmd...)
+	if len(process) == 0 {
+		return ComposeContainer{}, errors.New("no command for the container")
+	}
+
+	config := &containertypes.Config{
+		Hostname:     svc.Hostname,
+		User:         img.User,
+		Tty:          svc.Tty,
+		OpenStdin:    svc.StdinOpen,
+		Env:          append([]string{}, img.Env...),
+		Image:        image,
+		WorkingDir:   img.WorkingDir,
+		Labels:       map[string]string{},
+		StopSignal:   img.StopSignal,
+		ExposedPorts: nat.PortSet{},
+	}
+	if len(config.Env) == 0 {
+		config.Env = append(config.Env, parse.DefaultTerminalEnv...)
+	}
+	config.Env = mergeEnv(config.Env, svc.Environment.env())
+	for k, v := range img.Labels {
+		config.Labels[k] = v
+	}
+	for k, v := range svc.Labels {
+		config.Labels[k] = ""
+		if v != nil {
+			config.Labels[k] = *v
+		}
+	}
+	config.Labels[ComposeProjectLabel] = p.Name
+	config.Labels[composeServiceLabel] = name
+	if svc.WorkingDir != "" {
+		config.WorkingDir = svc.WorkingDir
+	}
+	if svc.User != "" {
+		config.User = svc.User
+	}
+	if svc.StopSignal != "" {
+		config.StopSignal = svc.StopSignal
+	}
+	for port := range img.ExposedPorts {
+		config.ExposedPorts[port] = struct{}{}
+	}
+	for _, e := range svc.Expose {
+		config.ExposedPorts[composePortName(string(e))] = struct{}{}
+	}
+	for _, port := range svc.Ports {
+		config.ExposedPorts[port.port] = struct{}{}
+	}
+
+	hc := &containertypes.HostConfig{
+		NetworkMode:    containertypes.NetworkMode(composeMode(svc.NetworkMode)),
+		IpcMode:        containertypes.IpcMode(composeMode(svc.Ipc)),
+		PidMode:        containertypes.PidMode(composeMode(svc.Pid)),
+		Privileged:     svc.Privileged,
+		ReadonlyRootfs: svc.ReadOnly,
+		CapAdd:         svc.CapAdd,
+		CapDrop:        svc.CapDrop,
+		SecurityOpt:    svc.SecurityOpt,
+		Sysctls:        map[string]string{},
+		Tmpfs:          map[string]string{},
+		ShmSize:        int64(svc.ShmSize),
+	}
+	if hc.NetworkMode == "" {
+		hc.NetworkMode = "default"
+	}
+	for k, v := range svc.Sysctls {
+		hc.Sysctls[k] = ""
+		if v != nil {
+			hc.Sysctls[k] = *v
+		}
+	}
+	for _, t := range svc.Tmpfs {
+		parts := strings.SplitN(t, ":", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		hc.Tmpfs[parts[0]] = parts[1]
+	}
+	for ulimit, l := range svc.Ulimits {
+		hc.Ulimits = append(hc.Ulimits, &units.Ulimit{Name: ulimit, Soft: l.Soft, Hard: l.Hard})
+	}
+	sort.Slice(hc.Ulimits, func(i, j int) bool {
+		return hc.Ulimits[i].Name < hc.Ulimits[j].Name
+	})
+	for _, d := range svc.Devices {
+		device, err := parseDevice(d)
+		if err != nil {
+			return ComposeContainer{}, err
+		}
+		hc.Devices = append(hc.Devices, device)
+	}
+
+	// the deploy section of version 3 files wins over the old keys
+	hc.Memory = int64(svc.MemLimit)
+	hc.MemoryReservation = int64(svc.MemReservation)
+	hc.CPUShares = svc.CPUShares
+	cpus := string(svc.Cpus)
+	if svc.Deploy != nil {
+		if m := svc.Deploy.Resources.Limits.Memory; m != 0 {
+			hc.Memory = int64(m)
+		}
+		if m := svc.Deploy.Resources.Reservations.Memory; m != 0 {
+			hc.MemoryReservation = int64(m)
+		}
+		if c := svc.Deploy.Resources.Limits.Cpus; c != "" {
+			cpus = string(c)
+		}
+	}
+	if cpus != "" {
+		n, err := strconv.ParseFloat(cpus, 64)
+		if err != nil {
+			return ComposeContainer{}, fmt.Errorf("parsing cpus %s failed: %v", cpus, err)
+		}
+		hc.NanoCPUs = int64(n * 1e9)
+	}
+
+	ctrName := svc.ContainerName
+	if ctrName == "" {
+		ctrName = p.Name + "_" + name + "_1"
+	}
+	ctr := ComposeContainer{
+		ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         ctrName,
+				Path:       process[0],
+				Args:       process[1:],
+				State:      &types.ContainerState{Status: "created"},
+				Image:      image,
+				Name:       "/" + name,
+				HostConfig: hc,
+			},
+			Mounts: []types.MountPoint{},
+			Config: config,
+		},
+		Service:   name,
+		DependsOn: svc.DependsOn,
+	}
+
+	mounted := map[string]bool{}
+	for _, v := range svc.Volumes {
+		m := types.MountPoint{
+			Type:        mounttypes.TypeBind,
+			Source:      v.Source,
+			Destination: v.Target,
+			RW:          !v.ReadOnly,
+		}
+		if v.ReadOnly {
+			m.Mode = "ro"
+		}
+		switch {
+		case v.Type == "tmpfs":
+			hc.Tmpfs[v.Target] = ""
+			continue
+		case v.Source == "":
+			m.Type = mounttypes.TypeVolume
+			m.Source = filepath.Join(opts.VolumesDir, name+"-"+volumeDirName(v.Target))
+		case v.Type == "bind" || (v.Type != "volume" && (strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, "~"))):
+			m.Source = composeHostPath(p.Dir, v.Source)
+		default:
+			// named volumes are shared by the services using them
+			source, err := volumeSource(opts.VolumesDir, v.Source)
+			if err != nil {
+				return ComposeContainer{}, fmt.Errorf("volume of service %s: %v", name, err)
+			}
+			m.Type = mounttypes.TypeVolume
+			m.Name = v.Source
+			m.Source = source
+		}
+		mounted[m.Destination] = true
+		ctr.Mounts = append(ctr.Mounts, m)
+	}
+
+	// the volumes of the image are anonymous volumes unless mounted over
+	var imgVolumes []string
+	for v := range img.Volumes {
+		if !mounted[v] {
+			imgVolumes = append(imgVolumes, v)
+		}
+	}
+	sort.Strings(imgVolumes)
+	for _, v := range imgVolumes {
+		ctr.Mounts = append(ctr.Mounts, types.MountPoint{
+			Type:        mounttypes.TypeVolume,
+			Source:      filepath.Join(opts.VolumesDir, name+"-"+volumeDirName(v)),
+			Destination: v,
+			RW:          true,
+		})
+	}
+
+	return ctr, nil
+}
+
+// FromComposeContainers turns the containers of a compose project, ex. from
+// `docker inspect`, into the containers of its services. Each container is
+// named after its service, with the container number if the service has more
+// than one, and the container:<id> modes of the containers sharing the
+// namespaces of another one of the project use those names.
+func FromComposeContainers(dcs []types.ContainerJSON) ([]ComposeContainer, error) {
+	count := map[string]int{}
+	for _, dc := range dcs {
+		service := dc.Config.Labels[composeServiceLabel]
+		if service == "" {
+			return nil, fmt.Errorf("container %s is not part of a compose service", dc.Name)
+		}
+		count[service]++
+	}
+
+	var ctrs []ComposeContainer
+	names := map[string]string{}
+	for _, dc := range dcs {
+		ctr := ComposeContainer{
+			ContainerJSON: dc,
+			Service:       dc.Config.Labels[composeServiceLabel],
+		}
+
+		// copy what we change so the inspect data stays the same
+		base := *dc.ContainerJSONBase
+		hc := *dc.HostConfig
+		base.HostConfig = &hc
+		ctr.ContainerJSONBase = &base
+
+		names[dc.ID] = ctr.Service
+		names[strings.TrimPrefix(dc.Name, "/")] = ctr.Service
+		if count[ctr.Service] > 1 {
+			names[dc.ID] += "_" + dc.Config.Labels[composeNumberLabel]
+			names[strings.TrimPrefix(dc.Name, "/")] = names[dc.ID]
+		}
+		ctr.Name = "/" + names[dc.ID]
+
+		// newer versions of compose save the dependencies as
+		// service:condition[:restart], separated by commas
+		if deps := dc.Config.Labels[composeDependsOnLabel]; deps != "" {
+			for _, dep := range strings.Split(deps, ",") {
+				ctr.DependsOn = append(ctr.DependsOn, strings.SplitN(dep, ":", 2)[0])
+			}
+		}
+
+		ctrs = append(ctrs, ctr)
+	}
+
+	rename := func(mode string) string {
+		if !strings.HasPrefix(mode, "container:") {
+			return mode
+		}
+		if name, ok := names[strings.TrimPrefix(mode, "container:")]; ok {
+			return "container:" + name
+		}
+		return mode
+	}
+	for _, ctr := range ctrs {
+		hc := ctr.HostConfig
+		hc.NetworkMode = containertypes.NetworkMode(rename(string(hc.NetworkMode)))
+		hc.IpcMode = containertypes.IpcMode(rename(string(hc.IpcMode)))
+		hc.PidMode = containertypes.PidMode(rename(string(hc.PidMode)))
+	}
+
+	sort.Slice(ctrs, func(i, j int) bool {
+		return ctrs[i].Name < ctrs[j].Name
+	})
+	return ctrs, nil
+}
+
+// composeMode turns the namespace modes of a service into the docker ones.
+func composeMode(mode string) string {
+	if strings.HasPrefix(mode, "service:") {
+		return "container:" + strings.TrimPrefix(mode, "service:")
+	}
+	return mode
+}
+
+// composeHostPath resolves the host path of a bind mount the way
+// docker-compose does.
+func composeHostPath(dir, p string) string {
+	if strings.HasPrefix(p, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = home + strings.TrimPrefix(p, "~")
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return filepath.Clean(p)
+}
+
+func composePortName(port string) nat.Port {
+	if !strings.Contains(port, "/") {
+		port += "/tcp"
+	}
+	return nat.Port(port)
+}
+
+// warnComposeKeys warns about the keys of the services of the decoded
+// compose file that are not converted.
+func warnComposeKeys(raw interface{}, log logrus.FieldLogger) {
+	known := map[string]bool{}
+	t := reflect.TypeOf(ComposeService{})
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+
+	file, _ := raw.(map[string]interface{})
+	services, _ := file["services"].(map[string]interface{})
+	var names []string
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc, _ := services[name].(map[string]interface{})
+		var keys []string
+		for key := range svc {
+			// the extension fields are for the users of the file
+			if !known[key] && !composeIgnoredKeys[key] && !strings.HasPrefix(key, "x-") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			log.Warnf("Ignoring %s of service %s, it is not converted", key, name)
+		}
+	}
+}
+
+// readProjectEnv reads the variables of the .env file of the project in
+// dir, if there is one.
+func readProjectEnv(dir string) (map[string]string, error) {
+	file := filepath.Join(dir, ".env")
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	lines, err := readEnvFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, line := range lines {
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env, nil
+}
+
+// interpolate replaces the variables in the strings of the decoded compose
+// file v with the ones lookup finds.
+func interpolate(v interface{}, lookup func(string) (string, bool)) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return interpolateString(v, lookup)
+	case []interface{}:
+		for i, e := range v {
+			var err error
+			if v[i], err = interpolate(e, lookup); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			var err error
+			if v[k], err = interpolate(e, lookup); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// interpolateString replaces the ${VAR}, ${VAR:-default}, ${VAR-default},
+// ${VAR:?error} and ${VAR?error} variables in s with the ones lookup finds,
+// the last two fail if the variable is not set, or empty with the colon.
+// $$ is a literal $.
+func interpolateString(s string, lookup func(string) (string, bool)) (string, error) {
+	var err error
+	s = os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		i := strings.IndexAny(name, ":-?")
+		if i < 0 {
+			v, _ := lookup(name)
+			return v
+		}
+		v, ok := lookup(name[:i])
+		op, arg := name[i:i+1], name[i+1:]
+		// with the colon an empty variable counts as not set
+		if op == ":" && len(arg) > 0 {
+			op, arg = arg[:1], arg[1:]
+			ok = ok && v != ""
+		}
+		switch op {
+		case "-":
+			if !ok {
+				return arg
+			}
+		case "?":
+			if !ok && err == nil {
+				err = fmt.Errorf("required variable %s is missing a value: %s", name[:i], arg)
+			}
+		default:
+			if err == nil {
+				err = fmt.Errorf("invalid interpolation format for ${%s}", name)
+			}
+		}
+		return v
+	})
+	return s, err
+}
+
+// splitCommand splits a command string into its arguments like a shell, with
+// single and double quotes and backslash escapes.
+func splitCommand(s string) ([]string, error) {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// composeCommand is a command, either as a list or a string that is split
+// like a shell would.
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err == nil {
+		*c = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	args, err := splitCommand(s)
+	if err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// composeList is a list of strings, or a single one.
+type composeList []string
+
+func (l *composeList) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = []string{s}
+	return nil
+}
+
+// composeString is a string that can be written as a number as well.
+type composeString string
+
+func (s *composeString) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		*s = composeString(v)
+	case float64:
+		*s = composeString(strconv.FormatFloat(v, 'f', -1, 64))
+	case nil:
+	default:
+		return fmt.Errorf("expected a string or a number, got %s", b)
+	}
+	return nil
+}
+
+// composeMap is a map of strings, either as a map or as a list of key=value
+// strings. A key without a value is nil.
+type composeMap map[string]*string
+
+func (m *composeMap) UnmarshalJSON(b []byte) error {
+	*m = composeMap{}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err == nil {
+		for _, e := range list {
+			parts := strings.SplitN(e, "=", 2)
+			if len(parts) == 1 {
+				(*m)[parts[0]] = nil
+				continue
+			}
+			v := parts[1]
+			(*m)[parts[0]] = &v
+		}
+		return nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	for k, v := range values {
+		var s string
+		switch v := v.(type) {
+		case nil:
+			(*m)[k] = nil
+			continue
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			s = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("value of %s is not a string", k)
+		}
+		(*m)[k] = &s
+	}
+	return nil
+}
+
+// env returns the map as environment variables, sorted by name. Keys without
+// a value take theirs from the environment, like docker-compose does.
+func (m composeMap) env() []string {
+	var env []string
+	for k, v := range m {
+		if v == nil {
+			value, ok := os.LookupEnv(k)
+			if !ok {
+				continue
+			}
+			v = &value
+		}
+		env = append(env, k+"="+*v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// composeUlimit is a limit, either with the same soft and hard value or
+// with both of them.
+type composeUlimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+func (u *composeUlimit) UnmarshalJSON(b []byte) error {
+	var n int64
+	if err := json.Unmarshal(b, &n); err == nil {
+		u.Soft, u.Hard = n, n
+		return nil
+	}
+	type limit composeUlimit
+	return json.Unmarshal(b, (*limit)(u))
+}
+
+// composeBytes is a size in bytes, either as a number or a string like 512m.
+type composeBytes int64
+
+func (s *composeBytes) UnmarshalJSON(b []byte) error {
+	var v composeString
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v == "" {
+		return nil
+	}
+	n, err := units.RAMInBytes(string(v))
+	if err != nil {
+		return err
+	}
+	*s = composeBytes(n)
+	return nil
+}
+
+// composeVolume is a volume of a service, either in the short
+// [source:]target[:mode] syntax or the long one.
+type composeVolume struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+func (v *composeVolume) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		type volume composeVolume
+		return json.Unmarshal(b, (*volume)(v))
+	}
+
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 1:
+		v.Target = parts[0]
+	case 2:
+		v.Source, v.Target = parts[0], parts[1]
+	case 3:
+		v.Source, v.Target = parts[0], parts[1]
+		for _, opt := range strings.Split(parts[2], ",") {
+			if opt == "ro" {
+				v.ReadOnly = true
+			}
+		}
+	default:
+		return fmt.Errorf("parsing volume %s as [source:]target[:mode] failed", s)
+	}
+	return nil
+}
+
+// composePort is a published or exposed port of a service, in the short
+// [[ip:]published:]target[/protocol] syntax or the long one.
+type composePort struct {
+	port nat.Port
+}
+
+func (p *composePort) UnmarshalJSON(b []byte) error {
+	var long struct {
+		Target   int    `json:"target"`
+		Protocol string `json:"protocol"`
+	}
+	if err := json.Unmarshal(b, &long); err == nil {
+		if long.Protocol == "" {
+			long.Protocol = "tcp"
+		}
+		p.port = nat.Port(fmt.Sprintf("%d/%s", long.Target, long.Protocol))
+		return nil
+	}
+
+	var s composeString
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parts := strings.Split(string(s), ":")
+	p.port = composePortName(parts[len(parts)-1])
+	return nil
+}
+
+// composeDependsOn are the services a service depends on, either as a list
+// or as a map with the conditions.
+type composeDependsOn []string
+
+func (d *composeDependsOn) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err == nil {
+		*d = list
+		return nil
+	}
+	var conditions map[string]interface{}
+	if err := json.Unmarshal(b, &conditions); err != nil {
+		return err
+	}
+	for service := range conditions {
+		*d = append(*d, service)
+	}
+	sort.Strings(*d)
+	return nil
+}
@@ -0,0 +1,274 @@
+package inspect
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+)
+
+const composeFile = `version: "3.7"
+services:
+  web:
+    image: nginx:1.15
+    command: nginx -g 'daemon off;'
+    depends_on: [app]
+    ports:
+      - "8080:80"
+      - target: 443
+    volumes:
+      - ./html:/usr/share/nginx/html:ro
+      - cache:/var/cache/nginx
+    environment:
+      MODE: ${RIDDLER_TEST_MODE:-prod}
+      DEBUG: false
+      PATH: /custom
+    deploy:
+      resources:
+        limits:
+          cpus: "0.5"
+          memory: 256M
+  app:
+    image: myapp
+    entrypoint: ["/app"]
+    network_mode: service:db
+    ipc: service:db
+    ulimits:
+      nofile:
+        soft: 1024
+        hard: 4096
+      nproc: 512
+  db:
+    image: postgres
+    command: ["postgres"]
+volumes:
+  cache:
+`
+
+func TestFromCompose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-compose-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(path, []byte(composeFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadCompose(path, "shop", logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrs, err := FromCompose(p, ComposeOptions{VolumesDir: "/bundles/volumes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctrs) != 3 {
+		t.Fatalf("expected 3 containers, got %d", len(ctrs))
+	}
+	app, db, web := ctrs[0], ctrs[1], ctrs[2]
+	if app.Name != "/app" || db.Name != "/db" || web.Name != "/web" {
+		t.Fatalf("expected the services sorted by name, got %s %s %s", app.Name, db.Name, web.Name)
+	}
+
+	if web.Path != "nginx" || !reflect.DeepEqual(web.Args, []string{"-g", "daemon off;"}) {
+		t.Fatalf("unexpected process %s %v", web.Path, web.Args)
+	}
+	if !reflect.DeepEqual(web.DependsOn, []string{"app"}) {
+		t.Fatalf("unexpected dependencies %v", web.DependsOn)
+	}
+	if env := web.Config.Env; !reflect.DeepEqual(env, []string{"PATH=/custom", "DEBUG=false", "MODE=prod"}) {
+		t.Fatalf("unexpected env %v", env)
+	}
+	if _, ok := web.Config.ExposedPorts["80/tcp"]; !ok {
+		t.Fatalf("expected port 80/tcp to be exposed, got %v", web.Config.ExposedPorts)
+	}
+	if _, ok := web.Config.ExposedPorts["443/tcp"]; !ok {
+		t.Fatalf("expected port 443/tcp to be exposed, got %v", web.Config.ExposedPorts)
+	}
+	if web.HostConfig.Memory != 256<<20 || web.HostConfig.NanoCPUs != 5e8 {
+		t.Fatalf("unexpected resources memory=%d cpus=%d", web.HostConfig.Memory, web.HostConfig.NanoCPUs)
+	}
+	mounts := []types.MountPoint{
+		{Type: "bind", Source: filepath.Join(p.Dir, "html"), Destination: "/usr/share/nginx/html", Mode: "ro"},
+		{Type: "volume", Name: "cache", Source: "/bundles/volumes/cache", Destination: "/var/cache/nginx", RW: true},
+	}
+	if !reflect.DeepEqual(web.Mounts, mounts) {
+		t.Fatalf("expected mounts %#v, got %#v", mounts, web.Mounts)
+	}
+
+	if app.HostConfig.NetworkMode != "container:db" || app.HostConfig.IpcMode != "container:db" {
+		t.Fatalf("expected app to share the namespaces of db, got network=%q ipc=%q", app.HostConfig.NetworkMode, app.HostConfig.IpcMode)
+	}
+	if len(app.HostConfig.Ulimits) != 2 || app.HostConfig.Ulimits[0].Name != "nofile" || app.HostConfig.Ulimits[0].Hard != 4096 || app.HostConfig.Ulimits[1].Soft != 512 {
+		t.Fatalf("unexpected ulimits %v", app.HostConfig.Ulimits)
+	}
+	if db.Config.Labels[ComposeProjectLabel] != "shop" {
+		t.Fatalf("expected the project label, got %v", db.Config.Labels)
+	}
+}
+
+func TestReadCompose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-compose-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := "# the defaults of the project\nRIDDLER_TEST_IMAGE=alpine\nRIDDLER_TEST_MODE=dev\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".env"), []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("RIDDLER_TEST_MODE", "prod: {x}")
+	defer os.Unsetenv("RIDDLER_TEST_MODE")
+
+	path := filepath.Join(dir, "docker-compose.yml")
+	data := `services:
+  web:
+    image: ${RIDDLER_TEST_IMAGE}
+    command: sh
+    environment:
+      MODE: ${RIDDLER_TEST_MODE}
+      PRICE: $$5
+    env_file: web.env
+    init: true
+    restart: always
+    x-owner: shop
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings bytes.Buffer
+	log := logrus.New()
+	log.Out = &warnings
+	p, err := ReadCompose(path, "shop", log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := p.Services["web"]
+	if web.Image != "alpine" {
+		t.Fatalf("expected the image of the .env file, got %q", web.Image)
+	}
+	// the environment wins over the .env file, and the values stay values
+	if env := web.Environment.env(); !reflect.DeepEqual(env, []string{"MODE=prod: {x}", "PRICE=$5"}) {
+		t.Fatalf("unexpected env %v", env)
+	}
+	for _, key := range []string{"env_file", "init"} {
+		if !strings.Contains(warnings.String(), "Ignoring "+key+" of service web") {
+			t.Fatalf("expected a warning about %s, got %q", key, warnings.String())
+		}
+	}
+	if strings.Contains(warnings.String(), "restart") || strings.Contains(warnings.String(), "x-owner") {
+		t.Fatalf("expected no warnings about restart and extension fields, got %q", warnings.String())
+	}
+
+	for _, image := range []string{"${RIDDLER_TEST_UNSET:?the image is needed}", "${RIDDLER_TEST_UNSET?no image}", "${RIDDLER_TEST_IMAGE:x}"} {
+		data := "services:\n  web:\n    image: \"" + image + "\"\n    command: sh\n"
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadCompose(path, "shop", log); err == nil {
+			t.Fatalf("expected an error for image %s", image)
+		}
+	}
+}
+
+func TestFromComposeVolumeNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-compose-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "docker-compose.yml")
+	data := "services:\n  web:\n    image: nginx\n    command: nginx\n    volumes:\n      - type: volume\n        source: ../../etc\n        target: /x\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadCompose(path, "shop", logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromCompose(p, ComposeOptions{VolumesDir: "/bundles/volumes"}); err == nil {
+		t.Fatal("expected an error for a volume name outside of the volumes directory")
+	}
+}
+
+func TestFromComposeContainers(t *testing.T) {
+	ctr := func(id, name, service, number, network string) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:   id,
+				Name: name,
+				HostConfig: &containertypes.HostConfig{
+					NetworkMode: containertypes.NetworkMode(network),
+				},
+			},
+			Config: &containertypes.Config{
+				Labels: map[string]string{
+					ComposeProjectLabel:   "shop",
+					composeServiceLabel:   service,
+					composeNumberLabel:    number,
+					composeDependsOnLabel: "",
+				},
+			},
+		}
+	}
+	dcs := []types.ContainerJSON{
+		ctr("aaa", "/shop_db_1", "db", "1", "shop_default"),
+		ctr("bbb", "/shop_app_1", "app", "1", "container:aaa"),
+		ctr("ccc", "/shop_app_2", "app", "2", "container:aaa"),
+	}
+	dcs[1].Config.Labels[composeDependsOnLabel] = "db:service_started:false"
+
+	ctrs, err := FromComposeContainers(dcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, c := range ctrs {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"/app_1", "/app_2", "/db"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+	if ctrs[0].HostConfig.NetworkMode != "container:db" || !reflect.DeepEqual(ctrs[0].DependsOn, []string{"db"}) {
+		t.Fatalf("expected app_1 to depend on db, got %q %v", ctrs[0].HostConfig.NetworkMode, ctrs[0].DependsOn)
+	}
+	if dcs[1].HostConfig.NetworkMode != "container:aaa" {
+		t.Fatal("the inspect data was changed")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := map[string][]string{
+		`nginx -g 'daemon off;'`:    {"nginx", "-g", "daemon off;"},
+		`sh -c "echo \"hi\" there"`: {"sh", "-c", `echo "hi" there`},
+		`  a\ b   c `:               {"a b", "c"},
+		`echo ''`:                   {"echo", ""},
+	}
+	for in, expected := range tests {
+		args, err := splitCommand(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("expected %q to be split into %q, got %q", in, expected, args)
+		}
+	}
+
+	if _, err := splitCommand(`echo 'oops`); err == nil {
+		t.Fatal("expected an error splitting an unterminated quote")
+	}
+}
@@ -0,0 +1,721 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// criKeepKeys are the fields whose keys are data, not field names, so they
+// are not turned into snake case.
+var criKeepKeys = map[string]bool{
+	"labels":       true,
+	"annotations":  true,
+	"sysctls":      true,
+	"runtime_spec": true,
+}
+
+// CRIContainer is a container read from the output of `crictl inspect`. The
+// parts the CRI supports that the docker inspect data cannot express are
+// kept separately and added to the spec by Apply.
+type CRIContainer struct {
+	types.ContainerJSON
+	// NamespacePaths are the paths of the namespaces of the pod sandbox to
+	// join.
+	NamespacePaths map[specs.LinuxNamespaceType]string
+}
+
+// CRIOptions are the settings for converting CRI containers that the output
+// of crictl does not hold.
+type CRIOptions struct {
+	// Sandbox is the pod sandbox of the containers, used for the settings of
+	// the pod and its namespaces. It can be nil.
+	Sandbox *CRISandbox
+	// SeccompDir is the only directory the localhost seccomp profiles are
+	// read from, if set.
+	SeccompDir string
+	// NoHostFiles refuses the localhost seccomp profiles, for input that
+	// cannot be trusted to name files of the host, unless SeccompDir is set.
+	NoHostFiles bool
+}
+
+// CRISandbox is a pod sandbox read from the output of `crictl inspectp`.
+type CRISandbox struct {
+	ID string
+	// Pid is the pid of the sandbox, its namespaces are the ones of the pod.
+	Pid    int
+	Config *CRIPodSandboxConfig
+}
+
+// CRIContainerConfig is the CRI ContainerConfig of a container.
+type CRIContainerConfig struct {
+	Metadata   criMetadata              `json:"metadata"`
+	Image      criImageSpec             `json:"image"`
+	Command    []string                 `json:"command"`
+	Args       []string                 `json:"args"`
+	WorkingDir string                   `json:"working_dir"`
+	Envs       []criKeyValue            `json:"envs"`
+	Mounts     []criMount               `json:"mounts"`
+	Devices    []criDevice              `json:"devices"`
+	Labels     map[string]string        `json:"labels"`
+	Stdin      bool                     `json:"stdin"`
+	StdinOnce  bool                     `json:"stdin_once"`
+	Tty        bool                     `json:"tty"`
+	Linux      *CRILinuxContainerConfig `json:"linux"`
+}
+
+// CRILinuxContainerConfig is the linux part of a CRI ContainerConfig.
+type CRILinuxContainerConfig struct {
+	Resources       *criLinuxContainerResource `json:"resources"`
+	SecurityContext *CRISecurityContext        `json:"security_context"`
+}
+
+// CRISecurityContext is the CRI LinuxContainerSecurityContext of a
+// container.
+type CRISecurityContext struct {
+	Capabilities *struct {
+		AddCapabilities  []string `json:"add_capabilities"`
+		DropCapabilities []string `json:"drop_capabilities"`
+	} `json:"capabilities"`
+	Privileged         bool                 `json:"privileged"`
+	NamespaceOptions   *criNamespaceOptions `json:"namespace_options"`
+	SelinuxOptions     *criSELinuxOption    `json:"selinux_options"`
+	RunAsUser          *criInt64Value       `json:"run_as_user"`
+	RunAsGroup         *criInt64Value       `json:"run_as_group"`
+	RunAsUsername      string               `json:"run_as_username"`
+	ReadonlyRootfs     bool                 `json:"readonly_rootfs"`
+	SupplementalGroups []int64              `json:"supplemental_groups"`
+	ApparmorProfile    string               `json:"apparmor_profile"`
+	SeccompProfilePath string               `json:"seccomp_profile_path"`
+	NoNewPrivs         bool                 `json:"no_new_privs"`
+	MaskedPaths        []string             `json:"masked_paths"`
+	ReadonlyPaths      []string             `json:"readonly_paths"`
+	Seccomp            *criSecurityProfile  `json:"seccomp"`
+	Apparmor           *criSecurityProfile  `json:"apparmor"`
+}
+
+// CRIPodSandboxConfig is the CRI PodSandboxConfig of a pod sandbox.
+type CRIPodSandboxConfig struct {
+	Metadata  criMetadata `json:"metadata"`
+	Hostname  string      `json:"hostname"`
+	DNSConfig *struct {
+		Servers  []string `json:"servers"`
+		Searches []string `json:"searches"`
+		Options  []string `json:"options"`
+	} `json:"dns_config"`
+	Labels map[string]string `json:"labels"`
+	Linux  *struct {
+		CgroupParent    string            `json:"cgroup_parent"`
+		Sysctls         map[string]string `json:"sysctls"`
+		SecurityContext *struct {
+			NamespaceOptions *criNamespaceOptions `json:"namespace_options"`
+		} `json:"security_context"`
+	} `json:"linux"`
+}
+
+type criMetadata struct {
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	Namespace string `json:"namespace"`
+	Attempt   uint32 `json:"attempt"`
+}
+
+type criImageSpec struct {
+	Image string `json:"image"`
+}
+
+type criKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type criMount struct {
+	ContainerPath string         `json:"container_path"`
+	HostPath      string         `json:"host_path"`
+	Readonly      bool           `json:"readonly"`
+	Propagation   criPropagation `json:"propagation"`
+}
+
+type criDevice struct {
+	ContainerPath string `json:"container_path"`
+	HostPath      string `json:"host_path"`
+	Permissions   string `json:"permissions"`
+}
+
+type criLinuxContainerResource struct {
+	CPUPeriod          int64  `json:"cpu_period"`
+	CPUQuota           int64  `json:"cpu_quota"`
+	CPUShares          int64  `json:"cpu_shares"`
+	MemoryLimitInBytes int64  `json:"memory_limit_in_bytes"`
+	OomScoreAdj        int64  `json:"oom_score_adj"`
+	CpusetCpus         string `json:"cpuset_cpus"`
+	CpusetMems         string `json:"cpuset_mems"`
+}
+
+type criNamespaceOptions struct {
+	Network  criNamespaceMode `json:"network"`
+	Pid      criNamespaceMode `json:"pid"`
+	Ipc      criNamespaceMode `json:"ipc"`
+	TargetID string           `json:"target_id"`
+}
+
+type criSELinuxOption struct {
+	User  string `json:"user"`
+	Role  string `json:"role"`
+	Type  string `json:"type"`
+	Level string `json:"level"`
+}
+
+type criInt64Value struct {
+	Value int64 `json:"value"`
+}
+
+type criSecurityProfile struct {
+	ProfileType  criProfileType `json:"profile_type"`
+	LocalhostRef string         `json:"localhost_ref"`
+}
+
+// the CRI enums, which are printed as numbers or as their names
+type (
+	criNamespaceMode int
+	criPropagation   int
+	criProfileType   int
+)
+
+const (
+	criNamespacePod criNamespaceMode = iota
+	criNamespaceContainer
+	criNamespaceNode
+	criNamespaceTarget
+)
+
+const (
+	criPropagationPrivate criPropagation = iota
+	criPropagationHostToContainer
+	criPropagationBidirectional
+)
+
+const (
+	criProfileRuntimeDefault criProfileType = iota
+	criProfileUnconfined
+	criProfileLocalhost
+)
+
+// IsCRI reports whether the inspect output in data was printed by `crictl
+// inspect`.
+func IsCRI(data []byte) bool {
+	entries, err := readEntries(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entries[0], &fields); err != nil {
+		return false
+	}
+	_, status := fields["status"]
+	_, info := fields["info"]
+	return status && info
+}
+
+// DecodeCRISandbox reads the output of `crictl inspectp` from r.
+func DecodeCRISandbox(r io.Reader) (*CRISandbox, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading sandbox data failed: %v", err)
+	}
+	data, err = criSnakeCase(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding sandbox failed: %v", err)
+	}
+
+	var s struct {
+		Status struct {
+			ID string `json:"id"`
+		} `json:"status"`
+		Info struct {
+			Pid    int                  `json:"pid"`
+			Config *CRIPodSandboxConfig `json:"config"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("decoding sandbox failed: %v", err)
+	}
+	if s.Info.Config == nil {
+		return nil, errors.New("sandbox has no config, is it the output of crictl inspectp?")
+	}
+	return &CRISandbox{
+		ID:     s.Status.ID,
+		Pid:    s.Info.Pid,
+		Config: s.Info.Config,
+	}, nil
+}
+
+// DecodeCRI reads the output of `crictl inspect` from r and turns the CRI
+// config of the containers into the docker inspect data, so it can be
+// converted the same way. The warnings about the input go to log.
+func DecodeCRI(r io.Reader, opts CRIOptions, log logrus.FieldLogger) ([]CRIContainer, error) {
+	sandbox := opts.Sandbox
+	entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctrs []CRIContainer
+	for i, entry := range entries {
+		data, err := criSnakeCase(entry)
+		if err != nil {
+			return nil, fmt.Errorf("decoding crictl inspect entry %d failed: %v", i, err)
+		}
+
+		var c struct {
+			Status struct {
+				ID string `json:"id"`
+			} `json:"status"`
+			Info struct {
+				SandboxID   string              `json:"sandbox_id"`
+				Config      *CRIContainerConfig `json:"config"`
+				RuntimeSpec *struct {
+					Process *struct {
+						Args []string `json:"args"`
+						Env  []string `json:"env"`
+					} `json:"process"`
+				} `json:"runtime_spec"`
+			} `json:"info"`
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("decoding crictl inspect entry %d failed: %v", i, err)
+		}
+		if c.Info.Config == nil {
+			// CRI-O only prints the runtime spec
+			return nil, fmt.Errorf("crictl inspect entry %d has no container config, the runtime prints only the spec it created", i)
+		}
+		if sandbox != nil && sandbox.ID != "" && c.Info.SandboxID != "" && sandbox.ID != c.Info.SandboxID {
+			return nil, fmt.Errorf("container %s is not part of sandbox %s", c.Status.ID, sandbox.ID)
+		}
+
+		// the process the runtime started has the entrypoint and the env
+		// of the image, which are not in the config
+		var process, env []string
+		if c.Info.RuntimeSpec != nil && c.Info.RuntimeSpec.Process != nil {
+			process = c.Info.RuntimeSpec.Process.Args
+			env = c.Info.RuntimeSpec.Process.Env
+		}
+
+		ctr, err := c.Info.Config.convert(c.Status.ID, process, env, opts, log)
+		if err != nil {
+			return nil, fmt.Errorf("converting crictl inspect entry %d failed: %v", i, err)
+		}
+		ctrs = append(ctrs, ctr)
+	}
+
+	return ctrs, nil
+}
+
+// convert maps the CRI config onto the docker inspect data. The process and
+// env are the ones the runtime started the container with, if known.
+func (cc *CRIContainerConfig) convert(id string, process, env []string, opts CRIOptions, log logrus.FieldLogger) (CRIContainer, error) {
+	sandbox := opts.Sandbox
+	// without a command the args go after the entrypoint of the image, only
+	// the process of the runtime has that
+	if len(cc.Command) > 0 || (len(cc.Args) > 0 && len(process) == 0) {
+		process = append(append([]string{}, cc.Command...), cc.Args...)
+	}
+	if len(process) == 0 {
+		return CRIContainer{}, errors.New("no command for the container")
+	}
+
+	name := cc.Metadata.Name
+	if name == "" {
+		name = id
+	}
+	if id == "" {
+		id = name
+	}
+
+	config := &containertypes.Config{
+		Tty:        cc.Tty,
+		OpenStdin:  cc.Stdin,
+		StdinOnce:  cc.StdinOnce,
+		Image:      cc.Image.Image,
+		WorkingDir: cc.WorkingDir,
+		Labels:     cc.Labels,
+	}
+	var envs []string
+	for _, e := range cc.Envs {
+		envs = append(envs, e.Key+"="+e.Value)
+	}
+	// the runtime merged the env of the image with the config, without it
+	// keep a usable PATH
+	if len(env) == 0 {
+		env = parse.DefaultTerminalEnv
+	}
+	config.Env = mergeEnv(env, envs)
+
+	hc := &containertypes.HostConfig{
+		NetworkMode: "default",
+		Sysctls:     map[string]string{},
+	}
+	ctr := CRIContainer{
+		ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         id,
+				Path:       process[0],
+				Args:       process[1:],
+				State:      &types.ContainerState{Status: "created"},
+				Image:      cc.Image.Image,
+				Name:       "/" + name,
+				HostConfig: hc,
+			},
+			Mounts: []types.MountPoint{},
+			Config: config,
+		},
+		NamespacePaths: map[specs.LinuxNamespaceType]string{},
+	}
+
+	for _, m := range cc.Mounts {
+		mp := types.MountPoint{
+			Type:        mounttypes.TypeBind,
+			Source:      m.HostPath,
+			Destination: m.ContainerPath,
+			RW:          !m.Readonly,
+			Propagation: m.Propagation.propagation(),
+		}
+		if m.Readonly {
+			mp.Mode = "ro"
+		}
+		ctr.Mounts = append(ctr.Mounts, mp)
+	}
+	for _, d := range cc.Devices {
+		device := containertypes.DeviceMapping{
+			PathOnHost:        d.HostPath,
+			PathInContainer:   d.ContainerPath,
+			CgroupPermissions: d.Permissions,
+		}
+		if device.CgroupPermissions == "" {
+			device.CgroupPermissions = "rwm"
+		}
+		hc.Devices = append(hc.Devices, device)
+	}
+
+	// the settings of the pod
+	ns := &criNamespaceOptions{Pid: criNamespaceContainer}
+	if sandbox != nil && sandbox.Config != nil {
+		sc := sandbox.Config
+		config.Hostname = sc.Hostname
+		if sc.DNSConfig != nil {
+			hc.DNS = sc.DNSConfig.Servers
+			hc.DNSSearch = sc.DNSConfig.Searches
+			hc.DNSOptions = sc.DNSConfig.Options
+		}
+		if sc.Linux != nil {
+			hc.CgroupParent = sc.Linux.CgroupParent
+			for k, v := range sc.Linux.Sysctls {
+				hc.Sysctls[k] = v
+			}
+			if sc.Linux.SecurityContext != nil && sc.Linux.SecurityContext.NamespaceOptions != nil {
+				ns = sc.Linux.SecurityContext.NamespaceOptions
+			}
+		}
+	}
+
+	if cc.Linux != nil {
+		if r := cc.Linux.Resources; r != nil {
+			hc.CPUPeriod = r.CPUPeriod
+			hc.CPUQuota = r.CPUQuota
+			hc.CPUShares = r.CPUShares
+			hc.Memory = r.MemoryLimitInBytes
+			hc.OomScoreAdj = int(r.OomScoreAdj)
+			hc.CpusetCpus = r.CpusetCpus
+			hc.CpusetMems = r.CpusetMems
+		}
+		if sc := cc.Linux.SecurityContext; sc != nil {
+			if err := sc.apply(config, hc, opts); err != nil {
+				return CRIContainer{}, err
+			}
+			if sc.NamespaceOptions != nil {
+				ns = sc.NamespaceOptions
+			}
+		}
+	}
+
+	ctr.namespaces(ns, sandbox, log)
+	return ctr, nil
+}
+
+// apply sets the security context of the container.
+func (sc *CRISecurityContext) apply(config *containertypes.Config, hc *containertypes.HostConfig, opts CRIOptions) error {
+	hc.Privileged = sc.Privileged
+	hc.ReadonlyRootfs = sc.ReadonlyRootfs
+	hc.MaskedPaths = sc.MaskedPaths
+	hc.ReadonlyPaths = sc.ReadonlyPaths
+	if sc.Capabilities != nil {
+		hc.CapAdd = serviceCapabilities(sc.Capabilities.AddCapabilities)
+		hc.CapDrop = serviceCapabilities(sc.Capabilities.DropCapabilities)
+	}
+	for _, g := range sc.SupplementalGroups {
+		hc.GroupAdd = append(hc.GroupAdd, strconv.FormatInt(g, 10))
+	}
+
+	switch {
+	case sc.RunAsUsername != "":
+		config.User = sc.RunAsUsername
+	case sc.RunAsUser != nil:
+		config.User = strconv.FormatInt(sc.RunAsUser.Value, 10)
+	}
+	if sc.RunAsGroup != nil && config.User != "" {
+		config.User += ":" + strconv.FormatInt(sc.RunAsGroup.Value, 10)
+	}
+
+	if s := sc.SelinuxOptions; s != nil {
+		hc.SecurityOpt = append(hc.SecurityOpt, selinuxOpts(&swarm.SELinuxContext{
+			User:  s.User,
+			Role:  s.Role,
+			Type:  s.Type,
+			Level: s.Level,
+		})...)
+	}
+
+	// the CRI does not set no new privileges unless asked to
+	hc.SecurityOpt = append(hc.SecurityOpt, "no-new-privileges="+strconv.FormatBool(sc.NoNewPrivs))
+
+	apparmor := sc.ApparmorProfile
+	if sc.Apparmor != nil {
+		apparmor = sc.Apparmor.path()
+	}
+	switch {
+	case apparmor == "", apparmor == "runtime/default":
+	case apparmor == "unconfined":
+		hc.SecurityOpt = append(hc.SecurityOpt, "apparmor=unconfined")
+	case strings.HasPrefix(apparmor, "localhost/"):
+		hc.SecurityOpt = append(hc.SecurityOpt, "apparmor="+strings.TrimPrefix(apparmor, "localhost/"))
+	default:
+		return fmt.Errorf("unknown apparmor profile %q", apparmor)
+	}
+
+	// without a profile the container is unconfined, like with the runtimes
+	seccomp := sc.SeccompProfilePath
+	if sc.Seccomp != nil {
+		seccomp = sc.Seccomp.path()
+	}
+	switch {
+	case seccomp == "", seccomp == "unconfined":
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp=unconfined")
+	case seccomp == "runtime/default", seccomp == "docker/default":
+	case strings.HasPrefix(seccomp, "localhost/"):
+		// the kubelet passes the absolute path of the profile
+		profile, err := opts.readSeccompProfile(strings.TrimPrefix(seccomp, "localhost/"))
+		if err != nil {
+			return err
+		}
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp="+string(profile))
+	default:
+		return fmt.Errorf("unknown seccomp profile %q", seccomp)
+	}
+	return nil
+}
+
+// readSeccompProfile reads the localhost seccomp profile at path, if the
+// options allow reading it.
+func (opts CRIOptions) readSeccompProfile(path string) ([]byte, error) {
+	if opts.SeccompDir == "" && opts.NoHostFiles {
+		return nil, fmt.Errorf("localhost seccomp profile %s is not allowed, the profiles of the host cannot be read", path)
+	}
+	if opts.SeccompDir != "" {
+		dir, err := filepath.EvalSymlinks(opts.SeccompDir)
+		if err != nil {
+			return nil, fmt.Errorf("resolving seccomp profile directory failed: %v", err)
+		}
+		// do not tell what is outside of the directory
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil || !filepath.IsAbs(resolved) || !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("localhost seccomp profile %s is not allowed, it is not in %s", path, opts.SeccompDir)
+		}
+		path = resolved
+	}
+	profile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seccomp profile failed: %v", err)
+	}
+	return profile, nil
+}
+
+// namespaces sets the namespaces of the container. The ones shared with the
+// pod are the namespaces of the sandbox.
+func (c *CRIContainer) namespaces(ns *criNamespaceOptions, sandbox *CRISandbox, log logrus.FieldLogger) {
+	hc := c.HostConfig
+	modes := []struct {
+		types []specs.LinuxNamespaceType
+		mode  criNamespaceMode
+		host  func()
+	}{
+		// the containers of a pod share the hostname along with the network
+		{[]specs.LinuxNamespaceType{specs.NetworkNamespace, specs.UTSNamespace}, ns.Network, func() {
+			hc.NetworkMode = "host"
+			hc.UTSMode = "host"
+		}},
+		{[]specs.LinuxNamespaceType{specs.IPCNamespace}, ns.Ipc, func() { hc.IpcMode = "host" }},
+		{[]specs.LinuxNamespaceType{specs.PIDNamespace}, ns.Pid, func() { hc.PidMode = "host" }},
+	}
+
+	for _, m := range modes {
+		switch m.mode {
+		case criNamespaceNode:
+			m.host()
+		case criNamespacePod:
+			if sandbox == nil || sandbox.Pid <= 0 {
+				log.Warnf("The pid of the sandbox of %s is not known, it gets %s namespaces of its own", c.Name, m.types[0])
+				continue
+			}
+			for _, t := range m.types {
+				c.NamespacePaths[t] = fmt.Sprintf("/proc/%d/ns/%s", sandbox.Pid, procNamespace(t))
+			}
+		case criNamespaceTarget:
+			hc.PidMode = containertypes.PidMode("container:" + ns.TargetID)
+		}
+	}
+}
+
+// Apply adds the parts of the CRI container that parse.Config does not know
+// about to the spec.
+func (c CRIContainer) Apply(config *specs.Spec) {
+	// the CRI does not support user namespaces
+	parse.UserNamespace(config, nil, nil)
+	for t, path := range c.NamespacePaths {
+		parse.NamespacePath(config, t, path)
+	}
+}
+
+// procNamespace returns the name of the namespace in /proc/<pid>/ns.
+func procNamespace(t specs.LinuxNamespaceType) string {
+	switch t {
+	case specs.NetworkNamespace:
+		return "net"
+	case specs.MountNamespace:
+		return "mnt"
+	}
+	return string(t)
+}
+
+func (p criPropagation) propagation() mounttypes.Propagation {
+	switch p {
+	case criPropagationHostToContainer:
+		return mounttypes.PropagationRSlave
+	case criPropagationBidirectional:
+		return mounttypes.PropagationRShared
+	}
+	return ""
+}
+
+// path returns the profile in the form of the old profile path fields.
+func (p *criSecurityProfile) path() string {
+	switch p.ProfileType {
+	case criProfileUnconfined:
+		return "unconfined"
+	case criProfileLocalhost:
+		return "localhost/" + p.LocalhostRef
+	}
+	return "runtime/default"
+}
+
+func (m *criNamespaceMode) UnmarshalJSON(b []byte) error {
+	n, err := criEnum(b, "POD", "CONTAINER", "NODE", "TARGET")
+	*m = criNamespaceMode(n)
+	return err
+}
+
+func (p *criPropagation) UnmarshalJSON(b []byte) error {
+	n, err := criEnum(b, "PROPAGATION_PRIVATE", "PROPAGATION_HOST_TO_CONTAINER", "PROPAGATION_BIDIRECTIONAL")
+	*p = criPropagation(n)
+	return err
+}
+
+func (t *criProfileType) UnmarshalJSON(b []byte) error {
+	n, err := criEnum(b, "RuntimeDefault", "Unconfined", "Localhost")
+	*t = criProfileType(n)
+	return err
+}
+
+// criEnum decodes an enum printed as its number or its name.
+func criEnum(b []byte, names ...string) (int, error) {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		return n, nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return 0, fmt.Errorf("decoding enum %s failed: %v", b, err)
+	}
+	for i, v := range names {
+		if v == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// criSnakeCase turns the keys of the JSON objects in data into snake case.
+// Depending on the runtime, crictl prints the CRI messages with the names of
+// the protobuf fields, ex. container_path, or in camel case, ex.
+// containerPath.
+func criSnakeCase(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(snakeCaseKeys(v))
+}
+
+func snakeCaseKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, value := range v {
+			k = snakeCase(k)
+			if !criKeepKeys[k] {
+				value = snakeCaseKeys(value)
+			}
+			m[k] = value
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = snakeCaseKeys(v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// snakeCase turns a camel case name into snake case, ex. sandboxID becomes
+// sandbox_id.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package inspect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const criInspect = `{
+  "status": {
+    "id": "5f2c0a1b9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b",
+    "metadata": {"attempt": 0, "name": "web"},
+    "state": "CONTAINER_RUNNING",
+    "image": {"image": "docker.io/library/nginx:latest"},
+    "labels": {"io.kubernetes.pod.name": "web-0"}
+  },
+  "info": {
+    "sandboxID": "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b",
+    "pid": 4321,
+    "config": {
+      "metadata": {"name": "web"},
+      "image": {"image": "sha256:605c77e624ddb75e6110f997c58876baa13f8754486b461117934b24a9dc3a85"},
+      "command": ["nginx"],
+      "args": ["-g", "daemon off;"],
+      "workingDir": "/srv",
+      "envs": [{"key": "PATH", "value": "/usr/sbin:/usr/bin"}, {"key": "APP", "value": "web"}],
+      "mounts": [
+        {"containerPath": "/data", "hostPath": "/var/lib/web", "propagation": "PROPAGATION_HOST_TO_CONTAINER"},
+        {"containerPath": "/etc/web", "hostPath": "/etc/web", "readonly": true}
+      ],
+      "devices": [{"containerPath": "/dev/fuse", "hostPath": "/dev/fuse"}],
+      "labels": {"io.kubernetes.container.name": "web"},
+      "linux": {
+        "resources": {"cpuPeriod": 100000, "cpuQuota": 50000, "cpuShares": 512, "memoryLimitInBytes": 134217728, "oomScoreAdj": 1000},
+        "securityContext": {
+          "capabilities": {"addCapabilities": ["CAP_NET_ADMIN"], "dropCapabilities": ["MKNOD"]},
+          "namespaceOptions": {"network": 0, "pid": "CONTAINER", "ipc": 0},
+          "runAsUser": {"value": 1000},
+          "runAsGroup": {"value": 1000},
+          "supplementalGroups": [2000],
+          "readonlyRootfs": true,
+          "noNewPrivs": true,
+          "maskedPaths": ["/proc/kcore"],
+          "readonlyPaths": ["/proc/sys"],
+          "seccomp": {"profileType": "RuntimeDefault"},
+          "apparmor": {"profileType": 1}
+        }
+      }
+    }
+  }
+}`
+
+const criInspectp = `{
+  "status": {
+    "id": "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b",
+    "metadata": {"name": "web-0", "namespace": "default"}
+  },
+  "info": {
+    "pid": 1234,
+    "config": {
+      "metadata": {"name": "web-0", "namespace": "default"},
+      "hostname": "web-0",
+      "dnsConfig": {"servers": ["10.96.0.10"], "searches": ["default.svc.cluster.local"], "options": ["ndots:5"]},
+      "linux": {
+        "cgroupParent": "/kubepods/burstable/pod1234",
+        "sysctls": {"net.ipv4.ip_unprivileged_port_start": "0"},
+        "securityContext": {"namespaceOptions": {"network": "POD", "pid": "CONTAINER", "ipc": "POD"}}
+      }
+    }
+  }
+}`
+
+func TestIsCRI(t *testing.T) {
+	if !IsCRI([]byte(criInspect)) {
+		t.Fatal("expected crictl inspect output to be detected")
+	}
+	if IsCRI([]byte(podmanInspect)) {
+		t.Fatal("expected podman inspect output not to be detected as cri")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, expected := range map[string]string{
+		"sandboxID":          "sandbox_id",
+		"containerPath":      "container_path",
+		"memoryLimitInBytes": "memory_limit_in_bytes",
+		"host_path":          "host_path",
+		"pid":                "pid",
+	} {
+		if got := snakeCase(in); got != expected {
+			t.Fatalf("expected %s to become %s, got %s", in, expected, got)
+		}
+	}
+}
+
+func TestDecodeCRI(t *testing.T) {
+	sandbox, err := DecodeCRISandbox(strings.NewReader(criInspectp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sandbox.Pid != 1234 {
+		t.Fatalf("expected sandbox pid 1234, got %d", sandbox.Pid)
+	}
+
+	ctrs, err := DecodeCRI(strings.NewReader(criInspect), CRIOptions{Sandbox: sandbox}, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctrs) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(ctrs))
+	}
+	ctr := ctrs[0]
+
+	if ctr.Name != "/web" || ctr.Path != "nginx" || !reflect.DeepEqual(ctr.Args, []string{"-g", "daemon off;"}) {
+		t.Fatalf("expected /web running nginx -g 'daemon off;', got %s running %s %v", ctr.Name, ctr.Path, ctr.Args)
+	}
+	if ctr.Config.User != "1000:1000" {
+		t.Fatalf("expected user 1000:1000, got %s", ctr.Config.User)
+	}
+	if !reflect.DeepEqual(ctr.Config.Env, []string{"PATH=/usr/sbin:/usr/bin", "APP=web"}) {
+		t.Fatalf("expected the env of the config, got %v", ctr.Config.Env)
+	}
+	if ctr.Config.Hostname != "web-0" || ctr.Config.WorkingDir != "/srv" {
+		t.Fatalf("expected hostname web-0 in /srv, got %s in %s", ctr.Config.Hostname, ctr.Config.WorkingDir)
+	}
+
+	if len(ctr.Mounts) != 2 {
+		t.Fatalf("expected 2 mounts, got %v", ctr.Mounts)
+	}
+	if ctr.Mounts[0].Propagation != "rslave" || !ctr.Mounts[0].RW {
+		t.Fatalf("expected a rw rslave mount, got %v", ctr.Mounts[0])
+	}
+	if ctr.Mounts[1].RW || ctr.Mounts[1].Mode != "ro" {
+		t.Fatalf("expected a ro mount, got %v", ctr.Mounts[1])
+	}
+
+	hc := ctr.HostConfig
+	if len(hc.Devices) != 1 || hc.Devices[0].CgroupPermissions != "rwm" {
+		t.Fatalf("expected /dev/fuse with rwm, got %v", hc.Devices)
+	}
+	if !reflect.DeepEqual([]string(hc.CapAdd), []string{"NET_ADMIN"}) || !reflect.DeepEqual([]string(hc.CapDrop), []string{"MKNOD"}) {
+		t.Fatalf("expected to add NET_ADMIN and drop MKNOD, got %v and %v", hc.CapAdd, hc.CapDrop)
+	}
+	if !hc.ReadonlyRootfs || !reflect.DeepEqual(hc.GroupAdd, []string{"2000"}) {
+		t.Fatalf("expected a read only rootfs and group 2000, got %v and %v", hc.ReadonlyRootfs, hc.GroupAdd)
+	}
+	if !reflect.DeepEqual(hc.MaskedPaths, []string{"/proc/kcore"}) || !reflect.DeepEqual(hc.ReadonlyPaths, []string{"/proc/sys"}) {
+		t.Fatalf("expected the masked and read only paths, got %v and %v", hc.MaskedPaths, hc.ReadonlyPaths)
+	}
+	if !reflect.DeepEqual(hc.SecurityOpt, []string{"no-new-privileges=true", "apparmor=unconfined"}) {
+		t.Fatalf("expected no new privileges and no apparmor, got %v", hc.SecurityOpt)
+	}
+	if hc.Memory != 134217728 || hc.CPUQuota != 50000 || hc.CPUShares != 512 || hc.OomScoreAdj != 1000 {
+		t.Fatalf("expected the resources of the config, got %v", hc.Resources)
+	}
+	if hc.CgroupParent != "/kubepods/burstable/pod1234" || hc.Sysctls["net.ipv4.ip_unprivileged_port_start"] != "0" {
+		t.Fatalf("expected the cgroup parent and sysctls of the sandbox, got %s and %v", hc.CgroupParent, hc.Sysctls)
+	}
+	if !reflect.DeepEqual(hc.DNS, []string{"10.96.0.10"}) || !reflect.DeepEqual(hc.DNSOptions, []string{"ndots:5"}) {
+		t.Fatalf("expected the dns config of the sandbox, got %v and %v", hc.DNS, hc.DNSOptions)
+	}
+
+	expected := map[specs.LinuxNamespaceType]string{
+		specs.NetworkNamespace: "/proc/1234/ns/net",
+		specs.UTSNamespace:     "/proc/1234/ns/uts",
+		specs.IPCNamespace:     "/proc/1234/ns/ipc",
+	}
+	if !reflect.DeepEqual(ctr.NamespacePaths, expected) {
+		t.Fatalf("expected namespace paths %v, got %v", expected, ctr.NamespacePaths)
+	}
+
+	config := &specs.Spec{Linux: &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{
+			{Type: specs.IPCNamespace},
+			{Type: specs.UTSNamespace},
+			{Type: specs.MountNamespace},
+			{Type: specs.NetworkNamespace},
+			{Type: specs.PIDNamespace},
+			{Type: specs.UserNamespace},
+		},
+		UIDMappings: []specs.LinuxIDMapping{{HostID: 100000, Size: 65536}},
+	}}
+	ctr.Apply(config)
+	if len(config.Linux.UIDMappings) != 0 || parse.HasNamespace(config, specs.UserNamespace) {
+		t.Fatalf("expected no user namespace, got %v", config.Linux)
+	}
+	for _, ns := range config.Linux.Namespaces {
+		if ns.Path != expected[ns.Type] {
+			t.Fatalf("expected %s namespace path %q, got %q", ns.Type, expected[ns.Type], ns.Path)
+		}
+	}
+}
+
+func TestDecodeCRINoConfig(t *testing.T) {
+	_, err := DecodeCRI(strings.NewReader(`{"status": {"id": "abc"}, "info": {"runtimeSpec": {}}}`), CRIOptions{}, logrus.StandardLogger())
+	if err == nil {
+		t.Fatal("expected an error for output without a container config")
+	}
+}
+
+func TestDecodeCRIArgsOnly(t *testing.T) {
+	const inspect = `{
+  "status": {"id": "abc"},
+  "info": {
+    "config": {
+      "metadata": {"name": "web"},
+      "args": ["-g", "daemon off;"],
+      "envs": [{"key": "PATH", "value": "/custom"}]
+    },
+    "runtimeSpec": {
+      "process": {
+        "args": ["/docker-entrypoint.sh", "-g", "daemon off;"],
+        "env": ["PATH=/usr/sbin:/usr/bin", "NGINX_VERSION=1.25"]
+      }
+    }
+  }
+}`
+
+	ctrs, err := DecodeCRI(strings.NewReader(inspect), CRIOptions{}, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctr := ctrs[0]
+	if ctr.Path != "/docker-entrypoint.sh" || !reflect.DeepEqual(ctr.Args, []string{"-g", "daemon off;"}) {
+		t.Fatalf("expected the entrypoint of the runtime spec, got %s %v", ctr.Path, ctr.Args)
+	}
+	if expected := []string{"PATH=/custom", "NGINX_VERSION=1.25"}; !reflect.DeepEqual(ctr.Config.Env, expected) {
+		t.Fatalf("expected env %v, got %v", expected, ctr.Config.Env)
+	}
+}
+
+func TestDecodeCRISeccompHostFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "profile.json")
+	if err := ioutil.WriteFile(profile, []byte(`{"defaultAction": "SCMP_ACT_ALLOW"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(path string, opts CRIOptions) error {
+		inspect := `{
+  "status": {"id": "abc"},
+  "info": {
+    "config": {
+      "metadata": {"name": "web"},
+      "command": ["sh"],
+      "linux": {"security_context": {"seccomp_profile_path": "localhost/` + path + `"}}
+    },
+    "runtimeSpec": {}
+  }
+}`
+		_, err := DecodeCRI(strings.NewReader(inspect), opts, logrus.StandardLogger())
+		return err
+	}
+
+	tests := []struct {
+		path string
+		opts CRIOptions
+		err  bool
+	}{
+		{profile, CRIOptions{}, false},
+		{profile, CRIOptions{NoHostFiles: true}, true},
+		{profile, CRIOptions{NoHostFiles: true, SeccompDir: dir}, false},
+		{filepath.Join(dir, "..", filepath.Base(dir), "profile.json"), CRIOptions{SeccompDir: dir}, false},
+		{"/etc/passwd", CRIOptions{NoHostFiles: true, SeccompDir: dir}, true},
+		{filepath.Join(dir, "..", "..", "etc", "passwd"), CRIOptions{SeccompDir: dir}, true},
+	}
+	for _, test := range tests {
+		err := decode(test.path, test.opts)
+		if test.err && err == nil {
+			t.Fatalf("expected an error reading %s with %#v", test.path, test.opts)
+		}
+		if !test.err && err != nil {
+			t.Fatalf("reading %s with %#v failed: %v", test.path, test.opts, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package inspect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDockerRoot is the default root directory of the docker daemon.
+	DefaultDockerRoot = "/var/lib/docker"
+
+	configFileName     = "config.v2.json"
+	hostConfigFileName = "hostconfig.json"
+)
+
+// diskContainer holds the fields of the config.v2.json file the docker
+// daemon saves for every container that we need to rebuild the inspect data.
+type diskContainer struct {
+	State struct {
+		Running    bool
+		Paused     bool
+		Restarting bool
+		OOMKilled  bool
+		Dead       bool
+		Pid        int
+		ExitCode   int
+		Error      string
+		StartedAt  time.Time
+		FinishedAt time.Time
+	}
+	ID              string
+	Created         time.Time
+	Path            string
+	Args            []string
+	Config          *containertypes.Config
+	Image           string
+	LogPath         string
+	Name            string
+	Driver          string
+	MountLabel      string
+	ProcessLabel    string
+	RestartCount    int
+	MountPoints     map[string]*diskMountPoint
+	AppArmorProfile string
+	HostnamePath    string
+	HostsPath       string
+	ResolvConfPath  string
+}
+
+// diskMountPoint is a mount point as saved in config.v2.json.
+type diskMountPoint struct {
+	Source      string
+	Destination string
+	RW          bool
+	Name        string
+	Driver      string
+	Type        mounttypes.Type
+	// Mode was originally saved as Relabel.
+	Mode        string `json:"Relabel"`
+	Propagation mounttypes.Propagation
+}
+
+// statusString mirrors how the docker daemon turns the saved state into
+// the status string of the inspect output.
+func (c *diskContainer) statusString() string {
+	if c.State.Running {
+		if c.State.Paused {
+			return "paused"
+		}
+		if c.State.Restarting {
+			return "restarting"
+		}
+		return "running"
+	}
+	if c.State.Dead {
+		return "dead"
+	}
+	if c.State.StartedAt.IsZero() {
+		return "created"
+	}
+	return "exited"
+}
+
+// FromDisk rebuilds the docker inspect data for a container from the state
+// the docker daemon saved in root (usually /var/lib/docker). This works even
+// when the daemon is not running. The container can be referenced by its
+// full ID, a unique ID prefix, or its name. The fields of the host config it
+// does not know are warned about to log.
+func FromDisk(root, nameOrID string, log logrus.FieldLogger) (Container, error) {
+	if root == "" {
+		root = DefaultDockerRoot
+	}
+
+	id, err := resolveDiskContainer(root, nameOrID)
+	if err != nil {
+		return Container{}, err
+	}
+	dir := filepath.Join(root, "containers", id)
+
+	var c diskContainer
+	if err := readJSONFile(filepath.Join(dir, configFileName), &c); err != nil {
+		return Container{}, err
+	}
+	if c.Config == nil {
+		return Container{}, fmt.Errorf("%s for container %s has no config", configFileName, id)
+	}
+
+	// the host config goes through the same layer as the inspect output to
+	// keep the fields of newer daemons
+	path := filepath.Join(dir, hostConfigFileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Container{}, fmt.Errorf("reading %s failed: %v", path, err)
+	}
+	hostConfig, hostConfigExtra, err := decodeHostConfig(data, c.Name, log)
+	if err != nil {
+		return Container{}, fmt.Errorf("decoding %s failed: %v", path, err)
+	}
+
+	ctr := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:      c.ID,
+			Created: c.Created.Format(time.RFC3339Nano),
+			Path:    c.Path,
+			Args:    c.Args,
+			State: &types.ContainerState{
+				Status:     c.statusString(),
+				Running:    c.State.Running,
+				Paused:     c.State.Paused,
+				Restarting: c.State.Restarting,
+				OOMKilled:  c.State.OOMKilled,
+				Dead:       c.State.Dead,
+				Pid:        c.State.Pid,
+				ExitCode:   c.State.ExitCode,
+				Error:      c.State.Error,
+				StartedAt:  c.State.StartedAt.Format(time.RFC3339Nano),
+				FinishedAt: c.State.FinishedAt.Format(time.RFC3339Nano),
+			},
+			Image:           c.Image,
+			ResolvConfPath:  c.ResolvConfPath,
+			HostnamePath:    c.HostnamePath,
+			HostsPath:       c.HostsPath,
+			LogPath:         c.LogPath,
+			Name:            c.Name,
+			RestartCount:    c.RestartCount,
+			Driver:          c.Driver,
+			MountLabel:      c.MountLabel,
+			ProcessLabel:    c.ProcessLabel,
+			AppArmorProfile: c.AppArmorProfile,
+			HostConfig:      hostConfig,
+			GraphDriver:     diskGraphDriver(root, c.ID, c.Driver),
+		},
+		Mounts: []types.MountPoint{},
+		Config: c.Config,
+	}
+
+	for _, m := range c.MountPoints {
+		source := m.Source
+		// named volumes of the local driver live in the volumes directory
+		if source == "" && m.Name != "" && m.Driver == "local" {
+			source = filepath.Join(root, "volumes", m.Name, "_data")
+		}
+		ctr.Mounts = append(ctr.Mounts, types.MountPoint{
+			Type:        m.Type,
+			Name:        m.Name,
+			Source:      source,
+			Destination: m.Destination,
+			Driver:      m.Driver,
+			Mode:        m.Mode,
+			RW:          m.RW,
+			Propagation: m.Propagation,
+		})
+	}
+	// map iteration is random, keep the mounts in a stable order
+	sort.Slice(ctr.Mounts, func(i, j int) bool {
+		return ctr.Mounts[i].Destination < ctr.Mounts[j].Destination
+	})
+
+	return Container{ContainerJSON: ctr, HostConfigExtra: hostConfigExtra}, nil
+}
+
+// resolveDiskContainer finds the full ID of the container referenced by
+// nameOrID in the containers directory under root, the way docker does: a
+// full ID, else an exact name, else a unique ID prefix.
+func resolveDiskContainer(root, nameOrID string) (string, error) {
+	if nameOrID == "" {
+		return "", errors.New("no container name or ID")
+	}
+
+	dir := filepath.Join(root, "containers")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("reading containers directory failed: %v", err)
+	}
+
+	var ids []string
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		if f.Name() == nameOrID {
+			return f.Name(), nil
+		}
+		ids = append(ids, f.Name())
+	}
+
+	// a container can be named like the ID prefix of another one
+	name := "/" + strings.TrimPrefix(nameOrID, "/")
+	for _, id := range ids {
+		var c struct{ Name string }
+		if err := readJSONFile(filepath.Join(dir, id, configFileName), &c); err != nil {
+			// skip anything we cannot read, it is not the container we want
+			continue
+		}
+		if c.Name == name {
+			return id, nil
+		}
+	}
+
+	var matches []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, nameOrID) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no container found for %s in %s", nameOrID, dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple containers found with ID prefix %s", nameOrID)
+	}
+}
+
+// diskGraphDriver rebuilds the graph driver data of a container. Only the
+// layer directories of the overlay2 driver are resolved, for every other
+// driver just the name is returned.
+func diskGraphDriver(root, id, driver string) types.GraphDriverData {
+	gd := types.GraphDriverData{
+		Name: driver,
+		Data: map[string]string{},
+	}
+	if driver != "overlay2" {
+		return gd
+	}
+
+	mountID, err := ioutil.ReadFile(filepath.Join(root, "image", driver, "layerdb", "mounts", id, "mount-id"))
+	if err != nil {
+		return gd
+	}
+	layerDir := filepath.Join(root, driver, strings.TrimSpace(string(mountID)))
+
+	lower, err := ioutil.ReadFile(filepath.Join(layerDir, "lower"))
+	if err == nil {
+		var lowerDirs []string
+		for _, l := range strings.Split(strings.TrimSpace(string(lower)), ":") {
+			// the entries are short symlinks relative to the driver root
+			p := filepath.Join(root, driver, l)
+			if resolved, err := filepath.EvalSymlinks(p); err == nil {
+				p = resolved
+			}
+			lowerDirs = append(lowerDirs, p)
+		}
+		gd.Data["LowerDir"] = strings.Join(lowerDirs, ":")
+	}
+	gd.Data["UpperDir"] = filepath.Join(layerDir, "diff")
+	gd.Data["WorkDir"] = filepath.Join(layerDir, "work")
+	gd.Data["MergedDir"] = filepath.Join(layerDir, "merged")
+
+	return gd
+}
+
+func readJSONFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s failed: %v", path, err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s failed: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package inspect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testDiskID     = "d4da95779a3c287b28b421194f04374b6330e6ff10f5ca1a99d03828d84f1635"
+	testDiskConfig = `{
+	"State": {"Running": true, "Pid": 1234, "StartedAt": "2018-09-25T10:00:00Z"},
+	"ID": "` + testDiskID + `",
+	"Path": "nginx",
+	"Args": ["-g", "daemon off;"],
+	"Config": {"Hostname": "d4da95779a3c", "Env": ["PATH=/bin"]},
+	"Image": "sha256:abc",
+	"Name": "/modest_meitner",
+	"Driver": "overlay2",
+	"MountPoints": {
+		"/data": {"Source": "", "Destination": "/data", "RW": true, "Name": "data", "Driver": "local", "Type": "volume", "Relabel": "z"},
+		"/etc/app": {"Source": "/srv/app", "Destination": "/etc/app", "RW": false, "Type": "bind"}
+	}
+}`
+	testDiskHostConfig = `{"NetworkMode": "bridge", "Privileged": true, "CgroupnsMode": "private", "DeviceRequests": [{"Driver": "nvidia", "Count": -1}]}`
+)
+
+func TestFromDisk(t *testing.T) {
+	root, err := ioutil.TempDir("", "riddler-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "containers", testDiskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, configFileName), []byte(testDiskConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, hostConfigFileName), []byte(testDiskHostConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{testDiskID, testDiskID[:12], "modest_meitner", "/modest_meitner"} {
+		ctr, err := FromDisk(root, ref, logrus.StandardLogger())
+		if err != nil {
+			t.Fatalf("reading %s failed: %v", ref, err)
+		}
+
+		if ctr.ID != testDiskID {
+			t.Fatalf("expected ID %s, got %s", testDiskID, ctr.ID)
+		}
+		if ctr.State.Status != "running" || ctr.State.Pid != 1234 {
+			t.Fatalf("expected running state with pid 1234, got %#v", ctr.State)
+		}
+		if !ctr.HostConfig.Privileged || ctr.HostConfig.NetworkMode != "bridge" {
+			t.Fatalf("host config was not read: %#v", ctr.HostConfig)
+		}
+		if ctr.HostConfigExtra.CgroupnsMode != "private" || len(ctr.HostConfigExtra.DeviceRequests) != 1 {
+			t.Fatalf("fields of newer daemons were not kept: %#v", ctr.HostConfigExtra)
+		}
+		if len(ctr.Mounts) != 2 {
+			t.Fatalf("expected 2 mounts, got %d", len(ctr.Mounts))
+		}
+		if expected := filepath.Join(root, "volumes", "data", "_data"); ctr.Mounts[0].Source != expected || ctr.Mounts[0].Mode != "z" {
+			t.Fatalf("expected volume mount from %s with mode z, got %#v", expected, ctr.Mounts[0])
+		}
+		if ctr.Mounts[1].Source != "/srv/app" || ctr.Mounts[1].RW {
+			t.Fatalf("expected read-only bind mount from /srv/app, got %#v", ctr.Mounts[1])
+		}
+	}
+
+	if _, err := FromDisk(root, "nope", logrus.StandardLogger()); err == nil {
+		t.Fatal("expected an error for a container that does not exist")
+	}
+}
+
+func TestResolveDiskContainer(t *testing.T) {
+	root, err := ioutil.TempDir("", "riddler-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	containers := map[string]string{
+		"abc123": "/web",
+		"abd456": "/db",
+		// named like the ID prefix of the first one
+		"fed789": "/abc",
+	}
+	for id, name := range containers {
+		dir := filepath.Join(root, "containers", id)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, configFileName), []byte(`{"Name": "`+name+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ref string
+		id  string
+	}{
+		{"abc123", "abc123"},
+		{"web", "abc123"},
+		{"/db", "abd456"},
+		{"abc", "fed789"},
+		{"abc1", "abc123"},
+		{"ab", ""},
+		{"cache", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		id, err := resolveDiskContainer(root, test.ref)
+		if test.id == "" {
+			if err == nil {
+				t.Fatalf("expected an error resolving %q, got %s", test.ref, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("resolving %q failed: %v", test.ref, err)
+		}
+		if id != test.id {
+			t.Fatalf("expected %q to resolve to %s, got %s", test.ref, test.id, id)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package inspect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// nvidiaHook is the hook the daemon adds for the device requests of
+	// GPUs, it is looked up in the PATH of the host.
+	nvidiaHook = "nvidia-container-runtime-hook"
+)
+
+// skipFields are the fields of the inspect output that do not go into the
+// spec, so fields riddler does not know in them do not matter.
+var skipFields = map[string]bool{
+	"NetworkSettings": true,
+	"State":           true,
+}
+
+// Container is the docker inspect data of a container, along with the
+// fields of daemons newer than the vendored API types.
+type Container struct {
+	types.ContainerJSON
+	HostConfigExtra HostConfigExtra
+}
+
+// HostConfigExtra holds the fields of the host config of newer daemons that
+// types.HostConfig does not have.
+type HostConfigExtra struct {
+	CgroupnsMode   string          `json:",omitempty"`
+	DeviceRequests []DeviceRequest `json:",omitempty"`
+}
+
+// DeviceRequest is a request for devices from a device driver, ex. GPUs with
+// `docker run --gpus`.
+type DeviceRequest struct {
+	Driver       string
+	Count        int
+	DeviceIDs    []string
+	Capabilities [][]string
+	Options      map[string]string
+}
+
+// extra is the layer of the inspect output decoded on top of
+// types.ContainerJSON.
+type extra struct {
+	HostConfig HostConfigExtra
+}
+
+// DecodeContainer decodes the inspect output of one container, keeping the
+// fields of newer daemons. It warns about the fields it does not know to
+// log, they are not in the spec.
+func DecodeContainer(data []byte, log logrus.FieldLogger) (Container, error) {
+	var (
+		c Container
+		e extra
+		v interface{}
+	)
+	for _, p := range []interface{}{&c.ContainerJSON, &e, &v} {
+		if err := json.Unmarshal(data, p); err != nil {
+			return c, err
+		}
+	}
+	c.HostConfigExtra = e.HostConfig
+
+	// make sure the entry has the fields parse.Config relies on
+	if c.ContainerJSONBase == nil || c.HostConfig == nil || c.Config == nil {
+		return c, errors.New("missing the container, host or config fields")
+	}
+
+	unknown := unknownFields(v, "", reflect.TypeOf(c.ContainerJSON), reflect.TypeOf(e))
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		log.Warnf("Ignoring field %s of %s, it is not understood", field, c.Name)
+	}
+	return c, nil
+}
+
+// decodeHostConfig decodes a host config on its own, like the hostconfig.json
+// the daemon saves, keeping the fields of newer daemons. It warns about the
+// fields it does not know to log, they are not in the spec.
+func decodeHostConfig(data []byte, name string, log logrus.FieldLogger) (*containertypes.HostConfig, HostConfigExtra, error) {
+	var (
+		hc containertypes.HostConfig
+		e  HostConfigExtra
+		v  interface{}
+	)
+	for _, p := range []interface{}{&hc, &e, &v} {
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, e, err
+		}
+	}
+
+	unknown := unknownFields(v, "HostConfig.", reflect.TypeOf(hc), reflect.TypeOf(e))
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		log.Warnf("Ignoring field %s of %s, it is not understood", field, name)
+	}
+	return &hc, e, nil
+}
+
+// Apply adds the fields of newer daemons to the spec, warning about the ones
+// it cannot add to log.
+func (c Container) Apply(config *specs.Spec, log logrus.FieldLogger) {
+	switch c.HostConfigExtra.CgroupnsMode {
+	case "private":
+		parse.NamespacePath(config, specs.CgroupNamespace, "")
+	case "host":
+		removeNamespace(config, specs.CgroupNamespace)
+	}
+
+	for _, r := range c.HostConfigExtra.DeviceRequests {
+		if !isGPURequest(r) {
+			log.Warnf("Ignoring the device request of driver %q of %s, only GPUs are supported", r.Driver, c.Name)
+			continue
+		}
+		addGPURequest(config, r, log)
+	}
+}
+
+// isGPURequest reports whether the request is for GPUs, like the ones of
+// `docker run --gpus`.
+func isGPURequest(r DeviceRequest) bool {
+	if r.Driver == "nvidia" {
+		return true
+	}
+	for _, caps := range r.Capabilities {
+		for _, c := range caps {
+			if c == "gpu" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addGPURequest gives the container the GPUs of the request, the way the
+// daemon does, through the hook of the NVIDIA container toolkit.
+func addGPURequest(config *specs.Spec, r DeviceRequest, log logrus.FieldLogger) {
+	devices := "all"
+	if len(r.DeviceIDs) > 0 {
+		devices = strings.Join(r.DeviceIDs, ",")
+	} else if r.Count > 0 {
+		var ids []string
+		for i := 0; i < r.Count; i++ {
+			ids = append(ids, fmt.Sprint(i))
+		}
+		devices = strings.Join(ids, ",")
+	}
+
+	var caps []string
+	for _, cs := range r.Capabilities {
+		for _, c := range cs {
+			if c != "gpu" && c != "nvidia" {
+				caps = append(caps, c)
+			}
+		}
+	}
+
+	path, err := exec.LookPath(nvidiaHook)
+	if err != nil {
+		path = "/usr/bin/" + nvidiaHook
+		log.Warnf("%s is not in the PATH, using %s for the GPUs", nvidiaHook, path)
+	}
+	if config.Hooks == nil {
+		config.Hooks = &specs.Hooks{}
+	}
+	config.Hooks.Prestart = append(config.Hooks.Prestart, specs.Hook{
+		Path: path,
+		Args: []string{path, "prestart"},
+	})
+
+	config.Process.Env = append(config.Process.Env, "NVIDIA_VISIBLE_DEVICES="+devices)
+	if len(caps) > 0 {
+		config.Process.Env = append(config.Process.Env, "NVIDIA_DRIVER_CAPABILITIES="+strings.Join(caps, ","))
+	}
+}
+
+// removeNamespace makes the container use the namespace of type t of the
+// host.
+func removeNamespace(config *specs.Spec, t specs.LinuxNamespaceType) {
+	var namespaces []specs.LinuxNamespace
+	for _, ns := range config.Linux.Namespaces {
+		if ns.Type != t {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	config.Linux.Namespaces = namespaces
+}
+
+// unknownFields returns the fields set in v that none of the types have,
+// matched by name the way encoding/json does.
+func unknownFields(v interface{}, path string, ts ...reflect.Type) []string {
+	for i := range ts {
+		for ts[i].Kind() == reflect.Ptr {
+			ts[i] = ts[i].Elem()
+		}
+	}
+	if len(ts) == 0 {
+		return nil
+	}
+
+	var unknown []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch ts[0].Kind() {
+		case reflect.Struct:
+			for key, value := range v {
+				if isZero(value) || (path == "" && skipFields[key]) {
+					continue
+				}
+				var fts []reflect.Type
+				for _, t := range ts {
+					if ft, ok := fieldType(t, key); ok {
+						fts = append(fts, ft)
+					}
+				}
+				if len(fts) == 0 {
+					unknown = append(unknown, path+key)
+					continue
+				}
+				unknown = append(unknown, unknownFields(value, path+key+".", fts...)...)
+			}
+		case reflect.Map:
+			// the keys are data, not fields
+			for key, value := range v {
+				unknown = append(unknown, unknownFields(value, path+key+".", ts[0].Elem())...)
+			}
+		}
+	case []interface{}:
+		if ts[0].Kind() == reflect.Slice || ts[0].Kind() == reflect.Array {
+			for i, value := range v {
+				unknown = append(unknown, unknownFields(value, fmt.Sprintf("%s%d.", path, i), ts[0].Elem())...)
+			}
+		}
+	}
+	return unknown
+}
+
+// fieldType returns the type of the field of the struct type t that the
+// JSON key decodes into, looking into the embedded structs.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if t, ok := fieldType(ft, key); ok {
+					return t, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+// isZero reports whether the JSON value is empty, newer daemons print the
+// fields they have even when they are not set.
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		for _, e := range v {
+			if !isZero(e) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package inspect
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDecodeContainer(t *testing.T) {
+	data := []byte(`{
+		"Id": "abc",
+		"Name": "/gpu",
+		"ImageManifestDescriptor": {"mediaType": "application/vnd.oci.image.manifest.v1+json"},
+		"State": {"Health": {"Status": "healthy"}},
+		"HostConfig": {
+			"CgroupnsMode": "private",
+			"DeviceRequests": [{"Driver": "", "Count": -1, "Capabilities": [["gpu", "compute", "utility"]]}],
+			"Annotations": null,
+			"ConsoleSize": [0, 0],
+			"Mounts": [{"Type": "bind", "Source": "/a", "Target": "/b", "BindOptions": {"CreateMountpoint": true}}]
+		},
+		"Config": {"Env": ["A=b"]}
+	}`)
+
+	c, err := DecodeContainer(data, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.HostConfigExtra.CgroupnsMode != "private" {
+		t.Fatalf("expected cgroupns mode private, got %q", c.HostConfigExtra.CgroupnsMode)
+	}
+	if len(c.HostConfigExtra.DeviceRequests) != 1 {
+		t.Fatalf("expected 1 device request, got %d", len(c.HostConfigExtra.DeviceRequests))
+	}
+
+	v := map[string]interface{}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	unknown := unknownFields(v, "", reflect.TypeOf(c.ContainerJSON), reflect.TypeOf(extra{}))
+	sort.Strings(unknown)
+	expected := []string{"HostConfig.Mounts.0.BindOptions.CreateMountpoint", "ImageManifestDescriptor"}
+	if !reflect.DeepEqual(unknown, expected) {
+		t.Fatalf("expected unknown fields %v, got %v", expected, unknown)
+	}
+
+	config, err := parse.Config(c.ContainerJSON, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Apply(config, logrus.StandardLogger())
+	if !parse.HasNamespace(config, specs.CgroupNamespace) {
+		t.Fatal("expected a cgroup namespace")
+	}
+	if config.Hooks == nil || len(config.Hooks.Prestart) != 1 {
+		t.Fatalf("expected the GPU prestart hook, got %#v", config.Hooks)
+	}
+	env := config.Process.Env[len(config.Process.Env)-2:]
+	expectedEnv := []string{"NVIDIA_VISIBLE_DEVICES=all", "NVIDIA_DRIVER_CAPABILITIES=compute,utility"}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Fatalf("expected env %v, got %v", expectedEnv, env)
+	}
+}
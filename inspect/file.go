@@ -0,0 +1,78 @@
+// Package inspect provides ways to get the docker inspect data for containers
+// from sources other than the docker daemon API.
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Decode reads the output of `docker inspect` from r. It accepts both a single
+// container object and the array that `docker inspect` prints. The warnings
+// about the input go to log.
+func Decode(r io.Reader, log logrus.FieldLogger) ([]Container, error) {
+	entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctrs []Container
+	for i, entry := range entries {
+		ctr, err := DecodeContainer(entry, log)
+		if err != nil {
+			return nil, fmt.Errorf("decoding inspect entry %d failed: %v", i, err)
+		}
+		ctrs = append(ctrs, ctr)
+	}
+
+	return ctrs, nil
+}
+
+// ReadFile reads the inspect output saved in the file at path. If path is
+// "-", the data is read from stdin.
+func ReadFile(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", path, err)
+	}
+	return data, nil
+}
+
+// readEntries splits the inspect output in r into the raw entries for each
+// container. The output can be a single object or an array of them.
+func readEntries(r io.Reader) ([]json.RawMessage, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading inspect data failed: %v", err)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("inspect data is empty")
+	}
+
+	var entries []json.RawMessage
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("decoding inspect array failed: %v", err)
+		}
+	} else {
+		entries = append(entries, json.RawMessage(data))
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("inspect data contains no containers")
+	}
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package inspect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      bool
+	}{
+		{
+			input:    `{"Id": "abc", "Name": "/one", "HostConfig": {}, "Config": {}}`,
+			expected: []string{"/one"},
+		},
+		{
+			input:    `  [{"Id": "abc", "Name": "/one", "HostConfig": {}, "Config": {}}, {"Id": "def", "Name": "/two", "HostConfig": {}, "Config": {}}]`,
+			expected: []string{"/one", "/two"},
+		},
+		{
+			input: `[]`,
+			err:   true,
+		},
+		{
+			input: `{"Id": "abc", "Name": "/one"}`,
+			err:   true,
+		},
+		{
+			input: ``,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		ctrs, err := Decode(strings.NewReader(test.input), logrus.StandardLogger())
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error decoding %q", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ctrs) != len(test.expected) {
+			t.Fatalf("expected %d containers, got %d", len(test.expected), len(ctrs))
+		}
+		for i, ctr := range ctrs {
+			if ctr.Name != test.expected[i] {
+				t.Fatalf("expected name %s, got %s", test.expected[i], ctr.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package inspect
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+)
+
+const (
+	// VolumesDir is the directory in the bundle that holds the volumes
+	// declared by an image.
+	VolumesDir = "volumes"
+)
+
+// FromImage builds the docker inspect data of a container that was created
+// from the image, without creating one. The volumes the image declares are
+// bind mounted from directories below VolumesDir relative to the bundle,
+// which the caller is expected to create and fill with the content the image
+// has at their destination, the mounts hide it otherwise.
+func FromImage(img types.ImageInspect, ref string) (types.ContainerJSON, error) {
+	if img.Config == nil {
+		return types.ContainerJSON{}, errors.New("image has no config")
+	}
+
+	// copy the config so we don't change the image
+	config := *img.Config
+	config.Image = ref
+
+	// the entrypoint and the command make up the process, like docker run
+	cmd := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(cmd) == 0 {
+		return types.ContainerJSON{}, errors.New("image has no entrypoint or command")
+	}
+
+	ctr := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path:  cmd[0],
+			Args:  cmd[1:],
+			State: &types.ContainerState{Status: "created"},
+			Image: img.ID,
+			Name:  "/" + imageName(ref),
+			HostConfig: &containertypes.HostConfig{
+				NetworkMode: "default",
+			},
+			GraphDriver: img.GraphDriver,
+		},
+		Mounts: []types.MountPoint{},
+		Config: &config,
+	}
+
+	volumes := []string{}
+	for v := range config.Volumes {
+		volumes = append(volumes, v)
+	}
+	sort.Strings(volumes)
+	for _, v := range volumes {
+		ctr.Mounts = append(ctr.Mounts, types.MountPoint{
+			Type:        mounttypes.TypeVolume,
+			Source:      path.Join(VolumesDir, volumeDirName(v)),
+			Destination: v,
+			RW:          true,
+		})
+	}
+
+	return ctr, nil
+}
+
+// imageName turns an image reference into something usable as a container
+// name, ex. docker.io/library/nginx:1.15 becomes nginx_1.15.
+func imageName(ref string) string {
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	name = name[strings.LastIndex(name, "/")+1:]
+	return strings.Replace(name, ":", "_", -1)
+}
+
+// mergeEnv lays the variables of override over the ones of env the way docker
+// does for the env of a container over the one of its image: a variable
+// replaces the one of the same name, and a name without a value unsets it.
+func mergeEnv(env, override []string) []string {
+	merged := append([]string{}, env...)
+	for _, kv := range override {
+		name := strings.SplitN(kv, "=", 2)[0]
+		found := false
+		for i := 0; i < len(merged); i++ {
+			if strings.SplitN(merged[i], "=", 2)[0] != name {
+				continue
+			}
+			if !strings.Contains(kv, "=") {
+				merged = append(merged[:i], merged[i+1:]...)
+				i--
+				continue
+			}
+			if !found {
+				merged[i] = kv
+				found = true
+			}
+		}
+		if !found && strings.Contains(kv, "=") {
+			merged = append(merged, kv)
+		}
+	}
+	return merged
+}
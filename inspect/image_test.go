@@ -0,0 +1,98 @@
+package inspect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestFromImage(t *testing.T) {
+	img := types.ImageInspect{
+		ID: "sha256:abc",
+		Config: &containertypes.Config{
+			Entrypoint:   []string{"/docker-entrypoint.sh"},
+			Cmd:          []string{"nginx", "-g", "daemon off;"},
+			Env:          []string{"PATH=/bin"},
+			WorkingDir:   "/srv",
+			User:         "nginx",
+			Volumes:      map[string]struct{}{"/var/cache/nginx": {}, "/data": {}},
+			ExposedPorts: nat.PortSet{"80/tcp": {}},
+			StopSignal:   "SIGQUIT",
+		},
+	}
+
+	ctr, err := FromImage(img, "docker.io/library/nginx:1.15")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctr.Path != "/docker-entrypoint.sh" {
+		t.Fatalf("expected path /docker-entrypoint.sh, got %s", ctr.Path)
+	}
+	if expected := []string{"nginx", "-g", "daemon off;"}; !reflect.DeepEqual(ctr.Args, expected) {
+		t.Fatalf("expected args %v, got %v", expected, ctr.Args)
+	}
+	if ctr.Name != "/nginx_1.15" {
+		t.Fatalf("expected name /nginx_1.15, got %s", ctr.Name)
+	}
+	if ctr.Image != img.ID || ctr.Config.Image != "docker.io/library/nginx:1.15" {
+		t.Fatalf("expected image %s from docker.io/library/nginx:1.15, got %s from %s", img.ID, ctr.Image, ctr.Config.Image)
+	}
+	if ctr.Config.StopSignal != "SIGQUIT" || ctr.Config.WorkingDir != "/srv" || ctr.Config.User != "nginx" {
+		t.Fatalf("image config was not kept: %#v", ctr.Config)
+	}
+	if img.Config.Image != "" {
+		t.Fatal("the image config was changed")
+	}
+
+	if len(ctr.Mounts) != 2 {
+		t.Fatalf("expected 2 mounts, got %d", len(ctr.Mounts))
+	}
+	if ctr.Mounts[0].Destination != "/data" || ctr.Mounts[0].Source != "volumes/data" {
+		t.Fatalf("expected /data from volumes/data, got %#v", ctr.Mounts[0])
+	}
+	if ctr.Mounts[1].Destination != "/var/cache/nginx" || ctr.Mounts[1].Source != "volumes/var-cache-nginx" {
+		t.Fatalf("expected /var/cache/nginx from volumes/var-cache-nginx, got %#v", ctr.Mounts[1])
+	}
+
+	if _, err := FromImage(types.ImageInspect{Config: &containertypes.Config{}}, "scratch"); err == nil {
+		t.Fatal("expected an error for an image without a command")
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		env, override, expected []string
+	}{
+		{
+			env:      []string{"PATH=/usr/bin", "LANG=C"},
+			override: []string{"PATH=/custom", "DEBUG=1"},
+			expected: []string{"PATH=/custom", "LANG=C", "DEBUG=1"},
+		},
+		{
+			env:      []string{"PATH=/usr/bin", "LANG=C"},
+			override: []string{"LANG"},
+			expected: []string{"PATH=/usr/bin"},
+		},
+		{
+			env:      nil,
+			override: []string{"A=1", "A=2"},
+			expected: []string{"A=2"},
+		},
+		{
+			env:      []string{"A=1"},
+			override: []string{"A="},
+			expected: []string{"A="},
+		},
+	}
+
+	for _, test := range tests {
+		env := mergeEnv(test.env, test.override)
+		if !reflect.DeepEqual(env, test.expected) {
+			t.Fatalf("merging %v over %v: expected %v, got %v", test.override, test.env, test.expected, env)
+		}
+	}
+}
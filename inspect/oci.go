@@ -0,0 +1,187 @@
+package inspect
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	ociIndexFile = "index.json"
+
+	// docker writes its own manifest types into image layouts as well
+	dockerMediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerMediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// OCIImage is an image selected from an OCI image layout directory.
+type OCIImage struct {
+	// Layout is the path to the image layout directory.
+	Layout string
+	// Ref is the name the image was selected by, it can be empty.
+	Ref      string
+	Manifest ocispec.Manifest
+	Config   ocispec.Image
+}
+
+// FromOCILayout selects the image in the OCI image layout directory that has
+// the ref name annotation ref and matches the platform, formatted as
+// os/arch[/variant]. If ref is empty the layout must contain a single image
+// for the platform.
+func FromOCILayout(layout, ref, platform string) (*OCIImage, error) {
+	p, err := parsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	var index ocispec.Index
+	if err := readJSONFile(filepath.Join(layout, ociIndexFile), &index); err != nil {
+		return nil, err
+	}
+
+	img := &OCIImage{
+		Layout: layout,
+		Ref:    ref,
+	}
+
+	var matches []ocispec.Descriptor
+	for _, d := range index.Manifests {
+		if ref != "" && d.Annotations[ocispec.AnnotationRefName] != ref {
+			continue
+		}
+		found, err := img.findManifests(d, p)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+	}
+
+	switch len(matches) {
+	case 0:
+		if ref == "" {
+			return nil, fmt.Errorf("no image for %s found in %s", platform, layout)
+		}
+		return nil, fmt.Errorf("no image %s for %s found in %s", ref, platform, layout)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%d images for %s found in %s, select one by its ref name", len(matches), platform, layout)
+	}
+
+	if err := img.readBlob(matches[0].Digest, &img.Manifest); err != nil {
+		return nil, err
+	}
+	if err := img.readBlob(img.Manifest.Config.Digest, &img.Config); err != nil {
+		return nil, err
+	}
+
+	// the manifest might not have said, so check the config as well
+	if img.Config.OS != "" && img.Config.OS != p.OS || img.Config.Architecture != "" && img.Config.Architecture != p.Architecture {
+		return nil, fmt.Errorf("image is for %s/%s, not %s", img.Config.OS, img.Config.Architecture, platform)
+	}
+
+	return img, nil
+}
+
+// findManifests returns the image manifests for the platform the descriptor
+// points to, following nested indexes.
+func (img *OCIImage) findManifests(d ocispec.Descriptor, p ocispec.Platform) ([]ocispec.Descriptor, error) {
+	if d.Platform != nil && !platformMatches(*d.Platform, p) {
+		return nil, nil
+	}
+
+	switch d.MediaType {
+	case ocispec.MediaTypeImageManifest, dockerMediaTypeManifest:
+		return []ocispec.Descriptor{d}, nil
+	case ocispec.MediaTypeImageIndex, dockerMediaTypeManifestList:
+		var index ocispec.Index
+		if err := img.readBlob(d.Digest, &index); err != nil {
+			return nil, err
+		}
+		var matches []ocispec.Descriptor
+		for _, m := range index.Manifests {
+			found, err := img.findManifests(m, p)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, found...)
+		}
+		return matches, nil
+	default:
+		return nil, nil
+	}
+}
+
+// BlobPath returns the path to the blob with the digest d in the layout.
+func (img *OCIImage) BlobPath(d digest.Digest) (string, error) {
+	// the digest ends up in a path, so make sure it is not made up
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("invalid digest %s: %v", d, err)
+	}
+	return filepath.Join(img.Layout, "blobs", d.Algorithm().String(), d.Hex()), nil
+}
+
+func (img *OCIImage) readBlob(d digest.Digest, v interface{}) error {
+	path, err := img.BlobPath(d)
+	if err != nil {
+		return err
+	}
+	return readJSONFile(path, v)
+}
+
+// Container builds the docker inspect data of a container created from the
+// image, the same way FromImage does for images of the docker daemon.
+func (img *OCIImage) Container() (types.ContainerJSON, error) {
+	c := img.Config.Config
+	config := &containertypes.Config{
+		User:         c.User,
+		ExposedPorts: nat.PortSet{},
+		Env:          c.Env,
+		Entrypoint:   c.Entrypoint,
+		Cmd:          c.Cmd,
+		Volumes:      c.Volumes,
+		WorkingDir:   c.WorkingDir,
+		Labels:       c.Labels,
+		StopSignal:   c.StopSignal,
+	}
+	for port := range c.ExposedPorts {
+		config.ExposedPorts[nat.Port(port)] = struct{}{}
+	}
+
+	ref := img.Ref
+	if ref == "" {
+		ref = filepath.Base(filepath.Clean(img.Layout))
+	}
+
+	return FromImage(types.ImageInspect{
+		ID:     img.Manifest.Config.Digest.String(),
+		Config: config,
+	}, ref)
+}
+
+func parsePlatform(platform string) (ocispec.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ocispec.Platform{}, fmt.Errorf("parsing platform %s as os/arch[/variant] failed", platform)
+	}
+	p := ocispec.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func platformMatches(have, want ocispec.Platform) bool {
+	if have.OS != want.OS || have.Architecture != want.Architecture {
+		return false
+	}
+	return want.Variant == "" || have.Variant == want.Variant
+}
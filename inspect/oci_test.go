@@ -0,0 +1,112 @@
+package inspect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func writeBlob(t *testing.T, layout string, v interface{}) ocispec.Descriptor {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := digest.FromBytes(data)
+	dir := filepath.Join(layout, "blobs", d.Algorithm().String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, d.Hex()), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ocispec.Descriptor{Digest: d, Size: int64(len(data))}
+}
+
+func writeImage(t *testing.T, layout, arch string, cmd []string) ocispec.Descriptor {
+	config := writeBlob(t, layout, ocispec.Image{
+		OS:           "linux",
+		Architecture: arch,
+		Config: ocispec.ImageConfig{
+			Cmd:          cmd,
+			ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+		},
+	})
+	config.MediaType = ocispec.MediaTypeImageConfig
+
+	manifest := writeBlob(t, layout, ocispec.Manifest{Config: config})
+	manifest.MediaType = ocispec.MediaTypeImageManifest
+	manifest.Platform = &ocispec.Platform{OS: "linux", Architecture: arch}
+	return manifest
+}
+
+func TestFromOCILayout(t *testing.T) {
+	layout, err := ioutil.TempDir("", "riddler-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(layout)
+
+	// a multi platform image in a nested index and a single image
+	nested := writeBlob(t, layout, ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			writeImage(t, layout, "amd64", []string{"/app-amd64"}),
+			writeImage(t, layout, "arm64", []string{"/app-arm64"}),
+		},
+	})
+	nested.MediaType = ocispec.MediaTypeImageIndex
+	nested.Annotations = map[string]string{ocispec.AnnotationRefName: "app"}
+
+	single := writeImage(t, layout, "amd64", []string{"/tool"})
+	single.Platform = nil
+	single.Annotations = map[string]string{ocispec.AnnotationRefName: "tool"}
+
+	index, err := json.Marshal(ocispec.Index{Manifests: []ocispec.Descriptor{nested, single}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(layout, ociIndexFile), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref, platform, path string
+	}{
+		{ref: "app", platform: "linux/amd64", path: "/app-amd64"},
+		{ref: "app", platform: "linux/arm64", path: "/app-arm64"},
+		{ref: "tool", platform: "linux/amd64", path: "/tool"},
+	}
+	for _, test := range tests {
+		img, err := FromOCILayout(layout, test.ref, test.platform)
+		if err != nil {
+			t.Fatalf("selecting %s for %s failed: %v", test.ref, test.platform, err)
+		}
+		ctr, err := img.Container()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ctr.Path != test.path {
+			t.Fatalf("expected path %s for %s on %s, got %s", test.path, test.ref, test.platform, ctr.Path)
+		}
+		if _, ok := ctr.Config.ExposedPorts["8080/tcp"]; !ok {
+			t.Fatalf("expected port 8080/tcp to be exposed, got %v", ctr.Config.ExposedPorts)
+		}
+	}
+
+	for _, test := range []struct{ ref, platform string }{
+		// both images have an amd64 variant
+		{ref: "", platform: "linux/amd64"},
+		// the single image turns out to be amd64 by its config
+		{ref: "tool", platform: "linux/arm64"},
+		{ref: "nope", platform: "linux/amd64"},
+		{ref: "app", platform: "linux"},
+	} {
+		if _, err := FromOCILayout(layout, test.ref, test.platform); err == nil {
+			t.Fatalf("expected an error selecting %q for %s", test.ref, test.platform)
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/genuinetools/riddler/parse"
+	"github.com/ghodss/yaml"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PodSandbox is the name of the container holding the namespaces the
+	// containers of a pod share, like the kubelet calls it.
+	PodSandbox = "POD"
+
+	// DefaultPauseImage is the image the sandbox of a pod runs.
+	DefaultPauseImage = "k8s.gcr.io/pause:3.1"
+	// DefaultKubeletSeccompDir is the directory the kubelet reads Localhost
+	// seccomp profiles from.
+	DefaultKubeletSeccompDir = "/var/lib/kubelet/seccomp"
+
+	// the cpu period the kubelet uses for cpu limits
+	podCPUPeriod = 100000
+)
+
+// validPodVolumeName matches the names Kubernetes allows for the volumes of a
+// pod, DNS labels of up to 63 characters.
+var validPodVolumeName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Pod is the part of a Kubernetes v1 Pod that can be converted.
+type Pod struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec PodSpec `json:"spec"`
+}
+
+// PodSpec is the spec of a Pod.
+type PodSpec struct {
+	Containers            []PodContainer      `json:"containers"`
+	Volumes               []PodVolume         `json:"volumes"`
+	SecurityContext       *PodSecurityContext `json:"securityContext"`
+	HostNetwork           bool                `json:"hostNetwork"`
+	HostPID               bool                `json:"hostPID"`
+	HostIPC               bool                `json:"hostIPC"`
+	ShareProcessNamespace *bool               `json:"shareProcessNamespace"`
+	Hostname              string              `json:"hostname"`
+}
+
+// PodContainer is a container of a Pod.
+type PodContainer struct {
+	Name       string   `json:"name"`
+	Image      string   `json:"image"`
+	Command    []string `json:"command"`
+	Args       []string `json:"args"`
+	WorkingDir string   `json:"workingDir"`
+	Env        []struct {
+		Name      string      `json:"name"`
+		Value     string      `json:"value"`
+		ValueFrom interface{} `json:"valueFrom"`
+	} `json:"env"`
+	Ports []struct {
+		ContainerPort int    `json:"containerPort"`
+		Protocol      string `json:"protocol"`
+	} `json:"ports"`
+	Resources struct {
+		Limits   map[string]string `json:"limits"`
+		Requests map[string]string `json:"requests"`
+	} `json:"resources"`
+	VolumeMounts []struct {
+		Name      string `json:"name"`
+		MountPath string `json:"mountPath"`
+		ReadOnly  bool   `json:"readOnly"`
+		SubPath   string `json:"subPath"`
+	} `json:"volumeMounts"`
+	SecurityContext *PodSecurityContext `json:"securityContext"`
+	TTY             bool                `json:"tty"`
+	Stdin           bool                `json:"stdin"`
+}
+
+// PodSecurityContext holds the fields of both the pod and the container
+// security context, the ones that only apply to one of them are ignored for
+// the other.
+type PodSecurityContext struct {
+	RunAsUser              *int64 `json:"runAsUser"`
+	RunAsGroup             *int64 `json:"runAsGroup"`
+	Privileged             *bool  `json:"privileged"`
+	ReadOnlyRootFilesystem *bool  `json:"readOnlyRootFilesystem"`
+	Capabilities           *struct {
+		Add  []string `json:"add"`
+		Drop []string `json:"drop"`
+	} `json:"capabilities"`
+	SeccompProfile *struct {
+		Type             string `json:"type"`
+		LocalhostProfile string `json:"localhostProfile"`
+	} `json:"seccompProfile"`
+	Sysctls []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"sysctls"`
+}
+
+// PodVolume is a volume of a Pod, only hostPath and emptyDir volumes are
+// supported.
+type PodVolume struct {
+	Name     string `json:"name"`
+	HostPath *struct {
+		Path string `json:"path"`
+	} `json:"hostPath"`
+	EmptyDir *struct {
+		Medium string `json:"medium"`
+	} `json:"emptyDir"`
+}
+
+// PodOptions are the settings for converting a Pod that the manifest does
+// not hold.
+type PodOptions struct {
+	// PauseImage is the image of the sandbox.
+	PauseImage string
+	// VolumesDir is the directory holding the emptyDir volumes.
+	VolumesDir string
+	// SeccompDir is the directory Localhost seccomp profiles are read from.
+	SeccompDir string
+	// ImageConfig returns the config of the image, used for the defaults
+	// the pod does not set. It can be nil.
+	ImageConfig func(image string) (*containertypes.Config, error)
+	// Log gets the warnings of the conversion. It can be nil, they go to
+	// the standard logger then.
+	Log logrus.FieldLogger
+}
+
+// ReadPod reads the Pod manifest, as YAML or JSON, in the file at path. If
+// path is "-", the manifest is read from stdin.
+func ReadPod(path string) (*Pod, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", path, err)
+	}
+
+	var pod Pod
+	if err := yaml.Unmarshal(data, &pod); err != nil {
+		return nil, fmt.Errorf("decoding pod manifest failed: %v", err)
+	}
+	if pod.APIVersion != "v1" || pod.Kind != "Pod" {
+		return nil, fmt.Errorf("expected a v1 Pod, got %s %s", pod.APIVersion, pod.Kind)
+	}
+	if pod.Metadata.Name == "" {
+		return nil, errors.New("pod has no name")
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return nil, errors.New("pod has no containers")
+	}
+	return &pod, nil
+}
+
+// FromPod builds the docker inspect data of the sandbox of the pod, named
+// PodSandbox, followed by its containers. The containers join the network
+// and ipc namespaces of the sandbox, and its pid namespace if the pod shares
+// it, the same way they would with `docker run --network container:POD`.
+//
+// Like docker, containers without a seccomp profile get the default one.
+func FromPod(pod *Pod, opts PodOptions) ([]types.ContainerJSON, error) {
+	if opts.PauseImage == "" {
+		opts.PauseImage = DefaultPauseImage
+	}
+	if opts.SeccompDir == "" {
+		opts.SeccompDir = DefaultKubeletSeccompDir
+	}
+	opts.Log = logger(opts.Log)
+	// the emptyDir volumes are directories named after them
+	for _, v := range pod.Spec.Volumes {
+		if !validPodVolumeName.MatchString(v.Name) {
+			return nil, fmt.Errorf("%q is not a valid volume name, it must be a DNS label of lowercase letters, digits and '-'", v.Name)
+		}
+	}
+
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Metadata.Name
+	}
+	psc := pod.Spec.SecurityContext
+	if psc == nil {
+		psc = &PodSecurityContext{}
+	}
+
+	sandbox := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    pod.Metadata.Name + "_" + PodSandbox,
+			Path:  "/pause",
+			State: &types.ContainerState{Status: "created"},
+			Image: opts.PauseImage,
+			Name:  "/" + PodSandbox,
+			HostConfig: &containertypes.HostConfig{
+				NetworkMode: "default",
+				Sysctls:     map[string]string{},
+			},
+		},
+		Mounts: []types.MountPoint{},
+		Config: &containertypes.Config{
+			Hostname: hostname,
+			Image:    opts.PauseImage,
+			Labels:   pod.Metadata.Labels,
+		},
+	}
+	// the namespaces the sysctls belong to are the ones of the sandbox
+	for _, s := range psc.Sysctls {
+		sandbox.HostConfig.Sysctls[s.Name] = s.Value
+	}
+
+	// the containers share the namespaces of the sandbox, unless they are
+	// the ones of the host
+	share := "container:" + PodSandbox
+	network, ipc, pid := share, share, ""
+	if pod.Spec.ShareProcessNamespace != nil && *pod.Spec.ShareProcessNamespace {
+		pid = share
+	}
+	if pod.Spec.HostNetwork {
+		sandbox.HostConfig.NetworkMode = "host"
+		sandbox.HostConfig.UTSMode = "host"
+		network = "host"
+	}
+	if pod.Spec.HostIPC {
+		sandbox.HostConfig.IpcMode = "host"
+		ipc = "host"
+	}
+	if pod.Spec.HostPID {
+		sandbox.HostConfig.PidMode = "host"
+		pid = "host"
+	}
+
+	ctrs := []types.ContainerJSON{sandbox}
+	for _, c := range pod.Spec.Containers {
+		hc := &containertypes.HostConfig{
+			NetworkMode: containertypes.NetworkMode(network),
+			IpcMode:     containertypes.IpcMode(ipc),
+			PidMode:     containertypes.PidMode(pid),
+			UTSMode:     sandbox.HostConfig.UTSMode,
+		}
+		ctr := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         pod.Metadata.Name + "_" + c.Name,
+				State:      &types.ContainerState{Status: "created"},
+				Image:      c.Image,
+				Name:       "/" + c.Name,
+				HostConfig: hc,
+			},
+			Mounts: []types.MountPoint{},
+			Config: &containertypes.Config{
+				Hostname:     hostname,
+				Image:        c.Image,
+				Labels:       pod.Metadata.Labels,
+				Tty:          c.TTY,
+				OpenStdin:    c.Stdin,
+				ExposedPorts: nat.PortSet{},
+			},
+		}
+
+		if err := podProcess(ctr, c, opts); err != nil {
+			return nil, fmt.Errorf("container %s: %v", c.Name, err)
+		}
+		if err := podSecurityContext(ctr, psc, c.SecurityContext, opts.SeccompDir); err != nil {
+			return nil, fmt.Errorf("container %s: %v", c.Name, err)
+		}
+		if err := podResources(hc, c); err != nil {
+			return nil, fmt.Errorf("container %s: %v", c.Name, err)
+		}
+		if err := podMounts(&ctr, pod.Spec.Volumes, c, opts.VolumesDir, opts.Log); err != nil {
+			return nil, fmt.Errorf("container %s: %v", c.Name, err)
+		}
+
+		for _, p := range c.Ports {
+			proto := strings.ToLower(p.Protocol)
+			if proto == "" {
+				proto = "tcp"
+			}
+			ctr.Config.ExposedPorts[nat.Port(fmt.Sprintf("%d/%s", p.ContainerPort, proto))] = struct{}{}
+		}
+
+		ctrs = append(ctrs, ctr)
+	}
+
+	return ctrs, nil
+}
+
+// podProcess sets up the process of the container, using the image for the
+// defaults the way the kubelet does.
+func podProcess(ctr types.ContainerJSON, c PodContainer, opts PodOptions) error {
+	img := &containertypes.Config{}
+	if opts.ImageConfig != nil {
+		config, err := opts.ImageConfig(c.Image)
+		switch {
+		case err == nil:
+			img = config
+		case len(c.Command) == 0:
+			return fmt.Errorf("getting the command of image %s failed: %v", c.Image, err)
+		default:
+			opts.Log.Warnf("Getting the config of image %s failed, using the defaults: %v", c.Image, err)
+		}
+	}
+
+	// the command replaces the entrypoint and the args the cmd of the image,
+	// but setting only the command drops the cmd of the image as well
+	cmd := append([]string{}, img.Entrypoint...)
+	args := append([]string{}, img.Cmd...)
+	if len(c.Command) > 0 {
+		cmd = c.Command
+		args = nil
+	}
+	if len(c.Args) > 0 {
+		args = c.Args
+	}
+	cmd = append(cmd, args...)
+	if len(cmd) == 0 {
+		return errors.New("no command for the container")
+	}
+	ctr.Path = cmd[0]
+	ctr.Args = cmd[1:]
+
+	ctr.Config.Env = append([]string{}, img.Env...)
+	if len(ctr.Config.Env) == 0 {
+		ctr.Config.Env = append(ctr.Config.Env, parse.DefaultTerminalEnv...)
+	}
+	var env []string
+	for _, e := range c.Env {
+		if e.ValueFrom != nil {
+			opts.Log.Warnf("Ignoring env variable %s of container %s, valueFrom is not supported", e.Name, c.Name)
+			continue
+		}
+		env = append(env, e.Name+"="+e.Value)
+	}
+	// the variables of the pod override the ones of the image by name
+	ctr.Config.Env = mergeEnv(ctr.Config.Env, env)
+
+	ctr.Config.WorkingDir = img.WorkingDir
+	if c.WorkingDir != "" {
+		ctr.Config.WorkingDir = c.WorkingDir
+	}
+	ctr.Config.User = img.User
+	ctr.Config.StopSignal = img.StopSignal
+	return nil
+}
+
+// podSecurityContext applies the security context of the container on top
+// of the one of the pod.
+func podSecurityContext(ctr types.ContainerJSON, psc, csc *PodSecurityContext, seccompDir string) error {
+	sc := *psc
+	if csc != nil {
+		if csc.RunAsUser != nil {
+			sc.RunAsUser = csc.RunAsUser
+		}
+		if csc.RunAsGroup != nil {
+			sc.RunAsGroup = csc.RunAsGroup
+		}
+		if csc.SeccompProfile != nil {
+			sc.SeccompProfile = csc.SeccompProfile
+		}
+		sc.Privileged = csc.Privileged
+		sc.ReadOnlyRootFilesystem = csc.ReadOnlyRootFilesystem
+		sc.Capabilities = csc.Capabilities
+	} else {
+		sc.Privileged = nil
+		sc.ReadOnlyRootFilesystem = nil
+		sc.Capabilities = nil
+	}
+
+	hc := ctr.HostConfig
+	if sc.RunAsUser != nil {
+		ctr.Config.User = strconv.FormatInt(*sc.RunAsUser, 10)
+		if sc.RunAsGroup != nil {
+			ctr.Config.User += ":" + strconv.FormatInt(*sc.RunAsGroup, 10)
+		}
+	}
+	hc.Privileged = sc.Privileged != nil && *sc.Privileged
+	hc.ReadonlyRootfs = sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+	if sc.Capabilities != nil {
+		hc.CapAdd = sc.Capabilities.Add
+		hc.CapDrop = sc.Capabilities.Drop
+	}
+
+	if sc.SeccompProfile == nil {
+		return nil
+	}
+	switch sc.SeccompProfile.Type {
+	case "RuntimeDefault":
+	case "Unconfined":
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp=unconfined")
+	case "Localhost":
+		path := filepath.Join(seccompDir, filepath.Clean("/"+sc.SeccompProfile.LocalhostProfile))
+		profile, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading seccomp profile failed: %v", err)
+		}
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp="+string(profile))
+	default:
+		return fmt.Errorf("unknown seccomp profile type %q", sc.SeccompProfile.Type)
+	}
+	return nil
+}
+
+// podResources sets the cgroup limits of the container the way the kubelet
+// does.
+func podResources(hc *containertypes.HostConfig, c PodContainer) error {
+	limits, requests := c.Resources.Limits, c.Resources.Requests
+
+	if v, ok := limits["memory"]; ok {
+		mem, err := parseQuantity(v)
+		if err != nil {
+			return fmt.Errorf("parsing memory limit failed: %v", err)
+		}
+		hc.Memory = int64(mem)
+		// pods do not swap
+		hc.MemorySwap = hc.Memory
+	}
+	if v, ok := requests["memory"]; ok {
+		mem, err := parseQuantity(v)
+		if err != nil {
+			return fmt.Errorf("parsing memory request failed: %v", err)
+		}
+		hc.MemoryReservation = int64(mem)
+	}
+
+	if v, ok := limits["cpu"]; ok {
+		cpu, err := parseQuantity(v)
+		if err != nil {
+			return fmt.Errorf("parsing cpu limit failed: %v", err)
+		}
+		milli := int64(math.Ceil(cpu * 1000))
+		hc.CPUPeriod = podCPUPeriod
+		hc.CPUQuota = milli * podCPUPeriod / 1000
+		if hc.CPUQuota < 1000 {
+			hc.CPUQuota = 1000
+		}
+		// the request defaults to the limit
+		if _, ok := requests["cpu"]; !ok {
+			hc.CPUShares = cpuShares(milli)
+		}
+	}
+	if v, ok := requests["cpu"]; ok {
+		cpu, err := parseQuantity(v)
+		if err != nil {
+			return fmt.Errorf("parsing cpu request failed: %v", err)
+		}
+		hc.CPUShares = cpuShares(int64(math.Ceil(cpu * 1000)))
+	}
+
+	return nil
+}
+
+func cpuShares(milli int64) int64 {
+	shares := milli * 1024 / 1000
+	if shares < 2 {
+		return 2
+	}
+	return shares
+}
+
+// podMounts adds the hostPath and emptyDir volumes the container mounts,
+// warning about the other volumes to log.
+func podMounts(ctr *types.ContainerJSON, volumes []PodVolume, c PodContainer, volumesDir string, log logrus.FieldLogger) error {
+	for _, vm := range c.VolumeMounts {
+		var v *PodVolume
+		for k := range volumes {
+			if volumes[k].Name == vm.Name {
+				v = &volumes[k]
+				break
+			}
+		}
+		if v == nil {
+			return fmt.Errorf("volume %s is not defined", vm.Name)
+		}
+
+		m := types.MountPoint{
+			Type:        mounttypes.TypeBind,
+			Name:        v.Name,
+			Destination: vm.MountPath,
+			RW:          !vm.ReadOnly,
+		}
+		// docker marks read-only mounts with the mode
+		if vm.ReadOnly {
+			m.Mode = "ro"
+		}
+		switch {
+		case v.HostPath != nil:
+			m.Source = v.HostPath.Path
+		case v.EmptyDir != nil:
+			m.Type = mounttypes.TypeVolume
+			m.Source = filepath.Join(volumesDir, v.Name)
+		default:
+			log.Warnf("Skipping volume %s of container %s, only hostPath and emptyDir volumes are supported", v.Name, c.Name)
+			continue
+		}
+
+		if vm.SubPath != "" {
+			if filepath.IsAbs(vm.SubPath) || strings.HasPrefix(filepath.Clean(vm.SubPath), "..") {
+				return fmt.Errorf("subPath %s of volume %s must be a relative path within the volume", vm.SubPath, v.Name)
+			}
+			m.Source = filepath.Join(m.Source, vm.SubPath)
+		}
+
+		ctr.Mounts = append(ctr.Mounts, m)
+	}
+	return nil
+}
+
+// parseQuantity parses a Kubernetes resource quantity, ex. 500m or 128Mi.
+func parseQuantity(s string) (float64, error) {
+	suffixes := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+		{"m", 1e-3}, {"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+	}
+
+	s = strings.TrimSpace(s)
+	multiplier := float64(1)
+	for _, suf := range suffixes {
+		if strings.HasSuffix(s, suf.suffix) {
+			s = strings.TrimSuffix(s, suf.suffix)
+			multiplier = suf.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n * multiplier, nil
+}
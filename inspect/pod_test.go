@@ -0,0 +1,186 @@
+package inspect
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+)
+
+const podManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  shareProcessNamespace: true
+  securityContext:
+    runAsUser: 1000
+    sysctls:
+    - name: net.core.somaxconn
+      value: "1024"
+  volumes:
+  - name: cache
+    emptyDir: {}
+  - name: logs
+    hostPath:
+      path: /var/log/web
+  containers:
+  - name: nginx
+    image: nginx:1.15
+    args: ["-g", "daemon off;"]
+    env:
+    - name: MODE
+      value: prod
+    - name: PATH
+      value: /custom
+    resources:
+      limits:
+        cpu: 500m
+        memory: 128Mi
+    securityContext:
+      runAsGroup: 1000
+      readOnlyRootFilesystem: true
+      capabilities:
+        drop: ["NET_RAW"]
+      seccompProfile:
+        type: Unconfined
+    volumeMounts:
+    - name: cache
+      mountPath: /var/cache/nginx
+    - name: logs
+      mountPath: /var/log/nginx
+      readOnly: true
+`
+
+func TestFromPod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-pod-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pod.yaml")
+	if err := ioutil.WriteFile(path, []byte(podManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pod, err := ReadPod(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrs, err := FromPod(pod, PodOptions{
+		VolumesDir: "/bundles/volumes",
+		ImageConfig: func(image string) (*containertypes.Config, error) {
+			if image != "nginx:1.15" {
+				return nil, errors.New("no such image")
+			}
+			return &containertypes.Config{
+				Entrypoint: []string{"nginx"},
+				Cmd:        []string{"-c", "/etc/nginx/nginx.conf"},
+				Env:        []string{"PATH=/bin"},
+				WorkingDir: "/srv",
+			}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctrs) != 2 {
+		t.Fatalf("expected the sandbox and 1 container, got %d", len(ctrs))
+	}
+
+	sandbox, ctr := ctrs[0], ctrs[1]
+	if sandbox.Name != "/"+PodSandbox || sandbox.Path != "/pause" || sandbox.Image != DefaultPauseImage {
+		t.Fatalf("unexpected sandbox %s running %s from %s", sandbox.Name, sandbox.Path, sandbox.Image)
+	}
+	if sandbox.HostConfig.Sysctls["net.core.somaxconn"] != "1024" {
+		t.Fatalf("expected the sandbox to get the sysctls, got %v", sandbox.HostConfig.Sysctls)
+	}
+
+	// the args replace the cmd of the image, but not the entrypoint
+	if ctr.Path != "nginx" || !reflect.DeepEqual(ctr.Args, []string{"-g", "daemon off;"}) {
+		t.Fatalf("unexpected process %s %v", ctr.Path, ctr.Args)
+	}
+	if !reflect.DeepEqual(ctr.Config.Env, []string{"PATH=/custom", "MODE=prod"}) {
+		t.Fatalf("unexpected env %v", ctr.Config.Env)
+	}
+	if ctr.Config.WorkingDir != "/srv" || ctr.Config.User != "1000:1000" || ctr.Config.Hostname != "web" {
+		t.Fatalf("unexpected config %#v", ctr.Config)
+	}
+
+	hc := ctr.HostConfig
+	share := "container:" + PodSandbox
+	if string(hc.NetworkMode) != share || string(hc.IpcMode) != share || string(hc.PidMode) != share {
+		t.Fatalf("expected the namespaces of the sandbox to be shared, got network=%q ipc=%q pid=%q", hc.NetworkMode, hc.IpcMode, hc.PidMode)
+	}
+	if !hc.ReadonlyRootfs || !reflect.DeepEqual([]string(hc.CapDrop), []string{"NET_RAW"}) || !reflect.DeepEqual(hc.SecurityOpt, []string{"seccomp=unconfined"}) {
+		t.Fatalf("security context was not applied: %#v", hc)
+	}
+	if hc.Memory != 128<<20 || hc.MemorySwap != hc.Memory || hc.CPUQuota != 50000 || hc.CPUPeriod != 100000 || hc.CPUShares != 512 {
+		t.Fatalf("unexpected resources memory=%d swap=%d quota=%d period=%d shares=%d", hc.Memory, hc.MemorySwap, hc.CPUQuota, hc.CPUPeriod, hc.CPUShares)
+	}
+
+	if len(ctr.Mounts) != 2 {
+		t.Fatalf("expected 2 mounts, got %d", len(ctr.Mounts))
+	}
+	if m := ctr.Mounts[0]; m.Source != "/bundles/volumes/cache" || !m.RW {
+		t.Fatalf("unexpected emptyDir mount %#v", m)
+	}
+	if m := ctr.Mounts[1]; m.Source != "/var/log/web" || m.RW || m.Mode != "ro" {
+		t.Fatalf("unexpected hostPath mount %#v", m)
+	}
+}
+
+func TestFromPodVolumeNames(t *testing.T) {
+	tests := map[string]bool{
+		"cache":                 true,
+		"web-cache-1":           true,
+		"../../etc":             false,
+		"Cache":                 false,
+		"a/b":                   false,
+		"":                      false,
+		"-cache":                false,
+		strings.Repeat("a", 64): false,
+	}
+	for name, valid := range tests {
+		pod := &Pod{}
+		pod.Spec.Containers = []PodContainer{{Name: "web", Image: "nginx", Command: []string{"nginx"}}}
+		pod.Spec.Volumes = []PodVolume{{Name: name}}
+		_, err := FromPod(pod, PodOptions{VolumesDir: "/bundles/volumes"})
+		if valid && err != nil {
+			t.Fatalf("expected volume name %q to be valid, got %v", name, err)
+		}
+		if !valid && err == nil {
+			t.Fatalf("expected volume name %q to be rejected", name)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := map[string]float64{
+		"500m":  0.5,
+		"2":     2,
+		"1.5":   1.5,
+		"128Mi": 128 << 20,
+		"1G":    1e9,
+		"1e3":   1000,
+	}
+	for in, expected := range tests {
+		n, err := parseQuantity(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Fatalf("expected %s to be %f, got %f", in, expected, n)
+		}
+	}
+
+	if _, err := parseQuantity("lots"); err == nil {
+		t.Fatal("expected an error parsing an invalid quantity")
+	}
+}
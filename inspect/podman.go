@@ -0,0 +1,259 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// podmanKeys are fields only `podman inspect` prints, used to tell its
+// output apart from the output of `docker inspect`.
+var podmanKeys = []string{"OCIRuntime", "OCIConfigPath", "ConmonPidFile"}
+
+// podmanContainer holds the `podman inspect` data of a container. Most of it
+// matches the docker types, only the fields that differ are overridden.
+type podmanContainer struct {
+	*types.ContainerJSONBase
+	Mounts          []types.MountPoint
+	NetworkSettings *types.NetworkSettings
+	Config          *podmanConfig
+	HostConfig      *podmanHostConfig
+}
+
+type podmanConfig struct {
+	containertypes.Config
+	// older versions of podman print the stop signal as a number
+	StopSignal json.RawMessage
+}
+
+type podmanHostConfig struct {
+	containertypes.HostConfig
+	// IDMappings holds the mappings of the user namespace, formatted as
+	// container_id:host_id:size
+	IDMappings *struct {
+		UIDMap []string `json:"UidMap"`
+		GIDMap []string `json:"GidMap"`
+	}
+}
+
+// PodmanContainer is a container read from the output of `podman inspect`.
+// The parts podman supports that the docker inspect data cannot express are
+// kept separately and added to the spec by Apply.
+type PodmanContainer struct {
+	types.ContainerJSON
+	// UIDMappings and GIDMappings are the mappings of the user namespace,
+	// the container does not get one without them.
+	UIDMappings []specs.LinuxIDMapping
+	GIDMappings []specs.LinuxIDMapping
+	// NamespacePaths are the paths of existing namespaces to join.
+	NamespacePaths map[specs.LinuxNamespaceType]string
+}
+
+// IsPodman reports whether the inspect output in data was printed by
+// `podman inspect`.
+func IsPodman(data []byte) bool {
+	entries, err := readEntries(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entries[0], &fields); err != nil {
+		return false
+	}
+	for _, k := range podmanKeys {
+		if _, ok := fields[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodePodman reads the output of `podman inspect` from r and turns it into
+// the docker inspect data, so it can be converted the same way. The warnings
+// about the input go to log.
+func DecodePodman(r io.Reader, log logrus.FieldLogger) ([]PodmanContainer, error) {
+	entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctrs []PodmanContainer
+	for i, entry := range entries {
+		var pc podmanContainer
+		if err := json.Unmarshal(entry, &pc); err != nil {
+			return nil, fmt.Errorf("decoding podman inspect entry %d failed: %v", i, err)
+		}
+
+		// make sure every entry has the fields parse.Config relies on
+		if pc.ContainerJSONBase == nil || pc.HostConfig == nil || pc.Config == nil {
+			return nil, fmt.Errorf("podman inspect entry %d is missing the container, host or config fields", i)
+		}
+
+		ctr, err := pc.convert(log)
+		if err != nil {
+			return nil, fmt.Errorf("converting podman inspect entry %d failed: %v", i, err)
+		}
+		ctrs = append(ctrs, ctr)
+	}
+
+	return ctrs, nil
+}
+
+// convert maps the podman fields onto the docker ones.
+func (pc podmanContainer) convert(log logrus.FieldLogger) (PodmanContainer, error) {
+	config := pc.Config.Config
+	signal, err := podmanStopSignal(pc.Config.StopSignal)
+	if err != nil {
+		return PodmanContainer{}, err
+	}
+	config.StopSignal = signal
+
+	hc := pc.HostConfig.HostConfig
+	base := *pc.ContainerJSONBase
+	base.HostConfig = &hc
+
+	// podman does not prefix the names with a slash like docker
+	if base.Name != "" && !strings.HasPrefix(base.Name, "/") {
+		base.Name = "/" + base.Name
+	}
+
+	ctr := PodmanContainer{
+		ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &base,
+			Mounts:            pc.Mounts,
+			Config:            &config,
+			NetworkSettings:   pc.NetworkSettings,
+		},
+		NamespacePaths: map[specs.LinuxNamespaceType]string{},
+	}
+
+	// podman has modes docker does not know about, only keep the ones
+	// parse.Config understands and move the namespace paths out
+	hc.NetworkMode = containertypes.NetworkMode(ctr.namespaceMode(specs.NetworkNamespace, string(hc.NetworkMode)))
+	if hc.NetworkMode == "" {
+		hc.NetworkMode = "default"
+	}
+	hc.IpcMode = containertypes.IpcMode(ctr.namespaceMode(specs.IPCNamespace, string(hc.IpcMode)))
+	hc.PidMode = containertypes.PidMode(ctr.namespaceMode(specs.PIDNamespace, string(hc.PidMode)))
+	hc.UTSMode = containertypes.UTSMode(ctr.namespaceMode(specs.UTSNamespace, string(hc.UTSMode)))
+	// keep-id and auto end up as mappings, which are applied separately
+	hc.UsernsMode = containertypes.UsernsMode(ctr.namespaceMode(specs.UserNamespace, string(hc.UsernsMode)))
+	if hc.UsernsMode != "host" {
+		hc.UsernsMode = ""
+	}
+
+	if pc.HostConfig.IDMappings != nil {
+		if ctr.UIDMappings, err = parsePodmanIDMappings(pc.HostConfig.IDMappings.UIDMap); err != nil {
+			return PodmanContainer{}, err
+		}
+		if ctr.GIDMappings, err = parsePodmanIDMappings(pc.HostConfig.IDMappings.GIDMap); err != nil {
+			return PodmanContainer{}, err
+		}
+	}
+
+	// podman uses the names of the constants, ex. RLIMIT_NOFILE
+	hc.Ulimits = nil
+	for _, u := range pc.HostConfig.Ulimits {
+		ul := *u
+		ul.Name = strings.ToLower(strings.TrimPrefix(ul.Name, "RLIMIT_"))
+		hc.Ulimits = append(hc.Ulimits, &ul)
+	}
+
+	// keep-groups keeps the groups of the user running podman, it is not a group
+	hc.GroupAdd = nil
+	for _, g := range pc.HostConfig.GroupAdd {
+		if g != "keep-groups" {
+			hc.GroupAdd = append(hc.GroupAdd, g)
+		}
+	}
+
+	hc.SecurityOpt = nil
+	for _, opt := range pc.HostConfig.SecurityOpt {
+		switch strings.SplitN(strings.SplitN(opt, "=", 2)[0], ":", 2)[0] {
+		case "label", "apparmor", "seccomp":
+			hc.SecurityOpt = append(hc.SecurityOpt, opt)
+		default:
+			log.Warnf("Ignoring podman security option %q of %s", opt, base.Name)
+		}
+	}
+
+	return ctr, nil
+}
+
+// namespaceMode turns the podman namespace mode into a docker one. The path
+// of an existing namespace to join is saved in the NamespacePaths.
+func (c *PodmanContainer) namespaceMode(t specs.LinuxNamespaceType, mode string) string {
+	switch {
+	case strings.HasPrefix(mode, "ns:"):
+		c.NamespacePaths[t] = strings.TrimPrefix(mode, "ns:")
+		return ""
+	case mode == "host", mode == "none", strings.HasPrefix(mode, "container:"):
+		return mode
+	default:
+		// private, shareable, bridge, slirp4netns, pasta and friends all
+		// give the container a namespace of its own
+		return ""
+	}
+}
+
+// Apply adds the parts of the podman container that parse.Config does not
+// know about to the spec. Without id mappings the user namespace is left to
+// parse.Config.
+func (c PodmanContainer) Apply(config *specs.Spec) {
+	if c.HostConfig.UsernsMode != "host" && (len(c.UIDMappings) > 0 || len(c.GIDMappings) > 0) {
+		parse.UserNamespace(config, c.UIDMappings, c.GIDMappings)
+	}
+	for t, path := range c.NamespacePaths {
+		parse.NamespacePath(config, t, path)
+	}
+}
+
+func podmanStopSignal(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var signal string
+	if err := json.Unmarshal(raw, &signal); err == nil {
+		return signal, nil
+	}
+	var n uint
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", fmt.Errorf("decoding stop signal %s failed: %v", raw, err)
+	}
+	return strconv.FormatUint(uint64(n), 10), nil
+}
+
+func parsePodmanIDMappings(mappings []string) ([]specs.LinuxIDMapping, error) {
+	var ids []specs.LinuxIDMapping
+	for _, m := range mappings {
+		parts := strings.Split(m, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("parsing id mapping %s as container_id:host_id:size failed", m)
+		}
+		var nums [3]uint32
+		for i, p := range parts {
+			n, err := strconv.ParseUint(p, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("parsing id mapping %s failed: %v", m, err)
+			}
+			nums[i] = uint32(n)
+		}
+		ids = append(ids, specs.LinuxIDMapping{
+			ContainerID: nums[0],
+			HostID:      nums[1],
+			Size:        nums[2],
+		})
+	}
+	return ids, nil
+}
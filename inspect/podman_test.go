@@ -0,0 +1,134 @@
+package inspect
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const podmanInspect = `[
+    {
+        "Id": "3c5a0e3bc8c9f4b0a0b5e2a4d6c7e9f1a2b3c4d5e6f708192a3b4c5d6e7f8091",
+        "Path": "nginx",
+        "Args": ["-g", "daemon off;"],
+        "State": {"OciVersion": "1.0.2-dev", "Status": "running", "Running": true, "Pid": 4242},
+        "Image": "605c77e624ddb75e6110f997c58876baa13f8754486b461117934b24a9dc3a85",
+        "ImageName": "docker.io/library/nginx:latest",
+        "OCIConfigPath": "/home/user/.local/share/containers/storage/overlay-containers/3c5a/userdata/config.json",
+        "OCIRuntime": "crun",
+        "ConmonPidFile": "/run/user/1000/containers/overlay-containers/3c5a/userdata/conmon.pid",
+        "Name": "web",
+        "Mounts": [],
+        "Config": {
+            "Hostname": "3c5a0e3bc8c9",
+            "Env": ["PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"],
+            "Cmd": ["nginx", "-g", "daemon off;"],
+            "Entrypoint": "/docker-entrypoint.sh",
+            "StopSignal": 3
+        },
+        "HostConfig": {
+            "NetworkMode": "slirp4netns",
+            "IpcMode": "shareable",
+            "PidMode": "private",
+            "UTSMode": "ns:/run/user/1000/netns/uts",
+            "UsernsMode": "keep-id",
+            "IDMappings": {
+                "UidMap": ["0:1:1000", "1000:0:1", "1001:1001:64536"],
+                "GidMap": ["0:1:1000", "1000:0:1"]
+            },
+            "Sysctls": {"net.ipv4.ping_group_range": "0 0"},
+            "GroupAdd": ["keep-groups"],
+            "SecurityOpt": ["label=disable", "unmask=ALL"],
+            "Ulimits": [{"Name": "RLIMIT_NOFILE", "Soft": 1024, "Hard": 4096}]
+        }
+    }
+]`
+
+func TestIsPodman(t *testing.T) {
+	if !IsPodman([]byte(podmanInspect)) {
+		t.Fatal("expected podman inspect output to be detected")
+	}
+	if IsPodman([]byte(`{"Id": "abc", "Name": "/one", "HostConfig": {}, "Config": {}}`)) {
+		t.Fatal("expected docker inspect output not to be detected as podman")
+	}
+}
+
+func TestDecodePodman(t *testing.T) {
+	ctrs, err := DecodePodman(strings.NewReader(podmanInspect), logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctrs) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(ctrs))
+	}
+	ctr := ctrs[0]
+
+	if ctr.Name != "/web" {
+		t.Fatalf("expected name /web, got %s", ctr.Name)
+	}
+	if ctr.Config.StopSignal != "3" {
+		t.Fatalf("expected stop signal 3, got %s", ctr.Config.StopSignal)
+	}
+
+	hc := ctr.HostConfig
+	if hc.NetworkMode != "default" || hc.IpcMode != "" || hc.PidMode != "" || hc.UTSMode != "" || hc.UsernsMode != "" {
+		t.Fatalf("expected private namespace modes, got network=%q ipc=%q pid=%q uts=%q userns=%q", hc.NetworkMode, hc.IpcMode, hc.PidMode, hc.UTSMode, hc.UsernsMode)
+	}
+	if hc.Sysctls["net.ipv4.ping_group_range"] != "0 0" {
+		t.Fatalf("expected sysctls to be kept, got %v", hc.Sysctls)
+	}
+	if len(hc.GroupAdd) != 0 {
+		t.Fatalf("expected keep-groups to be dropped, got %v", hc.GroupAdd)
+	}
+	if !reflect.DeepEqual(hc.SecurityOpt, []string{"label=disable"}) {
+		t.Fatalf("expected only the label security option, got %v", hc.SecurityOpt)
+	}
+	if len(hc.Ulimits) != 1 || hc.Ulimits[0].Name != "nofile" {
+		t.Fatalf("expected a nofile ulimit, got %v", hc.Ulimits)
+	}
+
+	uids := []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 1, Size: 1000},
+		{ContainerID: 1000, HostID: 0, Size: 1},
+		{ContainerID: 1001, HostID: 1001, Size: 64536},
+	}
+	if !reflect.DeepEqual(ctr.UIDMappings, uids) {
+		t.Fatalf("expected uid mappings %v, got %v", uids, ctr.UIDMappings)
+	}
+	if len(ctr.GIDMappings) != 2 {
+		t.Fatalf("expected 2 gid mappings, got %v", ctr.GIDMappings)
+	}
+	if ctr.NamespacePaths[specs.UTSNamespace] != "/run/user/1000/netns/uts" {
+		t.Fatalf("expected the uts namespace path, got %v", ctr.NamespacePaths)
+	}
+
+	config := &specs.Spec{Linux: &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{{Type: specs.UTSNamespace}},
+	}}
+	ctr.Apply(config)
+	if !reflect.DeepEqual(config.Linux.UIDMappings, uids) {
+		t.Fatalf("expected the spec to get uid mappings %v, got %v", uids, config.Linux.UIDMappings)
+	}
+	expected := []specs.LinuxNamespace{
+		{Type: specs.UTSNamespace, Path: "/run/user/1000/netns/uts"},
+		{Type: specs.UserNamespace},
+	}
+	if !reflect.DeepEqual(config.Linux.Namespaces, expected) {
+		t.Fatalf("expected namespaces %v, got %v", expected, config.Linux.Namespaces)
+	}
+
+	// without mappings the user namespace of the spec stays
+	ctr.UIDMappings, ctr.GIDMappings = nil, nil
+	config = &specs.Spec{Linux: &specs.Linux{
+		Namespaces:  []specs.LinuxNamespace{{Type: specs.UserNamespace}},
+		UIDMappings: uids,
+	}}
+	ctr.Apply(config)
+	if !reflect.DeepEqual(config.Linux.UIDMappings, uids) || !parse.HasNamespace(config, specs.UserNamespace) {
+		t.Fatalf("expected the user namespace to stay, got %v and %v", config.Linux.Namespaces, config.Linux.UIDMappings)
+	}
+}
@@ -0,0 +1,1211 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+	"github.com/genuinetools/riddler/parse"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// validVolumeChars are the characters docker allows in the name of a
+	// local volume.
+	validVolumeChars = `[a-zA-Z0-9][a-zA-Z0-9_.-]`
+)
+
+var validVolumeName = regexp.MustCompile(`^` + validVolumeChars + `*$`)
+
+// RunOptions are the settings for converting a `docker run` command line
+// that the command line does not hold.
+type RunOptions struct {
+	// VolumesDir is the directory holding the named and anonymous volumes.
+	VolumesDir string
+	// ImageConfig returns the config of the image, used for the defaults
+	// the command line does not set. It can be nil.
+	ImageConfig func(image string) (*containertypes.Config, error)
+	// Log gets the warnings of the conversion. It can be nil, they go to
+	// the standard logger then.
+	Log logrus.FieldLogger
+}
+
+// logger returns log, or the standard logger if it is nil.
+func logger(log logrus.FieldLogger) logrus.FieldLogger {
+	if log == nil {
+		return logrus.StandardLogger()
+	}
+	return log
+}
+
+// runFlag is a flag of `docker run`. Flags without a set func are accepted
+// but do not change anything the spec is made from.
+type runFlag struct {
+	long   string
+	short  string
+	isBool bool
+	set    func(v string) error
+}
+
+// runOptions holds the flags that cannot be set on the config or the host
+// config right away.
+type runOptions struct {
+	attach, capAdd, capDrop, env, envFiles, labels, labelFiles []string
+	volumes, mounts, tmpfs, publish, expose, ulimits, security []string
+	entrypoint                                                 *string
+	detach, noHealthcheck                                      bool
+	healthCmd, healthInterval, healthTimeout, healthStart      string
+	healthRetries                                              int64
+	memorySwappiness                                           int64
+	name, restart                                              string
+}
+
+// ParseRunArgs parses the flags of a `docker run` or `docker create`
+// command line into the config and host config docker would create the
+// container with. The command line may start with `docker run`, `docker
+// container run` or just `run`. Like docker only what the command line sets
+// is filled in, nothing comes from the image.
+func ParseRunArgs(args []string) (*containertypes.Config, *containertypes.HostConfig, error) {
+	config, hc, _, err := parseRunArgs(args)
+	return config, hc, err
+}
+
+// parseRunArgs is ParseRunArgs, also returning the --name of the container,
+// which docker keeps out of the config.
+func parseRunArgs(args []string) (*containertypes.Config, *containertypes.HostConfig, string, error) {
+	args, err := trimRunCommand(args)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	config := &containertypes.Config{
+		ExposedPorts: nat.PortSet{},
+		Labels:       map[string]string{},
+		Volumes:      map[string]struct{}{},
+	}
+	hc := &containertypes.HostConfig{
+		NetworkMode: "default",
+		LogConfig:   containertypes.LogConfig{Config: map[string]string{}},
+		Sysctls:     map[string]string{},
+		Tmpfs:       map[string]string{},
+		StorageOpt:  map[string]string{},
+	}
+	o := &runOptions{memorySwappiness: -1}
+
+	var (
+		oomKillDisable, init bool
+		stopTimeout          int64
+	)
+	flags := []runFlag{
+		{long: "add-host", set: appendTo(&hc.ExtraHosts)},
+		{long: "attach", short: "a", set: appendTo(&o.attach)},
+		{long: "blkio-weight", set: func(v string) error {
+			n, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return err
+			}
+			if n != 0 && (n < 10 || n > 1000) {
+				return errors.New("range is from 10 to 1000")
+			}
+			hc.BlkioWeight = uint16(n)
+			return nil
+		}},
+		{long: "blkio-weight-device", set: func(v string) error {
+			d, err := parseWeightDevice(v)
+			if err != nil {
+				return err
+			}
+			hc.BlkioWeightDevice = append(hc.BlkioWeightDevice, d)
+			return nil
+		}},
+		{long: "cap-add", set: appendTo(&o.capAdd)},
+		{long: "cap-drop", set: appendTo(&o.capDrop)},
+		{long: "cgroup-parent", set: setString(&hc.CgroupParent)},
+		{long: "cidfile", set: setString(&hc.ContainerIDFile)},
+		{long: "cpu-count", set: setInt(&hc.CPUCount)},
+		{long: "cpu-percent", set: setInt(&hc.CPUPercent)},
+		{long: "cpu-period", set: setInt(&hc.CPUPeriod)},
+		{long: "cpu-quota", set: setInt(&hc.CPUQuota)},
+		{long: "cpu-rt-period", set: setInt(&hc.CPURealtimePeriod)},
+		{long: "cpu-rt-runtime", set: setInt(&hc.CPURealtimeRuntime)},
+		{long: "cpu-shares", short: "c", set: setInt(&hc.CPUShares)},
+		{long: "cpus", set: func(v string) (err error) {
+			hc.NanoCPUs, err = parseCPUs(v)
+			return err
+		}},
+		{long: "cpuset-cpus", set: setString(&hc.CpusetCpus)},
+		{long: "cpuset-mems", set: setString(&hc.CpusetMems)},
+		{long: "detach", short: "d", isBool: true, set: setBool(&o.detach)},
+		{long: "detach-keys"},
+		{long: "device", set: func(v string) error {
+			d, err := parseDevice(v)
+			if err != nil {
+				return err
+			}
+			hc.Devices = append(hc.Devices, d)
+			return nil
+		}},
+		{long: "device-cgroup-rule", set: appendTo(&hc.DeviceCgroupRules)},
+		{long: "device-read-bps", set: throttleDevice(&hc.BlkioDeviceReadBps, true)},
+		{long: "device-read-iops", set: throttleDevice(&hc.BlkioDeviceReadIOps, false)},
+		{long: "device-write-bps", set: throttleDevice(&hc.BlkioDeviceWriteBps, true)},
+		{long: "device-write-iops", set: throttleDevice(&hc.BlkioDeviceWriteIOps, false)},
+		{long: "disable-content-trust", isBool: true},
+		{long: "dns", set: appendTo(&hc.DNS)},
+		{long: "dns-opt", set: appendTo(&hc.DNSOptions)},
+		{long: "dns-option", set: appendTo(&hc.DNSOptions)},
+		{long: "dns-search", set: appendTo(&hc.DNSSearch)},
+		{long: "domainname", set: setString(&config.Domainname)},
+		{long: "entrypoint", set: func(v string) error {
+			o.entrypoint = &v
+			return nil
+		}},
+		{long: "env", short: "e", set: appendTo(&o.env)},
+		{long: "env-file", set: appendTo(&o.envFiles)},
+		{long: "expose", set: appendTo(&o.expose)},
+		{long: "group-add", set: appendTo(&hc.GroupAdd)},
+		{long: "health-cmd", set: setString(&o.healthCmd)},
+		{long: "health-interval", set: setString(&o.healthInterval)},
+		{long: "health-retries", set: setInt(&o.healthRetries)},
+		{long: "health-start-period", set: setString(&o.healthStart)},
+		{long: "health-timeout", set: setString(&o.healthTimeout)},
+		{long: "hostname", short: "h", set: setString(&config.Hostname)},
+		{long: "init", isBool: true, set: func(v string) error {
+			if err := setBool(&init)(v); err != nil {
+				return err
+			}
+			hc.Init = &init
+			return nil
+		}},
+		{long: "interactive", short: "i", isBool: true, set: setBool(&config.OpenStdin)},
+		{long: "io-maxbandwidth", set: func(v string) error {
+			n, err := units.RAMInBytes(v)
+			if err != nil {
+				return err
+			}
+			hc.IOMaximumBandwidth = uint64(n)
+			return nil
+		}},
+		{long: "io-maxiops", set: func(v string) (err error) {
+			hc.IOMaximumIOps, err = strconv.ParseUint(v, 10, 64)
+			return err
+		}},
+		{long: "ip"},
+		{long: "ip6"},
+		{long: "ipc", set: func(v string) error {
+			hc.IpcMode = containertypes.IpcMode(v)
+			return nil
+		}},
+		{long: "isolation", set: func(v string) error {
+			hc.Isolation = containertypes.Isolation(v)
+			return nil
+		}},
+		{long: "kernel-memory", set: setBytes(&hc.KernelMemory)},
+		{long: "label", short: "l", set: appendTo(&o.labels)},
+		{long: "label-file", set: appendTo(&o.labelFiles)},
+		{long: "link", set: appendTo(&hc.Links)},
+		{long: "link-local-ip"},
+		{long: "log-driver", set: setString(&hc.LogConfig.Type)},
+		{long: "log-opt", set: setMap(hc.LogConfig.Config)},
+		{long: "mac-address", set: setString(&config.MacAddress)},
+		{long: "memory", short: "m", set: setBytes(&hc.Memory)},
+		{long: "memory-reservation", set: setBytes(&hc.MemoryReservation)},
+		{long: "memory-swap", set: func(v string) error {
+			// -1 is unlimited swap
+			if v == "-1" {
+				hc.MemorySwap = -1
+				return nil
+			}
+			return setBytes(&hc.MemorySwap)(v)
+		}},
+		{long: "memory-swappiness", set: setInt(&o.memorySwappiness)},
+		{long: "mount", set: appendTo(&o.mounts)},
+		{long: "name", set: setString(&o.name)},
+		{long: "net", set: setNetwork(hc)},
+		{long: "net-alias"},
+		{long: "network", set: setNetwork(hc)},
+		{long: "network-alias"},
+		{long: "no-healthcheck", isBool: true, set: setBool(&o.noHealthcheck)},
+		{long: "oom-kill-disable", isBool: true, set: func(v string) error {
+			if err := setBool(&oomKillDisable)(v); err != nil {
+				return err
+			}
+			hc.OomKillDisable = &oomKillDisable
+			return nil
+		}},
+		{long: "oom-score-adj", set: func(v string) (err error) {
+			hc.OomScoreAdj, err = strconv.Atoi(v)
+			return err
+		}},
+		{long: "pid", set: func(v string) error {
+			hc.PidMode = containertypes.PidMode(v)
+			return nil
+		}},
+		{long: "pids-limit", set: setInt(&hc.PidsLimit)},
+		{long: "platform"},
+		{long: "privileged", isBool: true, set: setBool(&hc.Privileged)},
+		{long: "publish", short: "p", set: appendTo(&o.publish)},
+		{long: "publish-all", short: "P", isBool: true, set: setBool(&hc.PublishAllPorts)},
+		{long: "pull"},
+		{long: "read-only", isBool: true, set: setBool(&hc.ReadonlyRootfs)},
+		{long: "restart", set: setString(&o.restart)},
+		{long: "rm", isBool: true, set: setBool(&hc.AutoRemove)},
+		{long: "runtime", set: setString(&hc.Runtime)},
+		{long: "security-opt", set: appendTo(&o.security)},
+		{long: "shm-size", set: setBytes(&hc.ShmSize)},
+		{long: "sig-proxy", isBool: true},
+		{long: "stop-signal", set: setString(&config.StopSignal)},
+		{long: "stop-timeout", set: func(v string) error {
+			if err := setInt(&stopTimeout)(v); err != nil {
+				return err
+			}
+			t := int(stopTimeout)
+			config.StopTimeout = &t
+			return nil
+		}},
+		{long: "storage-opt", set: setMap(hc.StorageOpt)},
+		{long: "sysctl", set: setMap(hc.Sysctls)},
+		{long: "tmpfs", set: appendTo(&o.tmpfs)},
+		{long: "tty", short: "t", isBool: true, set: setBool(&config.Tty)},
+		{long: "ulimit", set: appendTo(&o.ulimits)},
+		{long: "user", short: "u", set: setString(&config.User)},
+		{long: "userns", set: func(v string) error {
+			hc.UsernsMode = containertypes.UsernsMode(v)
+			return nil
+		}},
+		{long: "uts", set: func(v string) error {
+			hc.UTSMode = containertypes.UTSMode(v)
+			return nil
+		}},
+		{long: "volume", short: "v", set: appendTo(&o.volumes)},
+		{long: "volume-driver", set: setString(&hc.VolumeDriver)},
+		{long: "volumes-from", set: appendTo(&hc.VolumesFrom)},
+		{long: "workdir", short: "w", set: setString(&config.WorkingDir)},
+	}
+
+	rest, err := parseRunFlags(args, flags)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(rest) < 1 {
+		return nil, nil, "", errors.New("the command line has no image")
+	}
+	config.Image = rest[0]
+	if len(rest) > 1 {
+		config.Cmd = strslice.StrSlice(rest[1:])
+	}
+	if o.entrypoint != nil {
+		// an empty entrypoint resets the one of the image
+		config.Entrypoint = strslice.StrSlice{*o.entrypoint}
+	}
+
+	if err := o.apply(config, hc); err != nil {
+		return nil, nil, "", err
+	}
+	return config, hc, strings.TrimPrefix(o.name, "/"), nil
+}
+
+// apply sets the flags that need more work than parsing their value.
+func (o *runOptions) apply(config *containertypes.Config, hc *containertypes.HostConfig) error {
+	if o.detach && len(o.attach) > 0 {
+		return errors.New("conflicting options: --attach and --detach")
+	}
+	for _, a := range o.attach {
+		switch strings.ToLower(a) {
+		case "stdin":
+			config.AttachStdin = true
+		case "stdout":
+			config.AttachStdout = true
+		case "stderr":
+			config.AttachStderr = true
+		default:
+			return fmt.Errorf("invalid argument %q for --attach, valid streams are STDIN, STDOUT and STDERR", a)
+		}
+	}
+	if !o.detach && len(o.attach) == 0 {
+		config.AttachStdout = true
+		config.AttachStderr = true
+		config.AttachStdin = config.OpenStdin
+	}
+	if config.AttachStdin && config.OpenStdin {
+		config.StdinOnce = true
+	}
+
+	hc.CapAdd = strslice.StrSlice(o.capAdd)
+	hc.CapDrop = strslice.StrSlice(o.capDrop)
+
+	// the env files come first, so the --env flags win
+	for _, f := range o.envFiles {
+		env, err := readEnvFile(f, true)
+		if err != nil {
+			return err
+		}
+		config.Env = append(config.Env, env...)
+	}
+	for _, e := range o.env {
+		if e = envValue(e, true); e != "" {
+			config.Env = append(config.Env, e)
+		}
+	}
+
+	var labels []string
+	for _, f := range o.labelFiles {
+		l, err := readEnvFile(f, false)
+		if err != nil {
+			return err
+		}
+		labels = append(labels, l...)
+	}
+	for _, l := range append(labels, o.labels...) {
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		config.Labels[parts[0]] = parts[1]
+	}
+
+	ports, bindings, err := nat.ParsePortSpecs(o.publish)
+	if err != nil {
+		return fmt.Errorf("parsing --publish failed: %v", err)
+	}
+	config.ExposedPorts = nat.PortSet(ports)
+	if len(bindings) > 0 {
+		hc.PortBindings = bindings
+	}
+	for _, e := range o.expose {
+		if strings.Contains(e, ":") {
+			return fmt.Errorf("invalid argument %q for --expose, only the container port can be exposed", e)
+		}
+		proto, port := nat.SplitProtoPort(e)
+		start, end, err := nat.ParsePortRange(port)
+		if err != nil {
+			return fmt.Errorf("parsing --expose %s failed: %v", e, err)
+		}
+		for i := start; i <= end; i++ {
+			p, err := nat.NewPort(proto, strconv.FormatUint(i, 10))
+			if err != nil {
+				return err
+			}
+			config.ExposedPorts[p] = struct{}{}
+		}
+	}
+
+	for _, v := range o.volumes {
+		if err := parseVolume(v, config, hc); err != nil {
+			return err
+		}
+	}
+	for _, m := range o.mounts {
+		mount, err := parseMount(m)
+		if err != nil {
+			return fmt.Errorf("parsing --mount %s failed: %v", m, err)
+		}
+		hc.Mounts = append(hc.Mounts, mount)
+	}
+	for _, t := range o.tmpfs {
+		parts := strings.SplitN(t, ":", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		if !path.IsAbs(parts[0]) {
+			return fmt.Errorf("invalid argument %q for --tmpfs, the path has to be absolute", t)
+		}
+		hc.Tmpfs[parts[0]] = parts[1]
+	}
+
+	for _, u := range o.ulimits {
+		ulimit, err := units.ParseUlimit(u)
+		if err != nil {
+			return fmt.Errorf("parsing --ulimit %s failed: %v", u, err)
+		}
+		hc.Ulimits = append(hc.Ulimits, ulimit)
+	}
+
+	for _, opt := range o.security {
+		opt, err := securityOpt(opt)
+		if err != nil {
+			return err
+		}
+		hc.SecurityOpt = append(hc.SecurityOpt, opt)
+	}
+
+	if o.memorySwappiness != -1 {
+		if o.memorySwappiness < 0 || o.memorySwappiness > 100 {
+			return fmt.Errorf("invalid argument %d for --memory-swappiness, range is from 0 to 100", o.memorySwappiness)
+		}
+		hc.MemorySwappiness = &o.memorySwappiness
+	}
+
+	if o.restart != "" {
+		policy, err := parseRestartPolicy(o.restart)
+		if err != nil {
+			return err
+		}
+		hc.RestartPolicy = policy
+	}
+
+	return o.healthcheck(config)
+}
+
+// healthcheck sets the healthcheck of the --health-* flags.
+func (o *runOptions) healthcheck(config *containertypes.Config) error {
+	set := o.healthCmd != "" || o.healthInterval != "" || o.healthTimeout != "" || o.healthStart != "" || o.healthRetries != 0
+	if o.noHealthcheck {
+		if set {
+			return errors.New("--no-healthcheck conflicts with the --health-* options")
+		}
+		config.Healthcheck = &containertypes.HealthConfig{Test: []string{"NONE"}}
+		return nil
+	}
+	if !set {
+		return nil
+	}
+
+	hc := &containertypes.HealthConfig{Retries: int(o.healthRetries)}
+	if o.healthCmd != "" {
+		hc.Test = []string{"CMD-SHELL", o.healthCmd}
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"health-interval", o.healthInterval, &hc.Interval},
+		{"health-timeout", o.healthTimeout, &hc.Timeout},
+		{"health-start-period", o.healthStart, &hc.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid argument %q for --%s: %v", d.value, d.name, err)
+		}
+		if v < 0 {
+			return fmt.Errorf("--%s cannot be negative", d.name)
+		}
+		*d.to = v
+	}
+	if hc.Retries < 0 {
+		return errors.New("--health-retries cannot be negative")
+	}
+	config.Healthcheck = hc
+	return nil
+}
+
+// FromRunArgs builds the docker inspect data of the container a `docker
+// run` command line would create, without creating it. What the command
+// line leaves out comes from the image, if the daemon has it. Named and
+// anonymous volumes are bind mounted from directories below VolumesDir,
+// which the caller is expected to create.
+func FromRunArgs(args []string, opts RunOptions) (types.ContainerJSON, error) {
+	config, hc, name, err := parseRunArgs(args)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	img := &containertypes.Config{}
+	if opts.ImageConfig != nil {
+		c, err := opts.ImageConfig(config.Image)
+		switch {
+		case err == nil:
+			img = c
+		case len(config.Cmd) == 0 && config.Entrypoint == nil:
+			return types.ContainerJSON{}, fmt.Errorf("getting the command of image %s failed: %v", config.Image, err)
+		default:
+			logger(opts.Log).Warnf("Getting the config of image %s failed, using the defaults: %v", config.Image, err)
+		}
+	}
+
+	// like docker, a new entrypoint drops the cmd of the image
+	entrypoint := []string(img.Entrypoint)
+	cmd := []string(img.Cmd)
+	if config.Entrypoint != nil {
+		entrypoint = nil
+		if config.Entrypoint[0] != "" {
+			entrypoint = config.Entrypoint
+		}
+		cmd = nil
+	}
+	if len(config.Cmd) > 0 {
+		cmd = config.Cmd
+	}
+	process := append(append([]string{}, entrypoint...), cmd...)
+	if len(process) == 0 {
+		return types.ContainerJSON{}, errors.New("no command for the container")
+	}
+
+	env := append([]string{}, img.Env...)
+	if len(env) == 0 {
+		env = append(env, parse.DefaultTerminalEnv...)
+	}
+	config.Env = mergeEnv(env, config.Env)
+	labels := config.Labels
+	config.Labels = map[string]string{}
+	for k, v := range img.Labels {
+		config.Labels[k] = v
+	}
+	for k, v := range labels {
+		config.Labels[k] = v
+	}
+	for port := range img.ExposedPorts {
+		config.ExposedPorts[port] = struct{}{}
+	}
+	for v := range img.Volumes {
+		config.Volumes[v] = struct{}{}
+	}
+	if config.User == "" {
+		config.User = img.User
+	}
+	if config.WorkingDir == "" {
+		config.WorkingDir = img.WorkingDir
+	}
+	if config.StopSignal == "" {
+		config.StopSignal = img.StopSignal
+	}
+	if config.Healthcheck == nil {
+		config.Healthcheck = img.Healthcheck
+	}
+
+	if name == "" {
+		name = imageName(config.Image)
+	}
+
+	ctr := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         name,
+			Path:       process[0],
+			Args:       process[1:],
+			State:      &types.ContainerState{Status: "created"},
+			Image:      config.Image,
+			Name:       "/" + name,
+			HostConfig: hc,
+		},
+		Mounts: []types.MountPoint{},
+		Config: config,
+	}
+	if err := containerMounts(&ctr, opts.VolumesDir); err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return ctr, nil
+}
+
+// containerMounts turns the mounts and binds of the host config and the
+// volumes of the config into the mount points of the container, like docker
+// does when it creates the container. Named and anonymous volumes are
+// directories below volumesDir.
+func containerMounts(ctr *types.ContainerJSON, volumesDir string) error {
+	hc := ctr.HostConfig
+	mounted := map[string]bool{}
+	add := func(m types.MountPoint) {
+		if mounted[m.Destination] {
+			return
+		}
+		mounted[m.Destination] = true
+		ctr.Mounts = append(ctr.Mounts, m)
+	}
+
+	// the --mount flags win over the --volume ones, like docker
+	for _, m := range hc.Mounts {
+		mp := types.MountPoint{
+			Type:        m.Type,
+			Name:        m.Source,
+			Source:      m.Source,
+			Destination: m.Target,
+			RW:          !m.ReadOnly,
+		}
+		if m.ReadOnly {
+			mp.Mode = "ro"
+		}
+		switch m.Type {
+		case mounttypes.TypeBind:
+			mp.Name = ""
+			if m.BindOptions != nil {
+				mp.Propagation = m.BindOptions.Propagation
+			}
+		case mounttypes.TypeVolume:
+			if m.Source == "" {
+				mp.Source = filepath.Join(volumesDir, volumeDirName(m.Target))
+			} else {
+				source, err := volumeSource(volumesDir, m.Source)
+				if err != nil {
+					return err
+				}
+				mp.Source = source
+			}
+		case mounttypes.TypeTmpfs:
+			var opts []string
+			if m.TmpfsOptions != nil {
+				if m.TmpfsOptions.SizeBytes > 0 {
+					opts = append(opts, fmt.Sprintf("size=%d", m.TmpfsOptions.SizeBytes))
+				}
+				if m.TmpfsOptions.Mode != 0 {
+					opts = append(opts, fmt.Sprintf("mode=%o", m.TmpfsOptions.Mode))
+				}
+			}
+			if m.ReadOnly {
+				opts = append(opts, "ro")
+			}
+			hc.Tmpfs[m.Target] = strings.Join(opts, ",")
+			mounted[m.Target] = true
+			continue
+		default:
+			return fmt.Errorf("mounts of type %s are not supported", m.Type)
+		}
+		add(mp)
+	}
+
+	for _, b := range hc.Binds {
+		parts := strings.Split(b, ":")
+		mp := types.MountPoint{
+			Type:        mounttypes.TypeBind,
+			Source:      parts[0],
+			Destination: parts[1],
+			RW:          true,
+		}
+		if len(parts) > 2 {
+			mp.Mode = parts[2]
+			for _, opt := range strings.Split(parts[2], ",") {
+				switch opt {
+				case "ro":
+					mp.RW = false
+				case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+					mp.Propagation = mounttypes.Propagation(opt)
+				}
+			}
+		}
+		if !path.IsAbs(mp.Source) {
+			// named volumes are shared by the containers using them
+			source, err := volumeSource(volumesDir, parts[0])
+			if err != nil {
+				return err
+			}
+			mp.Type = mounttypes.TypeVolume
+			mp.Name = parts[0]
+			mp.Source = source
+		}
+		add(mp)
+	}
+
+	var volumes []string
+	for v := range ctr.Config.Volumes {
+		if _, ok := hc.Tmpfs[v]; !ok && !mounted[v] {
+			volumes = append(volumes, v)
+		}
+	}
+	sort.Strings(volumes)
+	for _, v := range volumes {
+		add(types.MountPoint{
+			Type:        mounttypes.TypeVolume,
+			Source:      filepath.Join(volumesDir, volumeDirName(v)),
+			Destination: v,
+			RW:          true,
+		})
+	}
+	return nil
+}
+
+// volumeSource returns the directory of the named volume below volumesDir,
+// the name has to be one docker accepts for a local volume.
+func volumeSource(volumesDir, name string) (string, error) {
+	if !validVolumeName.MatchString(name) {
+		return "", fmt.Errorf("%q includes invalid characters for a local volume name, only %q are allowed; if you intended to pass a host directory, use an absolute path", name, validVolumeChars)
+	}
+	return filepath.Join(volumesDir, name), nil
+}
+
+// volumeDirName turns the path of an anonymous volume into the name of its
+// directory, ex. /var/lib/data becomes var-lib-data.
+func volumeDirName(p string) string {
+	return strings.Replace(strings.Trim(path.Clean(p), "/"), "/", "-", -1)
+}
+
+// trimRunCommand drops the `docker run` in front of the flags.
+func trimRunCommand(args []string) ([]string, error) {
+	if len(args) > 0 && (args[0] == "docker" || strings.HasSuffix(args[0], "/docker")) {
+		args = args[1:]
+		if len(args) == 0 || (args[0] != "run" && args[0] != "create" && args[0] != "container") {
+			return nil, errors.New("only docker run and docker create command lines can be converted")
+		}
+	}
+	if len(args) > 0 && args[0] == "container" {
+		args = args[1:]
+		if len(args) == 0 || (args[0] != "run" && args[0] != "create") {
+			return nil, errors.New("only docker container run and docker container create command lines can be converted")
+		}
+	}
+	if len(args) > 0 && (args[0] == "run" || args[0] == "create") {
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// parseRunFlags parses the flags in args like docker does: long flags with
+// --name value or --name=value, short ones that can be combined, ex. -it,
+// and the flags end at the first argument that is not one, the image. It
+// returns the image and the command following it.
+func parseRunFlags(args []string, flags []runFlag) ([]string, error) {
+	long := map[string]*runFlag{}
+	short := map[string]*runFlag{}
+	for i := range flags {
+		long[flags[i].long] = &flags[i]
+		if flags[i].short != "" {
+			short[flags[i].short] = &flags[i]
+		}
+	}
+
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--":
+			return args[1:], nil
+		case strings.HasPrefix(arg, "--"):
+			args = args[1:]
+			name := arg[2:]
+			value, hasValue := "", false
+			if i := strings.Index(name, "="); i >= 0 {
+				name, value, hasValue = name[:i], name[i+1:], true
+			}
+			f, ok := long[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown flag: --%s", name)
+			}
+			if !hasValue {
+				switch {
+				case f.isBool:
+					value = "true"
+				case len(args) > 0:
+					value, args = args[0], args[1:]
+				default:
+					return nil, fmt.Errorf("flag needs an argument: --%s", name)
+				}
+			}
+			if err := f.apply("--"+name, value); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			args = args[1:]
+			shorts := arg[1:]
+			for shorts != "" {
+				c := shorts[:1]
+				shorts = shorts[1:]
+				f, ok := short[c]
+				if !ok {
+					return nil, fmt.Errorf("unknown shorthand flag: %q in %s", c, arg)
+				}
+				var value string
+				switch {
+				case f.isBool:
+					value = "true"
+					if strings.HasPrefix(shorts, "=") {
+						value, shorts = shorts[1:], ""
+					}
+				case shorts != "":
+					// the rest is the value, ex. -p80:80 or -p=80:80
+					value, shorts = strings.TrimPrefix(shorts, "="), ""
+				case len(args) > 0:
+					value, args = args[0], args[1:]
+				default:
+					return nil, fmt.Errorf("flag needs an argument: -%s", c)
+				}
+				if err := f.apply("-"+c, value); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return args, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *runFlag) apply(name, value string) error {
+	if f.isBool {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid argument %q for %s: %v", value, name, err)
+		}
+	}
+	if f.set == nil {
+		logrus.Debugf("Ignoring %s, it does not change the spec", name)
+		return nil
+	}
+	if err := f.set(value); err != nil {
+		return fmt.Errorf("invalid argument %q for %s: %v", value, name, err)
+	}
+	return nil
+}
+
+func setString(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseBool(v)
+		return err
+	}
+}
+
+func setInt(p *int64) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseInt(v, 10, 64)
+		return err
+	}
+}
+
+func setBytes(p *int64) func(string) error {
+	return func(v string) (err error) {
+		*p, err = units.RAMInBytes(v)
+		return err
+	}
+}
+
+func appendTo(p *[]string) func(string) error {
+	return func(v string) error {
+		*p = append(*p, v)
+		return nil
+	}
+}
+
+func setMap(m map[string]string) func(string) error {
+	return func(v string) error {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("expected key=value")
+		}
+		m[parts[0]] = parts[1]
+		return nil
+	}
+}
+
+func setNetwork(hc *containertypes.HostConfig) func(string) error {
+	return func(v string) error {
+		hc.NetworkMode = containertypes.NetworkMode(v)
+		return nil
+	}
+}
+
+func throttleDevice(p *[]*blkiodev.ThrottleDevice, bytes bool) func(string) error {
+	return func(v string) error {
+		parts := strings.Split(v, ":")
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/dev/") {
+			return errors.New("expected /dev/<device>:<rate>")
+		}
+		var (
+			rate uint64
+			err  error
+		)
+		if bytes {
+			var n int64
+			n, err = units.RAMInBytes(parts[1])
+			rate = uint64(n)
+		} else {
+			rate, err = strconv.ParseUint(parts[1], 10, 64)
+		}
+		if err != nil {
+			return err
+		}
+		*p = append(*p, &blkiodev.ThrottleDevice{Path: parts[0], Rate: rate})
+		return nil
+	}
+}
+
+func parseWeightDevice(v string) (*blkiodev.WeightDevice, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "/dev/") {
+		return nil, errors.New("expected /dev/<device>:<weight>")
+	}
+	n, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	if n != 0 && (n < 10 || n > 1000) {
+		return nil, errors.New("range is from 10 to 1000")
+	}
+	return &blkiodev.WeightDevice{Path: parts[0], Weight: uint16(n)}, nil
+}
+
+// parseCPUs turns a number of CPUs, ex. 1.5, into nano CPUs.
+func parseCPUs(v string) (int64, error) {
+	cpus, ok := new(big.Rat).SetString(v)
+	if !ok {
+		return 0, errors.New("not a number")
+	}
+	nano := cpus.Mul(cpus, big.NewRat(1e9, 1))
+	if !nano.IsInt() {
+		return 0, errors.New("value is too precise")
+	}
+	if nano.Sign() < 0 {
+		return 0, errors.New("cannot be negative")
+	}
+	return nano.Num().Int64(), nil
+}
+
+// parseDevice parses a device as host[:container][:permissions].
+func parseDevice(d string) (containertypes.DeviceMapping, error) {
+	parts := strings.Split(d, ":")
+	device := containertypes.DeviceMapping{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+	switch len(parts) {
+	case 1:
+	case 2:
+		if validDeviceMode(parts[1]) {
+			device.CgroupPermissions = parts[1]
+		} else {
+			device.PathInContainer = parts[1]
+		}
+	case 3:
+		if !validDeviceMode(parts[2]) {
+			return device, fmt.Errorf("invalid device permissions %s", parts[2])
+		}
+		device.PathInContainer = parts[1]
+		device.CgroupPermissions = parts[2]
+	default:
+		return device, fmt.Errorf("parsing device %s as host[:container[:permissions]] failed", d)
+	}
+	return device, nil
+}
+
+func validDeviceMode(mode string) bool {
+	if mode == "" {
+		return false
+	}
+	seen := map[rune]bool{}
+	for _, c := range mode {
+		if !strings.ContainsRune("rwm", c) || seen[c] {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+// parseVolume parses a --volume flag, [source:]destination[:mode]. Without
+// a source it is an anonymous volume.
+func parseVolume(v string, config *containertypes.Config, hc *containertypes.HostConfig) error {
+	parts := strings.Split(v, ":")
+	switch len(parts) {
+	case 1:
+		if !path.IsAbs(v) {
+			return fmt.Errorf("invalid volume %s, the destination has to be an absolute path", v)
+		}
+		config.Volumes[path.Clean(v)] = struct{}{}
+	case 2, 3:
+		if parts[0] == "" || !path.IsAbs(parts[1]) {
+			return fmt.Errorf("invalid volume %s, expected [source:]destination[:mode] with an absolute destination", v)
+		}
+		hc.Binds = append(hc.Binds, v)
+	default:
+		return fmt.Errorf("invalid volume %s, expected [source:]destination[:mode]", v)
+	}
+	return nil
+}
+
+// parseMount parses a --mount flag, a comma separated list of key=value.
+func parseMount(v string) (mounttypes.Mount, error) {
+	fields, err := csv.NewReader(strings.NewReader(v)).Read()
+	if err != nil {
+		return mounttypes.Mount{}, err
+	}
+
+	m := mounttypes.Mount{Type: mounttypes.TypeVolume}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		key := strings.ToLower(parts[0])
+		if len(parts) == 1 {
+			switch key {
+			case "readonly", "ro":
+				m.ReadOnly = true
+				continue
+			case "volume-nocopy":
+				if m.VolumeOptions == nil {
+					m.VolumeOptions = &mounttypes.VolumeOptions{}
+				}
+				m.VolumeOptions.NoCopy = true
+				continue
+			}
+			return m, fmt.Errorf("invalid field %s, expected key=value", field)
+		}
+
+		value := parts[1]
+		switch key {
+		case "type":
+			m.Type = mounttypes.Type(strings.ToLower(value))
+		case "source", "src":
+			m.Source = value
+		case "target", "dst", "destination":
+			m.Target = value
+		case "readonly", "ro":
+			if m.ReadOnly, err = strconv.ParseBool(value); err != nil {
+				return m, fmt.Errorf("invalid value for %s: %s", key, value)
+			}
+		case "consistency":
+			m.Consistency = mounttypes.Consistency(strings.ToLower(value))
+		case "bind-propagation":
+			if m.BindOptions == nil {
+				m.BindOptions = &mounttypes.BindOptions{}
+			}
+			m.BindOptions.Propagation = mounttypes.Propagation(strings.ToLower(value))
+		case "volume-nocopy", "volume-driver", "volume-label", "volume-opt":
+			if m.VolumeOptions == nil {
+				m.VolumeOptions = &mounttypes.VolumeOptions{}
+			}
+			if key == "volume-nocopy" {
+				if m.VolumeOptions.NoCopy, err = strconv.ParseBool(value); err != nil {
+					return m, fmt.Errorf("invalid value for %s: %s", key, value)
+				}
+			}
+		case "tmpfs-size":
+			if m.TmpfsOptions == nil {
+				m.TmpfsOptions = &mounttypes.TmpfsOptions{}
+			}
+			if m.TmpfsOptions.SizeBytes, err = units.RAMInBytes(value); err != nil {
+				return m, fmt.Errorf("invalid value for %s: %s", key, value)
+			}
+		case "tmpfs-mode":
+			if m.TmpfsOptions == nil {
+				m.TmpfsOptions = &mounttypes.TmpfsOptions{}
+			}
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return m, fmt.Errorf("invalid value for %s: %s", key, value)
+			}
+			m.TmpfsOptions.Mode = os.FileMode(mode)
+		default:
+			return m, fmt.Errorf("unexpected key %s", key)
+		}
+	}
+
+	if m.Target == "" {
+		return m, errors.New("target is required")
+	}
+	switch m.Type {
+	case mounttypes.TypeBind:
+		if m.Source == "" {
+			return m, errors.New("source is required for bind mounts")
+		}
+	case mounttypes.TypeVolume:
+	case mounttypes.TypeTmpfs:
+		if m.Source != "" {
+			return m, errors.New("source is not supported for tmpfs mounts")
+		}
+	default:
+		return m, fmt.Errorf("mounts of type %s are not supported", m.Type)
+	}
+	return m, nil
+}
+
+// readEnvFile reads the variables in an --env-file or a --label-file, one
+// per line, skipping empty lines and comments. For env files a variable
+// without a value takes it from the environment.
+func readEnvFile(file string, env bool) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", file, err)
+	}
+
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimLeft(s.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(strings.SplitN(line, "=", 2)[0], " \t") {
+			return nil, fmt.Errorf("variable %q in %s has white spaces", line, file)
+		}
+		if line = envValue(line, env); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+// envValue takes the value of a variable passed without one, ex. -e HOME,
+// from the environment. It returns an empty string if it is not set there.
+func envValue(v string, env bool) string {
+	if !env || strings.Contains(v, "=") {
+		return v
+	}
+	if value, ok := os.LookupEnv(v); ok {
+		return v + "=" + value
+	}
+	return ""
+}
+
+// securityOpt checks a --security-opt and reads the seccomp profile, which
+// the daemon gets the contents of.
+func securityOpt(opt string) (string, error) {
+	if opt == "no-new-privileges" {
+		return opt, nil
+	}
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) == 1 {
+		// the old key:value form
+		parts = strings.SplitN(opt, ":", 2)
+		if len(parts) == 1 {
+			return "", fmt.Errorf("invalid --security-opt %s", opt)
+		}
+	}
+	if parts[0] != "seccomp" || parts[1] == "unconfined" {
+		return parts[0] + "=" + parts[1], nil
+	}
+
+	data, err := ioutil.ReadFile(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("reading seccomp profile %s failed: %v", parts[1], err)
+	}
+	b := bytes.NewBuffer(nil)
+	if err := json.Compact(b, data); err != nil {
+		return "", fmt.Errorf("compacting seccomp profile %s failed: %v", parts[1], err)
+	}
+	return "seccomp=" + b.String(), nil
+}
+
+func parseRestartPolicy(policy string) (containertypes.RestartPolicy, error) {
+	parts := strings.SplitN(policy, ":", 2)
+	p := containertypes.RestartPolicy{Name: parts[0]}
+	switch p.Name {
+	case "no", "always", "unless-stopped":
+		if len(parts) == 2 {
+			return p, fmt.Errorf("restart policy %s does not take a retry count", p.Name)
+		}
+	case "on-failure":
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return p, fmt.Errorf("parsing the retry count of restart policy %s failed: %v", policy, err)
+			}
+			p.MaximumRetryCount = n
+		}
+	default:
+		return p, fmt.Errorf("invalid restart policy %s", p.Name)
+	}
+	return p, nil
+}
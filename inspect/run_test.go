@@ -0,0 +1,186 @@
+package inspect
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	config, hc, err := ParseRunArgs([]string{
+		"docker", "run", "--rm", "-it", "-p8080:80", "--publish=127.0.0.1:9000:9000/udp",
+		"--cap-add", "NET_ADMIN", "-m", "1g", "--memory-swap=-1", "--cpus", "1.5",
+		"--env", "FOO=bar", "-l", "app=web", "--read-only=false", "--init",
+		"--device", "/dev/fuse:rw", "--ulimit", "nofile=1024:2048", "--restart", "on-failure:3",
+		"--sysctl", "net.core.somaxconn=1024", "--expose", "7000-7001", "--health-cmd", "true",
+		"nginx", "-g", "--rm",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Image != "nginx" || !reflect.DeepEqual(config.Cmd, strslice.StrSlice{"-g", "--rm"}) {
+		t.Fatalf("expected the flags to end at the image, got image %q and cmd %v", config.Image, config.Cmd)
+	}
+	if !config.Tty || !config.OpenStdin || !config.AttachStdin || !config.StdinOnce || !hc.AutoRemove {
+		t.Fatal("expected -it and --rm to be set")
+	}
+	for _, p := range []nat.Port{"80/tcp", "9000/udp", "7000/tcp", "7001/tcp"} {
+		if _, ok := config.ExposedPorts[p]; !ok {
+			t.Fatalf("expected port %s to be exposed, got %v", p, config.ExposedPorts)
+		}
+	}
+	if b := hc.PortBindings["9000/udp"]; len(b) != 1 || b[0].HostIP != "127.0.0.1" {
+		t.Fatalf("unexpected port bindings %v", hc.PortBindings)
+	}
+	if hc.Memory != 1<<30 || hc.MemorySwap != -1 || hc.NanoCPUs != 15e8 {
+		t.Fatalf("unexpected resources memory=%d swap=%d cpus=%d", hc.Memory, hc.MemorySwap, hc.NanoCPUs)
+	}
+	if !reflect.DeepEqual(config.Env, []string{"FOO=bar"}) || config.Labels["app"] != "web" {
+		t.Fatalf("unexpected env %v or labels %v", config.Env, config.Labels)
+	}
+	if hc.ReadonlyRootfs || hc.Init == nil || !*hc.Init {
+		t.Fatal("expected --read-only=false and --init to be set")
+	}
+	device := containertypes.DeviceMapping{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rw"}
+	if len(hc.Devices) != 1 || hc.Devices[0] != device {
+		t.Fatalf("expected device %#v, got %#v", device, hc.Devices)
+	}
+	if len(hc.Ulimits) != 1 || hc.Ulimits[0].Soft != 1024 || hc.Ulimits[0].Hard != 2048 {
+		t.Fatalf("unexpected ulimits %v", hc.Ulimits)
+	}
+	if hc.RestartPolicy.Name != "on-failure" || hc.RestartPolicy.MaximumRetryCount != 3 {
+		t.Fatalf("unexpected restart policy %v", hc.RestartPolicy)
+	}
+	if hc.Sysctls["net.core.somaxconn"] != "1024" || !reflect.DeepEqual(hc.CapAdd, strslice.StrSlice{"NET_ADMIN"}) {
+		t.Fatalf("unexpected sysctls %v or capabilities %v", hc.Sysctls, hc.CapAdd)
+	}
+	if config.Healthcheck == nil || !reflect.DeepEqual(config.Healthcheck.Test, []string{"CMD-SHELL", "true"}) {
+		t.Fatalf("unexpected healthcheck %v", config.Healthcheck)
+	}
+}
+
+func TestParseRunArgsErrors(t *testing.T) {
+	tests := [][]string{
+		{"docker", "ps"},
+		{"run", "--bogus", "alpine"},
+		{"run", "-x", "alpine"},
+		{"run", "--memory"},
+		{"run", "--rm"},
+		{"run", "--cpus", "0.0000000001", "alpine"},
+		{"run", "-d", "-a", "stdout", "alpine"},
+		{"run", "--no-healthcheck", "--health-cmd", "true", "alpine"},
+		{"run", "--restart", "sometimes", "alpine"},
+		{"run", "-v", "relative", "alpine"},
+		{"run", "--mount", "type=bind,target=/data", "alpine"},
+	}
+	for _, args := range tests {
+		if _, _, err := ParseRunArgs(args); err == nil {
+			t.Fatalf("expected an error parsing %v", args)
+		}
+	}
+}
+
+func TestFromRunArgs(t *testing.T) {
+	img := &containertypes.Config{
+		Entrypoint: strslice.StrSlice{"/docker-entrypoint.sh"},
+		Cmd:        strslice.StrSlice{"postgres"},
+		Env:        []string{"PATH=/usr/bin", "PGDATA=/var/lib/postgresql/data"},
+		User:       "postgres",
+		Volumes:    map[string]struct{}{"/var/lib/postgresql/data": {}, "/run": {}},
+	}
+	ctr, err := FromRunArgs([]string{
+		"run", "--name", "db", "--entrypoint", "", "-e", "PGDATA=/data",
+		"-v", "/srv/db:/data:ro,rslave", "-v", "cache:/cache", "--tmpfs", "/run",
+		"--mount", "type=volume,target=/var/lib/postgresql/data",
+		"postgres:11", "postgres", "-c", "fsync=off",
+	}, RunOptions{
+		VolumesDir: "/bundle/volumes",
+		ImageConfig: func(image string) (*containertypes.Config, error) {
+			if image != "postgres:11" {
+				t.Fatalf("expected the config of postgres:11, got %s", image)
+			}
+			return img, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctr.Name != "/db" || ctr.Path != "postgres" || !reflect.DeepEqual(ctr.Args, []string{"-c", "fsync=off"}) {
+		t.Fatalf("unexpected container %s running %s %v", ctr.Name, ctr.Path, ctr.Args)
+	}
+	if !reflect.DeepEqual(ctr.Config.Env, []string{"PATH=/usr/bin", "PGDATA=/data"}) {
+		t.Fatalf("unexpected env %v", ctr.Config.Env)
+	}
+	if ctr.Config.User != "postgres" {
+		t.Fatalf("expected the user of the image, got %q", ctr.Config.User)
+	}
+
+	mounts := []struct {
+		typ         mounttypes.Type
+		source      string
+		destination string
+		rw          bool
+	}{
+		{mounttypes.TypeVolume, "/bundle/volumes/var-lib-postgresql-data", "/var/lib/postgresql/data", true},
+		{mounttypes.TypeBind, "/srv/db", "/data", false},
+		{mounttypes.TypeVolume, "/bundle/volumes/cache", "/cache", true},
+	}
+	if len(ctr.Mounts) != len(mounts) {
+		t.Fatalf("expected %d mounts, got %#v", len(mounts), ctr.Mounts)
+	}
+	for i, m := range mounts {
+		got := ctr.Mounts[i]
+		if got.Type != m.typ || got.Source != m.source || got.Destination != m.destination || got.RW != m.rw {
+			t.Fatalf("expected mount %v, got %#v", m, got)
+		}
+	}
+	if ctr.Mounts[1].Propagation != mounttypes.PropagationRSlave {
+		t.Fatalf("expected the bind mount to be rslave, got %q", ctr.Mounts[1].Propagation)
+	}
+	if _, ok := ctr.HostConfig.Tmpfs["/run"]; !ok {
+		t.Fatal("expected /run to be a tmpfs mount")
+	}
+}
+
+func TestFromRunArgsVolumeNames(t *testing.T) {
+	tests := [][]string{
+		{"run", "-v", "../../../etc:/x", "alpine", "sh"},
+		{"run", "-v", "cache/../..:/x", "alpine", "sh"},
+		{"run", "--mount", "type=volume,source=../etc,target=/x", "alpine", "sh"},
+	}
+	for _, args := range tests {
+		if _, err := FromRunArgs(args, RunOptions{VolumesDir: "/bundle/volumes"}); err == nil {
+			t.Fatalf("expected an error converting %v", args)
+		}
+	}
+}
+
+func TestFromRunArgsLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := logrus.New()
+	log.Out = &buf
+
+	_, err := FromRunArgs([]string{"run", "alpine", "sh"}, RunOptions{
+		VolumesDir: "/bundle/volumes",
+		ImageConfig: func(image string) (*containertypes.Config, error) {
+			return nil, errors.New("no such image")
+		},
+		Log: log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Getting the config of image alpine failed") {
+		t.Fatalf("expected the warning on the logger of the options, got %q", buf.String())
+	}
+}
@@ -0,0 +1,435 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/api/types/swarm"
+	units "github.com/docker/go-units"
+	"github.com/genuinetools/riddler/parse"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SecretsDir is the directory in the bundle that holds the secrets of a
+	// service.
+	SecretsDir = "secrets"
+	// ConfigsDir is the directory in the bundle that holds the configs of a
+	// service.
+	ConfigsDir = "configs"
+
+	// the labels swarm puts on the containers of its tasks
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+
+	// secrets without an absolute target end up in here, like with swarm
+	swarmSecretsPath = "/run/secrets"
+)
+
+// validSwarmName matches the names swarm allows for secrets and configs.
+var validSwarmName = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[a-zA-Z0-9-_.]*[a-zA-Z0-9])?$`)
+
+// Service is a swarm service, as printed by `docker service inspect`.
+type Service struct {
+	ID   string
+	Spec ServiceSpec
+}
+
+// ServiceSpec is the part of the spec of a swarm service that can be
+// converted.
+type ServiceSpec struct {
+	swarm.Annotations
+	TaskTemplate ServiceTaskSpec
+}
+
+// ServiceTaskSpec is the template of the tasks of a service.
+type ServiceTaskSpec struct {
+	ContainerSpec *ServiceContainerSpec
+	Resources     *swarm.ResourceRequirements
+}
+
+// ServiceContainerSpec is the spec of the containers of a service. Newer
+// daemons have settings the vendored API types do not know about yet, those
+// are decoded as well.
+type ServiceContainerSpec struct {
+	swarm.ContainerSpec
+	Sysctls        map[string]string `json:",omitempty"`
+	CapabilityAdd  []string          `json:",omitempty"`
+	CapabilityDrop []string          `json:",omitempty"`
+	Ulimits        []*units.Ulimit   `json:",omitempty"`
+}
+
+// ServiceContainer is the container of a task of a service.
+type ServiceContainer struct {
+	types.ContainerJSON
+	// Files are the secrets and configs of the service, which are bind
+	// mounted into the container. The caller is expected to write them.
+	Files []ServiceFile
+}
+
+// ServiceFile is a secret or config of a service.
+type ServiceFile struct {
+	// Path is the path of the file on the host.
+	Path string
+	Data []byte
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// ServiceOptions are the settings for converting a service that the service
+// spec does not hold.
+type ServiceOptions struct {
+	// VolumesDir is the directory holding the named and anonymous volumes.
+	VolumesDir string
+	// SecretsDir and ConfigsDir are the directories the secrets and the
+	// configs are written to, at the path of their target below them.
+	SecretsDir string
+	ConfigsDir string
+	// SecretData and ConfigData return the contents of a secret or a config.
+	SecretData func(ref *swarm.SecretReference) ([]byte, error)
+	ConfigData func(ref *swarm.ConfigReference) ([]byte, error)
+	// ImageConfig returns the config of the image, used for the defaults
+	// the service does not set. It can be nil.
+	ImageConfig func(image string) (*containertypes.Config, error)
+	// Log gets the warnings of the conversion. It can be nil, they go to
+	// the standard logger then.
+	Log logrus.FieldLogger
+}
+
+// DecodeService reads the output of `docker service inspect`, or a bare
+// service spec, from data. If there is more than one service the one named
+// name is returned.
+func DecodeService(data []byte, name string) (*Service, error) {
+	entries, err := readEntries(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*Service
+	for i, entry := range entries {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &fields); err != nil {
+			return nil, fmt.Errorf("decoding service entry %d failed: %v", i, err)
+		}
+
+		var svc Service
+		if _, ok := fields["Spec"]; ok {
+			err = json.Unmarshal(entry, &svc)
+		} else {
+			err = json.Unmarshal(entry, &svc.Spec)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding service entry %d failed: %v", i, err)
+		}
+		if svc.Spec.TaskTemplate.ContainerSpec == nil {
+			return nil, fmt.Errorf("service entry %d has no container spec", i)
+		}
+		services = append(services, &svc)
+	}
+
+	if name == "" {
+		if len(services) > 1 {
+			return nil, errors.New("there is more than one service, pass the name of the one to convert")
+		}
+		return services[0], nil
+	}
+	for _, svc := range services {
+		if svc.Spec.Name == name || svc.ID == name {
+			return svc, nil
+		}
+	}
+	return nil, fmt.Errorf("no service named %s", name)
+}
+
+// FromService builds the docker inspect data of the container swarm would
+// create for a task of the service. Its secrets and configs are bind mounted
+// read-only from files below the SecretsDir and the ConfigsDir.
+func FromService(svc *Service, opts ServiceOptions) (ServiceContainer, error) {
+	spec := svc.Spec.TaskTemplate.ContainerSpec
+	if spec == nil {
+		return ServiceContainer{}, errors.New("service has no container spec")
+	}
+
+	img := &containertypes.Config{}
+	if opts.ImageConfig != nil {
+		config, err := opts.ImageConfig(spec.Image)
+		switch {
+		case err == nil:
+			img = config
+		case len(spec.Command) == 0 && len(spec.Args) == 0:
+			return ServiceContainer{}, fmt.Errorf("getting the command of image %s failed: %v", spec.Image, err)
+		default:
+			logger(opts.Log).Warnf("Getting the config of image %s failed, using the defaults: %v", spec.Image, err)
+		}
+	}
+
+	// like swarm, the command replaces the entrypoint of the image and the
+	// args its cmd
+	entrypoint := []string(img.Entrypoint)
+	cmd := []string(img.Cmd)
+	if len(spec.Command) > 0 {
+		entrypoint = spec.Command
+		cmd = nil
+	}
+	if len(spec.Args) > 0 {
+		cmd = spec.Args
+	}
+	process := append(append([]string{}, entrypoint...), cmd...)
+	if len(process) == 0 {
+		return ServiceContainer{}, errors.New("no command for the container")
+	}
+
+	name := svc.Spec.Name
+	if name == "" {
+		name = imageName(spec.Image)
+	}
+	id := svc.ID
+	if id == "" {
+		id = name
+	}
+
+	config := &containertypes.Config{
+		Hostname:    spec.Hostname,
+		User:        img.User,
+		Tty:         spec.TTY,
+		OpenStdin:   spec.OpenStdin,
+		Env:         append([]string{}, img.Env...),
+		Image:       spec.Image,
+		WorkingDir:  img.WorkingDir,
+		Labels:      map[string]string{},
+		StopSignal:  img.StopSignal,
+		Healthcheck: img.Healthcheck,
+		Volumes:     map[string]struct{}{},
+		Entrypoint:  strslice.StrSlice(entrypoint),
+		Cmd:         strslice.StrSlice(cmd),
+	}
+	if len(config.Env) == 0 {
+		config.Env = append(config.Env, parse.DefaultTerminalEnv...)
+	}
+	config.Env = mergeEnv(config.Env, spec.Env)
+	for k, v := range img.Labels {
+		config.Labels[k] = v
+	}
+	for k, v := range spec.Labels {
+		config.Labels[k] = v
+	}
+	config.Labels[swarmServiceIDLabel] = svc.ID
+	config.Labels[swarmServiceNameLabel] = svc.Spec.Name
+	for v := range img.Volumes {
+		config.Volumes[v] = struct{}{}
+	}
+	if spec.Dir != "" {
+		config.WorkingDir = spec.Dir
+	}
+	if spec.User != "" {
+		config.User = spec.User
+	}
+	if spec.StopSignal != "" {
+		config.StopSignal = spec.StopSignal
+	}
+	if spec.Healthcheck != nil {
+		config.Healthcheck = spec.Healthcheck
+	}
+	if spec.StopGracePeriod != nil {
+		t := int(spec.StopGracePeriod.Seconds())
+		config.StopTimeout = &t
+	}
+
+	hc := &containertypes.HostConfig{
+		NetworkMode:    "default",
+		GroupAdd:       spec.Groups,
+		Init:           spec.Init,
+		ReadonlyRootfs: spec.ReadOnly,
+		Isolation:      spec.Isolation,
+		Mounts:         spec.Mounts,
+		CapAdd:         serviceCapabilities(spec.CapabilityAdd),
+		CapDrop:        serviceCapabilities(spec.CapabilityDrop),
+		Sysctls:        spec.Sysctls,
+		Tmpfs:          map[string]string{},
+	}
+	hc.Ulimits = spec.Ulimits
+	if spec.DNSConfig != nil {
+		hc.DNS = spec.DNSConfig.Nameservers
+		hc.DNSSearch = spec.DNSConfig.Search
+		hc.DNSOptions = spec.DNSConfig.Options
+	}
+	// swarm uses the format of /etc/hosts, IP_address hostname [aliases...]
+	for _, h := range spec.Hosts {
+		fields := strings.Fields(h)
+		if len(fields) < 2 {
+			return ServiceContainer{}, fmt.Errorf("invalid host %q, expected IP_address hostname [aliases...]", h)
+		}
+		for _, host := range fields[1:] {
+			hc.ExtraHosts = append(hc.ExtraHosts, host+":"+fields[0])
+		}
+	}
+	if spec.Privileges != nil && spec.Privileges.SELinuxContext != nil {
+		hc.SecurityOpt = selinuxOpts(spec.Privileges.SELinuxContext)
+	}
+	if r := svc.Spec.TaskTemplate.Resources; r != nil {
+		if r.Limits != nil {
+			hc.NanoCPUs = r.Limits.NanoCPUs
+			hc.Memory = r.Limits.MemoryBytes
+		}
+		if r.Reservations != nil {
+			hc.MemoryReservation = r.Reservations.MemoryBytes
+		}
+	}
+
+	ctr := ServiceContainer{
+		ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         id,
+				Path:       process[0],
+				Args:       process[1:],
+				State:      &types.ContainerState{Status: "created"},
+				Image:      spec.Image,
+				Name:       "/" + name,
+				HostConfig: hc,
+			},
+			Mounts: []types.MountPoint{},
+			Config: config,
+		},
+	}
+	if err := containerMounts(&ctr.ContainerJSON, opts.VolumesDir); err != nil {
+		return ServiceContainer{}, err
+	}
+
+	for _, ref := range spec.Secrets {
+		if ref == nil || ref.File == nil {
+			continue
+		}
+		if opts.SecretData == nil {
+			return ServiceContainer{}, errors.New("no way to get the data of the secrets")
+		}
+		if !validSwarmName.MatchString(ref.SecretName) {
+			return ServiceContainer{}, fmt.Errorf("%q is not a valid secret name", ref.SecretName)
+		}
+		data, err := opts.SecretData(ref)
+		if err != nil {
+			return ServiceContainer{}, fmt.Errorf("getting secret %s failed: %v", ref.SecretName, err)
+		}
+		target := ref.File.Name
+		if !path.IsAbs(target) {
+			target = path.Join(swarmSecretsPath, target)
+		}
+		if err := ctr.addFile(opts.SecretsDir, target, data, ref.File.Mode, ref.File.UID, ref.File.GID); err != nil {
+			return ServiceContainer{}, fmt.Errorf("secret %s: %v", ref.SecretName, err)
+		}
+	}
+	for _, ref := range spec.Configs {
+		// the runtime configs are credential specs for windows
+		if ref == nil || ref.File == nil {
+			continue
+		}
+		if opts.ConfigData == nil {
+			return ServiceContainer{}, errors.New("no way to get the data of the configs")
+		}
+		if !validSwarmName.MatchString(ref.ConfigName) {
+			return ServiceContainer{}, fmt.Errorf("%q is not a valid config name", ref.ConfigName)
+		}
+		data, err := opts.ConfigData(ref)
+		if err != nil {
+			return ServiceContainer{}, fmt.Errorf("getting config %s failed: %v", ref.ConfigName, err)
+		}
+		target := ref.File.Name
+		if !path.IsAbs(target) {
+			target = "/" + target
+		}
+		if err := ctr.addFile(opts.ConfigsDir, target, data, ref.File.Mode, ref.File.UID, ref.File.GID); err != nil {
+			return ServiceContainer{}, fmt.Errorf("config %s: %v", ref.ConfigName, err)
+		}
+	}
+
+	return ctr, nil
+}
+
+// addFile adds a secret or config to the files of the container and bind
+// mounts it read-only at target. The file is kept at the path of the target
+// below dir, so references with different targets do not share it.
+func (c *ServiceContainer) addFile(dir, target string, data []byte, mode os.FileMode, uid, gid string) error {
+	target = path.Clean(target)
+	for _, m := range c.Mounts {
+		if m.Destination == target {
+			return fmt.Errorf("duplicate mount point %s", target)
+		}
+	}
+	f := ServiceFile{
+		Path: filepath.Join(dir, filepath.FromSlash(target)),
+		Data: data,
+		Mode: mode,
+	}
+	if f.Mode == 0 {
+		f.Mode = 0444
+	}
+	var err error
+	if f.UID, err = parseID(uid); err != nil {
+		return err
+	}
+	if f.GID, err = parseID(gid); err != nil {
+		return err
+	}
+	c.Files = append(c.Files, f)
+
+	c.Mounts = append(c.Mounts, types.MountPoint{
+		Type:        mounttypes.TypeBind,
+		Source:      f.Path,
+		Destination: target,
+		Mode:        "ro",
+	})
+	return nil
+}
+
+func parseID(id string) (int, error) {
+	if id == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("parsing id %s failed: %v", id, err)
+	}
+	return n, nil
+}
+
+// serviceCapabilities turns the capabilities of a service, which swarm names
+// like the kernel, ex. CAP_NET_ADMIN, into the ones of docker.
+func serviceCapabilities(caps []string) strslice.StrSlice {
+	var c strslice.StrSlice
+	for _, cap := range caps {
+		c = append(c, strings.TrimPrefix(strings.ToUpper(cap), "CAP_"))
+	}
+	return c
+}
+
+// selinuxOpts turns the SELinux context of a service into the security
+// options docker would give its containers.
+func selinuxOpts(c *swarm.SELinuxContext) []string {
+	if c.Disable {
+		return []string{"label=disable"}
+	}
+	var opts []string
+	for _, l := range []struct{ key, value string }{
+		{"user", c.User},
+		{"role", c.Role},
+		{"type", c.Type},
+		{"level", c.Level},
+	} {
+		if l.value != "" {
+			opts = append(opts, "label="+l.key+":"+l.value)
+		}
+	}
+	return opts
+}
@@ -0,0 +1,201 @@
+package inspect
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+const serviceInspect = `[
+  {
+    "ID": "abc123",
+    "Spec": {
+      "Name": "web",
+      "TaskTemplate": {
+        "ContainerSpec": {
+          "Image": "nginx:1.15",
+          "Args": ["-g", "daemon off;"],
+          "Env": ["MODE=prod", "PATH=/custom"],
+          "Init": true,
+          "Hosts": ["10.0.0.2 db db.local"],
+          "Mounts": [{"Type": "volume", "Source": "html", "Target": "/usr/share/nginx/html"}],
+          "Secrets": [{"File": {"Name": "password", "UID": "101", "GID": "101", "Mode": 256}, "SecretID": "s1", "SecretName": "db_password"}],
+          "Configs": [
+            {"File": {"Name": "/etc/nginx/nginx.conf", "Mode": 292}, "ConfigID": "c1", "ConfigName": "nginx_conf"},
+            {"Runtime": {}, "ConfigID": "c2", "ConfigName": "credspec"}
+          ],
+          "Sysctls": {"net.core.somaxconn": "1024"},
+          "CapabilityAdd": ["CAP_NET_ADMIN"]
+        },
+        "Resources": {"Limits": {"NanoCPUs": 500000000, "MemoryBytes": 268435456}}
+      }
+    }
+  },
+  {"ID": "def456", "Spec": {"Name": "db", "TaskTemplate": {"ContainerSpec": {"Image": "postgres"}}}}
+]`
+
+func TestDecodeService(t *testing.T) {
+	svc, err := DecodeService([]byte(serviceInspect), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.ID != "abc123" || svc.Spec.TaskTemplate.ContainerSpec.Sysctls["net.core.somaxconn"] != "1024" {
+		t.Fatalf("unexpected service %#v", svc)
+	}
+
+	if _, err := DecodeService([]byte(serviceInspect), ""); err == nil {
+		t.Fatal("expected an error without the name of one of the services")
+	}
+	if _, err := DecodeService([]byte(serviceInspect), "cache"); err == nil {
+		t.Fatal("expected an error for a service that does not exist")
+	}
+
+	// a bare service spec
+	svc, err = DecodeService([]byte(`{"Name": "db", "TaskTemplate": {"ContainerSpec": {"Image": "postgres"}}}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Spec.Name != "db" || svc.Spec.TaskTemplate.ContainerSpec.Image != "postgres" {
+		t.Fatalf("unexpected service %#v", svc)
+	}
+}
+
+func TestFromService(t *testing.T) {
+	svc, err := DecodeService([]byte(serviceInspect), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := FromService(svc, ServiceOptions{
+		VolumesDir: "/bundle/volumes",
+		SecretsDir: "/bundle/secrets",
+		ConfigsDir: "/bundle/configs",
+		SecretData: func(ref *swarm.SecretReference) ([]byte, error) {
+			return []byte("s3cret"), nil
+		},
+		ConfigData: func(ref *swarm.ConfigReference) ([]byte, error) {
+			if ref.ConfigName != "nginx_conf" {
+				return nil, errors.New("unexpected config " + ref.ConfigName)
+			}
+			return []byte("events {}"), nil
+		},
+		ImageConfig: func(image string) (*containertypes.Config, error) {
+			return &containertypes.Config{
+				Entrypoint: strslice.StrSlice{"/docker-entrypoint.sh"},
+				Cmd:        strslice.StrSlice{"nginx"},
+				Env:        []string{"PATH=/usr/bin"},
+			}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctr.Name != "/web" || ctr.Path != "/docker-entrypoint.sh" || !reflect.DeepEqual(ctr.Args, []string{"-g", "daemon off;"}) {
+		t.Fatalf("unexpected container %s running %s %v", ctr.Name, ctr.Path, ctr.Args)
+	}
+	if !reflect.DeepEqual(ctr.Config.Env, []string{"PATH=/custom", "MODE=prod"}) {
+		t.Fatalf("unexpected env %v", ctr.Config.Env)
+	}
+	hc := ctr.HostConfig
+	if hc.Init == nil || !*hc.Init || hc.NanoCPUs != 5e8 || hc.Memory != 256<<20 {
+		t.Fatalf("unexpected init or resources %#v", hc.Resources)
+	}
+	if !reflect.DeepEqual(hc.CapAdd, strslice.StrSlice{"NET_ADMIN"}) || hc.Sysctls["net.core.somaxconn"] != "1024" {
+		t.Fatalf("unexpected capabilities %v or sysctls %v", hc.CapAdd, hc.Sysctls)
+	}
+	if !reflect.DeepEqual(hc.ExtraHosts, []string{"db:10.0.0.2", "db.local:10.0.0.2"}) {
+		t.Fatalf("unexpected extra hosts %v", hc.ExtraHosts)
+	}
+
+	expected := []struct {
+		typ         mounttypes.Type
+		source      string
+		destination string
+	}{
+		{mounttypes.TypeVolume, "/bundle/volumes/html", "/usr/share/nginx/html"},
+		{mounttypes.TypeBind, "/bundle/secrets/run/secrets/password", "/run/secrets/password"},
+		{mounttypes.TypeBind, "/bundle/configs/etc/nginx/nginx.conf", "/etc/nginx/nginx.conf"},
+	}
+	if len(ctr.Mounts) != len(expected) {
+		t.Fatalf("expected %d mounts, got %#v", len(expected), ctr.Mounts)
+	}
+	for i, m := range expected {
+		got := ctr.Mounts[i]
+		if got.Type != m.typ || got.Source != m.source || got.Destination != m.destination {
+			t.Fatalf("expected mount %v, got %#v", m, got)
+		}
+	}
+
+	files := []ServiceFile{
+		{Path: "/bundle/secrets/run/secrets/password", Data: []byte("s3cret"), Mode: 0400, UID: 101, GID: 101},
+		{Path: "/bundle/configs/etc/nginx/nginx.conf", Data: []byte("events {}"), Mode: 0444},
+	}
+	if !reflect.DeepEqual(ctr.Files, files) {
+		t.Fatalf("expected files %#v, got %#v", files, ctr.Files)
+	}
+}
+
+func TestFromServiceFiles(t *testing.T) {
+	secret := func(name, target string) *swarm.SecretReference {
+		return &swarm.SecretReference{
+			SecretName: name,
+			File:       &swarm.SecretReferenceFileTarget{Name: target, Mode: 0400},
+		}
+	}
+	tests := []struct {
+		secrets []*swarm.SecretReference
+		paths   []string
+		err     bool
+	}{
+		{
+			secrets: []*swarm.SecretReference{secret("db_password", "password"), secret("db_password", "/etc/db/password")},
+			paths:   []string{"/bundle/secrets/run/secrets/password", "/bundle/secrets/etc/db/password"},
+		},
+		{
+			secrets: []*swarm.SecretReference{secret("../../etc/shadow", "password")},
+			err:     true,
+		},
+		{
+			secrets: []*swarm.SecretReference{secret("a", "password"), secret("b", "/run/secrets/password")},
+			err:     true,
+		},
+		{
+			secrets: []*swarm.SecretReference{secret("a", "../../../password")},
+			paths:   []string{"/bundle/secrets/password"},
+		},
+	}
+
+	for _, test := range tests {
+		svc := Service{Spec: ServiceSpec{TaskTemplate: ServiceTaskSpec{ContainerSpec: &ServiceContainerSpec{
+			ContainerSpec: swarm.ContainerSpec{Image: "alpine", Command: []string{"sh"}, Secrets: test.secrets},
+		}}}}
+		ctr, err := FromService(&svc, ServiceOptions{
+			SecretsDir: "/bundle/secrets",
+			SecretData: func(ref *swarm.SecretReference) ([]byte, error) {
+				return []byte(ref.SecretName), nil
+			},
+		})
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error for the secrets %#v", test.secrets)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, f := range ctr.Files {
+			paths = append(paths, f.Path)
+		}
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Fatalf("expected files %v, got %v", test.paths, paths)
+		}
+	}
+}
@@ -10,12 +10,18 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/genuinetools/pkg/cli"
+	"github.com/genuinetools/riddler/inspect"
 	"github.com/genuinetools/riddler/parse"
 	"github.com/genuinetools/riddler/version"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -25,16 +31,33 @@ import (
 //
 const (
 	specConfig = "config.json"
+
+	// pingTimeout is how long to wait for the daemon to tell its API version.
+	pingTimeout = 10 * time.Second
 )
 
 var (
 	bundle     string
-	dockerHost string
+	docker     dockerFlags
+	fromFile   string
+	fromDisk   bool
+	input      string
+	sandbox    string
+	dockerRoot string
 	force      bool
 
+	all         bool
+	filterflags stringSlice
+
+	rootfsMode string
+	imageTar   string
+
 	hooks     specs.Hooks
 	hookflags stringSlice
 
+	cgroupDriver string
+	cgroupParent string
+
 	idroot, idlen       uint32
 	idrootVar, idlenVar int
 
@@ -82,6 +105,19 @@ func (s stringSlice) ParseHooks() (hooks specs.Hooks, err error) {
 	}
 	return hooks, nil
 }
+func (s stringSlice) ParseFilters() (filters.Args, error) {
+	f := filters.NewArgs()
+	for _, v := range s {
+		for _, arg := range strings.Split(v, ",") {
+			var err error
+			f, err = filters.ParseFlag(arg, f)
+			if err != nil {
+				return f, fmt.Errorf("parsing filter %s failed: %v", arg, err)
+			}
+		}
+	}
+	return f, nil
+}
 
 func main() {
 	// Create a new cli program.
@@ -93,11 +129,42 @@ func main() {
 	p.GitCommit = version.GITCOMMIT
 	p.Version = version.VERSION
 
+	// Setup the commands.
+	p.Commands = []cli.Command{
+		&imageCommand{},
+		&ociCommand{},
+		&podCommand{},
+		&composeCommand{},
+		&runArgsCommand{},
+		&serviceCommand{},
+		&watchCommand{},
+		&serveCommand{},
+		&importCommand{},
+		&pinNamespacesCommand{},
+	}
+
 	// Setup the global flags.
 	p.FlagSet = flag.NewFlagSet("global", flag.ExitOnError)
-	p.FlagSet.StringVar(&dockerHost, "host", "unix:///var/run/docker.sock", "Docker Daemon socket(s) to connect to")
+	p.FlagSet.StringVar(&docker.host, "host", "", "Docker Daemon socket(s) to connect to (ex. "+client.DefaultDockerHost+", tcp://host:2376 or ssh://user@host), DOCKER_HOST or the current docker context if not set")
+	p.FlagSet.StringVar(&docker.context, "context", "", "Docker context to connect to, from the config directory of the docker CLI")
+	p.FlagSet.BoolVar(&docker.tls, "tls", false, "Use TLS to connect to the daemon, implied by --tlsverify")
+	p.FlagSet.BoolVar(&docker.tlsVerify, "tlsverify", false, "Use TLS and verify the daemon, or set DOCKER_TLS_VERIFY")
+	p.FlagSet.StringVar(&docker.tlsCACert, "tlscacert", "", "Trust certs signed only by this CA, defaults to ca.pem in DOCKER_CERT_PATH or ~/.docker")
+	p.FlagSet.StringVar(&docker.tlsCert, "tlscert", "", "Path to TLS certificate file, defaults to cert.pem in DOCKER_CERT_PATH or ~/.docker")
+	p.FlagSet.StringVar(&docker.tlsKey, "tlskey", "", "Path to TLS key file, defaults to key.pem in DOCKER_CERT_PATH or ~/.docker")
 	p.FlagSet.StringVar(&bundle, "bundle", "", "Path to the root of the bundle directory")
+	p.FlagSet.StringVar(&fromFile, "from-file", "", "Read saved docker inspect JSON, or docker service inspect JSON for the service command, from a file instead of the daemon (use - for stdin)")
+	p.FlagSet.StringVar(&input, "input", "", "Format of the inspect JSON read with --from-file (docker, podman or cri), detected when not set")
+	p.FlagSet.StringVar(&sandbox, "sandbox", "", "Read the crictl inspectp JSON of the pod sandbox of the cri input from a file")
+	p.FlagSet.BoolVar(&fromDisk, "from-disk", false, "Read the container state saved on disk by the docker daemon instead of asking the daemon")
+	p.FlagSet.StringVar(&dockerRoot, "docker-root", inspect.DefaultDockerRoot, "Root directory of the docker daemon, used with --from-disk")
+	p.FlagSet.BoolVar(&all, "all", false, "Convert all containers, each into its own directory in the bundle directory")
+	p.FlagSet.Var(&filterflags, "filter", "Convert the containers matching the filter, each into its own directory in the bundle directory (ex. --filter label=app=web,status=running)")
+	p.FlagSet.StringVar(&rootfsMode, "rootfs", "", "Populate the rootfs of the bundle from the container (export), its image (image), or mount an overlay of its layers (overlay)")
+	p.FlagSet.StringVar(&imageTar, "image-tar", "", "Read the image from a docker save archive instead of the daemon, used with --rootfs image")
 	p.FlagSet.Var(&hookflags, "hook", "Hooks to prefill into spec file. (ex. --hook prestart:netns)")
+	p.FlagSet.StringVar(&cgroupDriver, "cgroup-driver", parse.CgroupfsDriver, "Cgroup driver of the docker daemon the cgroups path is computed for (cgroupfs or systemd)")
+	p.FlagSet.StringVar(&cgroupParent, "cgroup-parent", "", "Cgroup parent of the docker daemon for the containers without their own, "+parse.DefaultCgroupParent+" or "+parse.DefaultSystemdCgroupParent+" with systemd when not set")
 
 	p.FlagSet.IntVar(&idrootVar, "idroot", 0, "Root UID/GID for user namespaces")
 	p.FlagSet.IntVar(&idlenVar, "idlen", 0, "Length of UID/GID ID space ranges for user namespaces")
@@ -117,8 +184,16 @@ func main() {
 		idroot = uint32(idrootVar)
 		idlen = uint32(idlenVar)
 
-		if p.FlagSet.NArg() < 1 {
-			return errors.New("pass the container name or ID")
+		if err := validateInput(input); err != nil {
+			return err
+		}
+
+		if err := validateRootfsMode(rootfsMode); err != nil {
+			return err
+		}
+
+		if err := validateCgroupDriver(cgroupDriver); err != nil {
+			return err
 		}
 
 		var err error
@@ -139,37 +214,261 @@ func main() {
 			}
 		}()
 
-		defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
-		cli, err := client.NewClient(dockerHost, "", nil, defaultHeaders)
-		if err != nil {
-			panic(err)
+		if len(args) < 1 && fromFile == "" && !all && len(filterflags) == 0 {
+			return errors.New("pass the container name or ID")
 		}
 
-		// get container info
-		ctr, err := cli.ContainerInspect(ctx, args[0])
-		if err != nil {
-			logrus.Fatalf("inspecting container (%s) failed: %v", args[0], err)
+		if all || len(filterflags) > 0 {
+			if err := validateBatchFlags(args); err != nil {
+				return err
+			}
+			f, err := filterflags.ParseFilters()
+			if err != nil {
+				return err
+			}
+
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			return convertAll(ctx, cli, f)
 		}
 
-		spec, err := parse.Config(ctr, runtime.GOOS, runtime.GOARCH, defaultCapabilities(), idroot, idlen)
-		if err != nil {
-			logrus.Fatalf("Spec config conversion for %s failed: %v", args[0], err)
+		var ctrs []container
+		switch {
+		case fromFile != "":
+			// get container info from the saved inspect output
+			var err error
+			ctrs, err = readContainers(fromFile, input, sandbox)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		case fromDisk:
+			// get container info from the state the daemon saved on disk
+			ctr, err := inspect.FromDisk(dockerRoot, args[0], logrus.StandardLogger())
+			if err != nil {
+				logrus.Fatalf("reading container (%s) from %s failed: %v", args[0], dockerRoot, err)
+			}
+			ctrs = append(ctrs, container{
+				ContainerJSON: ctr.ContainerJSON,
+				fixup: func(config *specs.Spec) {
+					ctr.Apply(config, logrus.StandardLogger())
+				},
+			})
+		default:
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			// get container info
+			ctr, err := inspectContainer(ctx, cli, args[0], logrus.StandardLogger())
+			if err != nil {
+				logrus.Fatalf("inspecting container (%s) failed: %v", args[0], err)
+			}
+			if err := joinNamespaces(ctx, cli, &ctr, nil); err != nil {
+				logrus.Fatal(err)
+			}
+			ctrs = append(ctrs, ctr)
 		}
 
-		// fill in hooks, if passed through command line
-		spec.Hooks = &hooks
-		if err := writeConfig(spec); err != nil {
+		// if we were given more than one container, give each its own
+		// directory in the bundle
+		if len(ctrs) > 1 {
+			if err := linkBundles(ctrs, bundle); err != nil {
+				return err
+			}
+			return writeBundles(ctx, bundle, ctrs, nil)
+		}
+
+		if err := convert(ctx, ctrs[0], bundle); err != nil {
 			logrus.Fatal(err)
 		}
 
-		fmt.Printf("%s has been saved.\n", specConfig)
+		fmt.Printf("%s has been saved.\n", filepath.Join(bundle, specConfig))
 		return nil
 	}
 
+	// answer the handshake of the docker CLI, when installed as its plugin
+	if len(os.Args) > 1 && os.Args[1] == pluginMetadataCommand {
+		if err := writePluginMetadata(); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+	// run as `docker riddler`, with the daemon of the docker CLI
+	if os.Getenv(pluginEnv) != "" {
+		args, err := pluginArgs(os.Args[1:], &docker)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		os.Args = append([]string{"docker " + pluginName}, args...)
+	}
+
 	// Run our program.
 	p.Run()
 }
 
+func newClient() (*client.Client, error) {
+	ep, err := docker.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := ep.clientOpts()
+	if err != nil {
+		return nil, err
+	}
+	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
+	opts = append(opts, client.WithVersion(""), client.WithHTTPHeaders(defaultHeaders))
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating docker client for %s failed: %v", ep.Host, err)
+	}
+
+	// speak the API version of the daemon, so that the inspect output has
+	// the fields of newer daemons
+	if v := os.Getenv("DOCKER_API_VERSION"); v != "" {
+		return cli, client.WithVersion(v)(cli)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	ping, err := cli.Ping(ctx)
+	if err != nil {
+		// the requests will tell what is wrong with the daemon
+		logrus.Debugf("pinging the daemon at %s failed, not negotiating the API version: %v", ep.Host, err)
+		return cli, nil
+	}
+	if ping.APIVersion != "" {
+		logrus.Debugf("using API version %s of the daemon at %s", ping.APIVersion, ep.Host)
+		return cli, client.WithVersion(ping.APIVersion)(cli)
+	}
+	return cli, nil
+}
+
+// inspectContainer gets the container from the daemon, keeping the fields of
+// the inspect output that the vendored API types do not have. The warnings
+// about it go to log, as well as the ones of changing its spec later.
+func inspectContainer(ctx context.Context, cli *client.Client, id string, log logrus.FieldLogger) (container, error) {
+	_, raw, err := cli.ContainerInspectWithRaw(ctx, id, false)
+	if err != nil {
+		return container{}, err
+	}
+	ctr, err := inspect.DecodeContainer(raw, log)
+	if err != nil {
+		return container{}, fmt.Errorf("decoding inspect data of %s failed: %v", id, err)
+	}
+	return container{
+		ContainerJSON: ctr.ContainerJSON,
+		fixup: func(config *specs.Spec) {
+			ctr.Apply(config, log)
+		},
+	}, nil
+}
+
+// imageConfigFunc returns the function that gets the config of an image
+// from the daemon, for the conversions that fill in what they leave out from
+// the images.
+func imageConfigFunc(ctx context.Context, cli *client.Client) func(image string) (*containertypes.Config, error) {
+	return func(image string) (*containertypes.Config, error) {
+		img, _, err := cli.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		if img.Config == nil {
+			return nil, errors.New("image has no config")
+		}
+		return img.Config, nil
+	}
+}
+
+// container is a container to convert, along with the changes to its spec
+// that its docker inspect data cannot express.
+type container struct {
+	types.ContainerJSON
+	fixup func(*specs.Spec)
+}
+
+// addFixup adds a change to the spec of the container, after the ones it
+// already has.
+func (c *container) addFixup(f func(*specs.Spec)) {
+	prev := c.fixup
+	c.fixup = func(config *specs.Spec) {
+		if prev != nil {
+			prev(config)
+		}
+		f(config)
+	}
+}
+
+// convert turns the container into a spec and saves it in the bundle dir,
+// then populates the rootfs if asked to.
+func convert(ctx context.Context, ctr container, dir string) error {
+	spec, err := convertSpec(ctr, dir)
+	if err != nil {
+		return err
+	}
+
+	return populateRootfs(ctx, ctr.ContainerJSON, filepath.Join(dir, spec.Root.Path))
+}
+
+// convertSpec turns the container into a spec and saves it in the bundle dir.
+// It fails before writing anything if the rootfs of the bundle cannot be
+// populated.
+func convertSpec(ctr container, dir string) (*specs.Spec, error) {
+	spec, err := generateSpec(ctr, logrus.StandardLogger())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRootfs(filepath.Join(dir, spec.Root.Path)); err != nil {
+		return nil, err
+	}
+	if err := writeConfig(dir, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// generateSpec turns the container into a spec, warning about what cannot be
+// converted to log.
+func generateSpec(ctr container, log logrus.FieldLogger) (*specs.Spec, error) {
+	spec, err := parse.Config(ctr.ContainerJSON, runtime.GOOS, runtime.GOARCH, defaultCapabilities(), idroot, idlen, log)
+	if err != nil {
+		return nil, fmt.Errorf("spec config conversion for %s failed: %v", ctr.Name, err)
+	}
+
+	// fill in hooks, if passed through command line, copied as the fixups
+	// of the containers add their own
+	spec.Hooks = &specs.Hooks{
+		Prestart:  append([]specs.Hook{}, hooks.Prestart...),
+		Poststart: append([]specs.Hook{}, hooks.Poststart...),
+		Poststop:  append([]specs.Hook{}, hooks.Poststop...),
+	}
+
+	// place the container in the cgroups the daemon would
+	if spec.Linux != nil {
+		spec.Linux.CgroupsPath, err = parse.CgroupsPath(ctr.ID, ctr.HostConfig.CgroupParent, cgroupDriver, cgroupParent)
+		if err != nil {
+			return nil, fmt.Errorf("cgroups path for %s failed: %v", ctr.Name, err)
+		}
+	}
+
+	if ctr.fixup != nil {
+		ctr.fixup(spec)
+	}
+	return spec, nil
+}
+
+// validateCgroupDriver checks the cgroup driver passed with --cgroup-driver.
+func validateCgroupDriver(driver string) error {
+	switch driver {
+	case parse.CgroupfsDriver, parse.SystemdDriver:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid cgroup driver, try %q or %q", driver, parse.CgroupfsDriver, parse.SystemdDriver)
+	}
+}
+
 func checkNoFile(name string) error {
 	_, err := os.Stat(name)
 	if err == nil {
@@ -181,17 +480,17 @@ func checkNoFile(name string) error {
 	return nil
 }
 
-func writeConfig(spec *specs.Spec) error {
-	if bundle != "" {
-		// change current working directory
-		if err := os.Chdir(bundle); err != nil {
-			return fmt.Errorf("change working directory to %s failed: %v", bundle, err)
+func writeConfig(dir string, spec *specs.Spec) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating bundle directory %s failed: %v", dir, err)
 		}
 	}
+	file := filepath.Join(dir, specConfig)
 
 	// make sure we don't already have files, we would not want to overwrite them
 	if !force {
-		if err := checkNoFile(specConfig); err != nil {
+		if err := checkNoFile(file); err != nil {
 			return err
 		}
 	}
@@ -201,7 +500,7 @@ func writeConfig(spec *specs.Spec) error {
 		return err
 	}
 
-	return ioutil.WriteFile(specConfig, data, 0666)
+	return ioutil.WriteFile(file, data, 0666)
 }
 
 func defaultCapabilities() []string {
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// nsDir is the directory in the bundle of a container that holds links
+	// to its namespaces while it runs, so other containers can join them.
+	nsDir = "ns"
+	// shmLink is the link in the namespace directory to the /dev/shm of the
+	// container, for the containers sharing its ipc namespace.
+	shmLink = "shm"
+)
+
+var (
+	// procNamespaces are the names of the namespaces in /proc/<pid>/ns.
+	procNamespaces = map[specs.LinuxNamespaceType]string{
+		specs.PIDNamespace:     "pid",
+		specs.NetworkNamespace: "net",
+		specs.MountNamespace:   "mnt",
+		specs.IPCNamespace:     "ipc",
+		specs.UTSNamespace:     "uts",
+		specs.UserNamespace:    "user",
+		specs.CgroupNamespace:  "cgroup",
+	}
+)
+
+// sharedNamespace is a namespace a container shares with another one through
+// a container:<id> mode.
+type sharedNamespace struct {
+	t   specs.LinuxNamespaceType
+	ref string
+}
+
+// sharedNamespaces returns the namespaces the container shares with other
+// containers, referenced by name or id.
+func sharedNamespaces(ctr container) []sharedNamespace {
+	if ctr.HostConfig == nil {
+		return nil
+	}
+	modes := []struct {
+		t    specs.LinuxNamespaceType
+		mode string
+	}{
+		{specs.NetworkNamespace, string(ctr.HostConfig.NetworkMode)},
+		{specs.IPCNamespace, string(ctr.HostConfig.IpcMode)},
+		{specs.PIDNamespace, string(ctr.HostConfig.PidMode)},
+	}
+
+	var shared []sharedNamespace
+	for _, m := range modes {
+		if !strings.HasPrefix(m.mode, "container:") {
+			continue
+		}
+		shared = append(shared, sharedNamespace{
+			t:   m.t,
+			ref: strings.TrimPrefix(strings.TrimPrefix(m.mode, "container:"), "/"),
+		})
+	}
+	return shared
+}
+
+// findContainer returns the index of the container the reference points to,
+// by its name, its id or a prefix of its id, or -1 if none of the containers
+// matches.
+func findContainer(ctrs []container, ref string) int {
+	if ref == "" {
+		return -1
+	}
+	for i, ctr := range ctrs {
+		if bundleName(ctr.ContainerJSON) == ref || ctr.ID == ref {
+			return i
+		}
+	}
+	match := -1
+	for i, ctr := range ctrs {
+		if strings.HasPrefix(ctr.ID, ref) {
+			if match >= 0 {
+				// an ambiguous prefix does not match anything
+				return -1
+			}
+			match = i
+		}
+	}
+	return match
+}
+
+// linkNamespaces makes the containers that share the namespaces of another
+// container being converted with them, through a container:<name> mode,
+// join those namespaces. The other container gets a prestart hook linking
+// its namespaces into its bundle, under outdir/<name>/ns, and the sharing
+// containers use the links as namespace paths, so it has to be started first.
+// The containers sharing the ipc namespace get the /dev/shm of the other one,
+// like docker does, through a link next to the namespaces.
+// It returns the containers each container depends on that way.
+func linkNamespaces(ctrs []container, outdir string) (map[string][]string, error) {
+	abs, err := filepath.Abs(outdir)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := map[string][]string{}
+	shared := map[int]map[specs.LinuxNamespaceType]bool{}
+	for i, ctr := range ctrs {
+		own := bundleName(ctr.ContainerJSON)
+
+		paths := map[specs.LinuxNamespaceType]string{}
+		var shm string
+		for _, ns := range sharedNamespaces(ctr) {
+			j := findContainer(ctrs, ns.ref)
+			if j < 0 {
+				continue
+			}
+			if j == i {
+				return nil, fmt.Errorf("container %s cannot share its own namespaces", own)
+			}
+			name := bundleName(ctrs[j].ContainerJSON)
+
+			if shared[j] == nil {
+				shared[j] = map[specs.LinuxNamespaceType]bool{}
+			}
+			if !contains(deps[own], name) {
+				deps[own] = append(deps[own], name)
+			}
+			shared[j][ns.t] = true
+			paths[ns.t] = filepath.Join(abs, name, nsDir, string(ns.t))
+			// namespaces belong to a user namespace, so that has to be
+			// shared as well if the container gets one
+			shared[j][specs.UserNamespace] = true
+			paths[specs.UserNamespace] = filepath.Join(abs, name, nsDir, string(specs.UserNamespace))
+			if ns.t == specs.IPCNamespace {
+				shm = filepath.Join(abs, name, nsDir, shmLink)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		ctrs[i].addFixup(joinPaths(paths))
+		if shm != "" {
+			ctrs[i].addFixup(bindShm(shm))
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("getting the path of riddler for the namespace hook failed: %v", err)
+	}
+	for j, nsTypes := range shared {
+		args := []string{"riddler", "pin-namespaces", filepath.Join(abs, bundleName(ctrs[j].ContainerJSON), nsDir)}
+		for t := range nsTypes {
+			args = append(args, string(t))
+		}
+		// keep the spec the same between runs
+		sort.Strings(args[3:])
+		hook := specs.Hook{
+			Path: self,
+			Args: args,
+		}
+		ctrs[j].addFixup(func(config *specs.Spec) {
+			// copy the hooks, they are shared with the other containers
+			h := specs.Hooks{}
+			if config.Hooks != nil {
+				h = *config.Hooks
+			}
+			h.Prestart = append(append([]specs.Hook{}, h.Prestart...), hook)
+			config.Hooks = &h
+		})
+	}
+
+	return deps, nil
+}
+
+// joinNamespaces makes the container join the namespaces it shares with
+// running containers of the daemon, through their /proc/<pid>/ns paths.
+// The containers in ctrs are skipped, linkNamespaces takes care of those.
+func joinNamespaces(ctx context.Context, cli *client.Client, ctr *container, ctrs []container) error {
+	paths := map[specs.LinuxNamespaceType]string{}
+	var shm string
+	for _, ns := range sharedNamespaces(*ctr) {
+		if findContainer(ctrs, ns.ref) >= 0 {
+			continue
+		}
+
+		target, err := cli.ContainerInspect(ctx, ns.ref)
+		if err != nil {
+			return fmt.Errorf("inspecting container (%s) to share its %s namespace failed: %v", ns.ref, ns.t, err)
+		}
+		if target.State == nil || !target.State.Running || target.State.Pid <= 0 {
+			return fmt.Errorf("container %s shares the %s namespace of container %s, which is not running", bundleName(ctr.ContainerJSON), ns.t, ns.ref)
+		}
+
+		proc := fmt.Sprintf("/proc/%d", target.State.Pid)
+		paths[ns.t] = filepath.Join(proc, "ns", procNamespaces[ns.t])
+		paths[specs.UserNamespace] = filepath.Join(proc, "ns", procNamespaces[specs.UserNamespace])
+		if ns.t == specs.IPCNamespace {
+			// docker gives the container the /dev/shm of the other one
+			shm = filepath.Join(proc, "root", "dev", "shm")
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	ctr.addFixup(joinPaths(paths))
+	if shm != "" {
+		ctr.addFixup(bindShm(shm))
+	}
+	return nil
+}
+
+// bindShm returns a change to the spec replacing the /dev/shm of the
+// container with a bind mount of the /dev/shm of the container whose ipc
+// namespace it shares.
+func bindShm(shm string) func(*specs.Spec) {
+	return func(config *specs.Spec) {
+		for i, m := range config.Mounts {
+			if m.Destination == "/dev/shm" && m.Type == "tmpfs" {
+				config.Mounts[i] = specs.Mount{
+					Destination: "/dev/shm",
+					Type:        "bind",
+					Source:      shm,
+					Options:     []string{"rbind", "rprivate"},
+				}
+			}
+		}
+	}
+}
+
+// joinPaths returns a change to the spec setting the paths of the namespaces,
+// the user namespace is only joined if the container gets one.
+func joinPaths(paths map[specs.LinuxNamespaceType]string) func(*specs.Spec) {
+	return func(config *specs.Spec) {
+		for t, path := range paths {
+			if t == specs.UserNamespace && !parse.HasNamespace(config, t) {
+				continue
+			}
+			parse.NamespacePath(config, t, path)
+		}
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+const pinNamespacesHelp = `Link the namespaces of a starting container into a directory, run as a prestart hook.`
+
+func (cmd *pinNamespacesCommand) Name() string      { return "pin-namespaces" }
+func (cmd *pinNamespacesCommand) Args() string      { return "DIR TYPE..." }
+func (cmd *pinNamespacesCommand) ShortHelp() string { return pinNamespacesHelp }
+func (cmd *pinNamespacesCommand) LongHelp() string  { return pinNamespacesHelp }
+func (cmd *pinNamespacesCommand) Hidden() bool      { return true }
+
+func (cmd *pinNamespacesCommand) Register(fs *flag.FlagSet) {}
+
+type pinNamespacesCommand struct{}
+
+func (cmd *pinNamespacesCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("pass the directory and the namespace types")
+	}
+
+	// the runtime passes the state of the container on stdin
+	var state specs.State
+	if err := json.NewDecoder(os.Stdin).Decode(&state); err != nil {
+		return fmt.Errorf("decoding container state failed: %v", err)
+	}
+	if state.Pid <= 0 {
+		return errors.New("container state has no pid")
+	}
+
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating namespace directory %s failed: %v", dir, err)
+	}
+	for _, t := range args[1:] {
+		name, ok := procNamespaces[specs.LinuxNamespaceType(t)]
+		if !ok {
+			return fmt.Errorf("%s is not a valid namespace type", t)
+		}
+
+		link := filepath.Join(dir, t)
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(fmt.Sprintf("/proc/%d/ns/%s", state.Pid, name), link); err != nil {
+			return fmt.Errorf("linking %s namespace failed: %v", t, err)
+		}
+
+		// the containers sharing the ipc namespace mount its /dev/shm
+		if specs.LinuxNamespaceType(t) == specs.IPCNamespace {
+			link := filepath.Join(dir, shmLink)
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err := os.Symlink(fmt.Sprintf("/proc/%d/root/dev/shm", state.Pid), link); err != nil {
+				return fmt.Errorf("linking /dev/shm failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
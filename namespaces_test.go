@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestLinkNamespacesShm(t *testing.T) {
+	newContainer := func(name, ipc string) container {
+		return container{ContainerJSON: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         name + "1111",
+				Name:       "/" + name,
+				HostConfig: &containertypes.HostConfig{IpcMode: containertypes.IpcMode(ipc)},
+			},
+		}}
+	}
+	ctrs := []container{
+		newContainer("db", "shareable"),
+		newContainer("app", "container:db"),
+	}
+
+	out, err := ioutil.TempDir("", "riddler-namespaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	deps, err := linkNamespaces(ctrs, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps["app"]) != 1 || deps["app"][0] != "db" {
+		t.Fatalf("expected app to depend on db, got %v", deps)
+	}
+
+	spec := &specs.Spec{
+		Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{{Type: specs.IPCNamespace}}},
+		Mounts: []specs.Mount{
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm"},
+		},
+	}
+	ctrs[1].fixup(spec)
+
+	dir := filepath.Join(out, "db", nsDir)
+	if !parse.HasNamespace(spec, specs.IPCNamespace) || spec.Linux.Namespaces[0].Path != filepath.Join(dir, string(specs.IPCNamespace)) {
+		t.Fatalf("expected the ipc namespace of db to be joined, got %+v", spec.Linux.Namespaces)
+	}
+	m := spec.Mounts[0]
+	if m.Type != "bind" || m.Source != filepath.Join(dir, shmLink) {
+		t.Fatalf("expected /dev/shm of db to be mounted, got %+v", m)
+	}
+
+	// the container sharing its namespaces gets the hook linking them
+	spec = &specs.Spec{}
+	ctrs[0].fixup(spec)
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 {
+		t.Fatalf("expected a prestart hook for db, got %+v", spec.Hooks)
+	}
+}
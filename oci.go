@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/genuinetools/riddler/rootfs"
+)
+
+const ociHelp = `Convert an image from an OCI image layout directory into a spec, without a docker daemon.`
+
+func (cmd *ociCommand) Name() string      { return "oci" }
+func (cmd *ociCommand) Args() string      { return "[OPTIONS] LAYOUT" }
+func (cmd *ociCommand) ShortHelp() string { return ociHelp }
+func (cmd *ociCommand) LongHelp() string  { return ociHelp }
+func (cmd *ociCommand) Hidden() bool      { return false }
+
+func (cmd *ociCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.ref, "ref", "", "Select the image by its org.opencontainers.image.ref.name annotation")
+	fs.StringVar(&cmd.platform, "platform", runtime.GOOS+"/"+runtime.GOARCH, "Select the image for the platform (os/arch[/variant])")
+}
+
+type ociCommand struct {
+	ref      string
+	platform string
+}
+
+func (cmd *ociCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("pass the image layout directory")
+	}
+	if rootfsMode != "" && rootfsMode != rootfsImage {
+		return fmt.Errorf("only --rootfs %s is supported for image layouts", rootfsImage)
+	}
+
+	img, err := inspect.FromOCILayout(args[0], cmd.ref, cmd.platform)
+	if err != nil {
+		return fmt.Errorf("reading image layout %s failed: %v", args[0], err)
+	}
+
+	ctr, err := img.Container()
+	if err != nil {
+		return fmt.Errorf("converting image from %s failed: %v", args[0], err)
+	}
+
+	spec, err := convertSpec(container{ContainerJSON: ctr}, bundle)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(bundle, spec.Root.Path)
+	if rootfsMode == rootfsImage {
+		// apply the layers in order
+		for _, layer := range img.Manifest.Layers {
+			path, err := img.BlobPath(layer.Digest)
+			if err != nil {
+				return err
+			}
+			if err := rootfs.ApplyLayerFile(path, dir); err != nil {
+				return fmt.Errorf("applying layer %s failed: %v", layer.Digest, err)
+			}
+		}
+	}
+
+	if err := createImageVolumes(ctr, bundle, dir); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has been saved.\n", filepath.Join(bundle, specConfig))
+	return nil
+}
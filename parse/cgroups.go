@@ -0,0 +1,60 @@
+package parse
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// CgroupfsDriver is the cgroup driver of the docker daemon managing the
+	// cgroups through the cgroup filesystem.
+	CgroupfsDriver = "cgroupfs"
+	// SystemdDriver is the cgroup driver of the docker daemon managing the
+	// cgroups as systemd scopes.
+	SystemdDriver = "systemd"
+
+	// DefaultCgroupParent is the parent of the cgroups of the containers
+	// with the cgroupfs driver.
+	DefaultCgroupParent = "/docker"
+	// DefaultSystemdCgroupParent is the slice of the containers with the
+	// systemd driver.
+	DefaultSystemdCgroupParent = "system.slice"
+
+	// systemdScopePrefix is the prefix of the scopes docker creates for the
+	// containers, they are named docker-<id>.scope.
+	systemdScopePrefix = "docker"
+)
+
+// CgroupsPath returns the cgroups path the docker daemon gives the container
+// with the id, for the cgroup driver. The cgroup parent of the container
+// goes before the default parent of the daemon, which goes before the
+// default of the driver.
+func CgroupsPath(id, cgroupParent, driver, defaultParent string) (string, error) {
+	if id == "" {
+		// runc picks the path for what is not a container of docker
+		return "", nil
+	}
+
+	parent := cgroupParent
+	if parent == "" {
+		parent = defaultParent
+	}
+
+	switch driver {
+	case "", CgroupfsDriver:
+		if parent == "" {
+			parent = DefaultCgroupParent
+		}
+		return path.Join(parent, id), nil
+	case SystemdDriver:
+		if parent == "" {
+			parent = DefaultSystemdCgroupParent
+		}
+		if !strings.HasSuffix(parent, ".slice") {
+			return "", fmt.Errorf("cgroup parent %s for the systemd cgroup driver should be a valid slice named as \"xxx.slice\"", parent)
+		}
+		return parent + ":" + systemdScopePrefix + ":" + id, nil
+	}
+	return "", fmt.Errorf("%s is not a valid cgroup driver, try %q or %q", driver, CgroupfsDriver, SystemdDriver)
+}
@@ -0,0 +1,38 @@
+package parse
+
+import "testing"
+
+func TestCgroupsPath(t *testing.T) {
+	tests := []struct {
+		id, cgroupParent, driver, defaultParent string
+		expected                                string
+		err                                     bool
+	}{
+		{id: "", driver: CgroupfsDriver, expected: ""},
+		{id: "abc", driver: CgroupfsDriver, expected: "/docker/abc"},
+		{id: "abc", driver: "", expected: "/docker/abc"},
+		{id: "abc", cgroupParent: "/custom", driver: CgroupfsDriver, defaultParent: "/daemon", expected: "/custom/abc"},
+		{id: "abc", driver: CgroupfsDriver, defaultParent: "/daemon", expected: "/daemon/abc"},
+		{id: "abc", driver: SystemdDriver, expected: "system.slice:docker:abc"},
+		{id: "abc", cgroupParent: "accounting.slice", driver: SystemdDriver, defaultParent: "daemon.slice", expected: "accounting.slice:docker:abc"},
+		{id: "abc", driver: SystemdDriver, defaultParent: "daemon.slice", expected: "daemon.slice:docker:abc"},
+		{id: "abc", cgroupParent: "/custom", driver: SystemdDriver, err: true},
+		{id: "abc", driver: "cgroupv3", err: true},
+	}
+
+	for _, test := range tests {
+		path, err := CgroupsPath(test.id, test.cgroupParent, test.driver, test.defaultParent)
+		if test.err {
+			if err == nil {
+				t.Fatalf("%#v: expected an error, got %s", test, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%#v: %v", test, err)
+		}
+		if path != test.expected {
+			t.Fatalf("%#v: expected %s, got %s", test, test.expected, path)
+		}
+	}
+}
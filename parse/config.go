@@ -2,6 +2,8 @@ package parse
 
 import (
 	"fmt"
+	"os/exec"
+	"sort"
 	"strings"
 
 	"github.com/docker/docker/api/types"
@@ -25,10 +27,24 @@ const (
 	// DefaultTerminal is the default TERM for containers.
 	DefaultTerminal = "xterm"
 
+	// InitPath is where the init of `docker run --init` is mounted in the
+	// container.
+	InitPath = "/sbin/docker-init"
+	// DefaultInitBinary is the init the docker daemon uses for `--init` when
+	// docker-init is not in the PATH.
+	DefaultInitBinary = "/usr/bin/docker-init"
+
 	// DefaultUserNSHostID is the default start mapped host id for userns.
 	DefaultUserNSHostID = 886432
 	// DefaultUserNSMapSize is the default size for the uid and gid mappings for userns.
 	DefaultUserNSMapSize = 46578392
+
+	// AnnotationExposedPorts is the annotation holding the ports exposed by
+	// the container, as defined by the image spec conversion rules.
+	AnnotationExposedPorts = "org.opencontainers.image.exposedPorts"
+	// AnnotationStopSignal is the annotation holding the signal used to
+	// stop the container, as defined by the image spec conversion rules.
+	AnnotationStopSignal = "org.opencontainers.image.stopSignal"
 )
 
 var (
@@ -38,6 +54,16 @@ var (
 		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
 	}
 
+	// DefaultRlimits are the rlimits of a container, unless it sets its own
+	// ulimits.
+	DefaultRlimits = []specs.POSIXRlimit{
+		{
+			Type: "RLIMIT_NOFILE",
+			Hard: uint64(1024),
+			Soft: uint64(1024),
+		},
+	}
+
 	// DefaultMounts are the default mounts for a container.
 	DefaultMounts = []specs.Mount{
 		{
@@ -101,8 +127,9 @@ var (
 	}
 )
 
-// Config takes ContainerJSON and converts it into the opencontainers spec.
-func Config(c types.ContainerJSON, osType, architecture string, capabilities []string, idroot, idlen uint32) (config *specs.Spec, err error) {
+// Config takes ContainerJSON and converts it into the opencontainers spec,
+// warning about what it cannot convert to log.
+func Config(c types.ContainerJSON, osType, architecture string, capabilities []string, idroot, idlen uint32, log logrus.FieldLogger) (config *specs.Spec, err error) {
 	// for user namespaces use defaults unless another range specified
 	if idroot == 0 {
 		idroot = DefaultUserNSHostID
@@ -113,19 +140,11 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 	config = &specs.Spec{
 		Version: SpecVersion,
 		Process: &specs.Process{
-			Terminal: c.Config.Tty,
-			User:     specs.User{},
-			Args:     append([]string{c.Path}, c.Args...),
-			Env:      c.Config.Env,
-			Cwd:      c.Config.WorkingDir,
-			// TODO: add parsing of Ulimits
-			Rlimits: []specs.POSIXRlimit{
-				{
-					Type: "RLIMIT_NOFILE",
-					Hard: uint64(1024),
-					Soft: uint64(1024),
-				},
-			},
+			Terminal:        c.Config.Tty,
+			User:            specs.User{},
+			Args:            append([]string{c.Path}, c.Args...),
+			Env:             c.Config.Env,
+			Cwd:             c.Config.WorkingDir,
 			NoNewPrivileges: true,
 			ApparmorProfile: c.AppArmorProfile,
 			OOMScoreAdj:     &c.HostConfig.OomScoreAdj,
@@ -137,12 +156,6 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		Mounts: []specs.Mount{},
 		Linux: &specs.Linux{
 			Namespaces: []specs.LinuxNamespace{
-				{
-					Type: "ipc",
-				},
-				{
-					Type: "uts",
-				},
 				{
 					Type: "mount",
 				},
@@ -168,30 +181,12 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 						Access: "rwm",
 					},
 				},
-				Memory: &specs.LinuxMemory{
-					Limit:            int64ptr(c.HostConfig.Resources.Memory),
-					Reservation:      int64ptr(c.HostConfig.Resources.MemoryReservation),
-					Swap:             int64ptr(c.HostConfig.Resources.MemorySwap),
-					Swappiness:       uint64ptrfptr(c.HostConfig.Resources.MemorySwappiness),
-					Kernel:           int64ptr(c.HostConfig.Resources.KernelMemory),
-					DisableOOMKiller: c.HostConfig.Resources.OomKillDisable,
-				},
-				CPU: &specs.LinuxCPU{
-					Shares: uint64ptr(c.HostConfig.Resources.CPUShares),
-					Quota:  int64ptr(c.HostConfig.Resources.CPUQuota),
-					Period: uint64ptr(c.HostConfig.Resources.CPUPeriod),
-					Cpus:   c.HostConfig.Resources.CpusetCpus,
-					Mems:   c.HostConfig.Resources.CpusetMems,
-				},
-				Pids: &specs.LinuxPids{
-					Limit: c.HostConfig.Resources.PidsLimit,
-				},
-				BlockIO: &specs.LinuxBlockIO{
-					Weight: &c.HostConfig.Resources.BlkioWeight,
-					// TODO: add parsing for Throttle/Weight Devices
-				},
+				BlockIO: &specs.LinuxBlockIO{},
 			},
 			RootfsPropagation: "",
+			Sysctl:            c.HostConfig.Sysctls,
+			MaskedPaths:       c.HostConfig.MaskedPaths,
+			ReadonlyPaths:     c.HostConfig.ReadonlyPaths,
 		},
 	}
 
@@ -200,32 +195,56 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		config.Process.Cwd = DefaultCurrentWorkingDirectory
 	}
 
-	// get the user
+	// get the user, numeric ids do not need to be in /etc/passwd
 	if c.Config.User != "" {
-		u, err := user.LookupUser(c.Config.User)
-		if err != nil {
+		passwdPath, _ := user.GetPasswdPath()
+		groupPath, _ := user.GetGroupPath()
+		u, err := user.GetExecUserPath(c.Config.User, nil, passwdPath, groupPath)
+		if err == nil {
 			config.Process.User = specs.User{
 				UID: uint32(u.Uid),
 				GID: uint32(u.Gid),
 			}
 		} else {
 			//return nil, fmt.Errorf("Looking up user (%s) failed: %v", c.Config.User, err)
-			logrus.Warnf("Looking up user (%s) failed: %v", c.Config.User, err)
+			log.Warnf("Looking up user (%s) failed: %v", c.Config.User, err)
 		}
 	}
 	// add the additional groups
 	for _, group := range c.HostConfig.GroupAdd {
-		g, err := user.LookupGroup(group)
+		gid, err := lookupGid(group)
 		if err != nil {
 			return nil, fmt.Errorf("looking up group (%s) failed: %v", group, err)
 		}
-		config.Process.User.AdditionalGids = append(config.Process.User.AdditionalGids, uint32(g.Gid))
+		config.Process.User.AdditionalGids = append(config.Process.User.AdditionalGids, gid)
 	}
 
 	// get the hostname, if the hostname is the name as the first 12 characters of the id,
-	// then set the hostname as the container name
-	if c.ID[:12] == c.Config.Hostname {
+	// then set the hostname as the container name, the host keeps its own
+	if c.HostConfig.UTSMode.IsHost() {
+		config.Hostname = ""
+	} else if len(c.ID) >= 12 && c.ID[:12] == c.Config.Hostname {
 		config.Hostname = strings.TrimPrefix(c.Name, "/")
+	} else {
+		config.Hostname = c.Config.Hostname
+	}
+
+	// keep the settings that have no place in the spec as annotations
+	if c.Config.StopSignal != "" {
+		config.Annotations = map[string]string{
+			AnnotationStopSignal: c.Config.StopSignal,
+		}
+	}
+	if len(c.Config.ExposedPorts) > 0 {
+		var ports []string
+		for port := range c.Config.ExposedPorts {
+			ports = append(ports, string(port))
+		}
+		sort.Strings(ports)
+		if config.Annotations == nil {
+			config.Annotations = map[string]string{}
+		}
+		config.Annotations[AnnotationExposedPorts] = strings.Join(ports, ",")
 	}
 
 	// set privileged
@@ -271,7 +290,41 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		}
 	}
 
-	// check namespaces
+	// keep the size of the console the container was created with
+	if config.Process.Terminal && c.HostConfig.ConsoleSize[0] > 0 && c.HostConfig.ConsoleSize[1] > 0 {
+		config.Process.ConsoleSize = &specs.Box{
+			Height: c.HostConfig.ConsoleSize[0],
+			Width:  c.HostConfig.ConsoleSize[1],
+		}
+	}
+
+	// run the process under the init of the host, like `docker run --init`
+	if c.HostConfig.Init != nil && *c.HostConfig.Init {
+		initBinary, err := exec.LookPath("docker-init")
+		if err != nil {
+			initBinary = DefaultInitBinary
+		}
+		config.Process.Args = append([]string{InitPath, "--"}, config.Process.Args...)
+		config.Mounts = append(config.Mounts, specs.Mount{
+			Destination: InitPath,
+			Type:        "bind",
+			Source:      initBinary,
+			Options:     []string{"bind", "ro"},
+		})
+	}
+
+	// check namespaces, the ones of container:<id> modes are created as well
+	// until the caller points them at the namespaces of the other container
+	if !c.HostConfig.IpcMode.IsHost() {
+		config.Linux.Namespaces = append(config.Linux.Namespaces, specs.LinuxNamespace{
+			Type: "ipc",
+		})
+	}
+	if !c.HostConfig.UTSMode.IsHost() {
+		config.Linux.Namespaces = append(config.Linux.Namespaces, specs.LinuxNamespace{
+			Type: "uts",
+		})
+	}
 	if !c.HostConfig.NetworkMode.IsHost() {
 		config.Linux.Namespaces = append(config.Linux.Namespaces, specs.LinuxNamespace{
 			Type: "network",
@@ -300,10 +353,21 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		if mount.RW {
 			opt = append(opt, "rw")
 		}
-		if mount.Mode != "" {
-			opt = append(opt, mount.Mode)
+		propagation := "rprivate"
+		if mount.Propagation != "" {
+			propagation = string(mount.Propagation)
+		}
+		for _, o := range strings.Split(mount.Mode, ",") {
+			// the propagation is set once, below
+			switch o {
+			case "":
+			case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+				propagation = o
+			default:
+				opt = append(opt, o)
+			}
 		}
-		opt = append(opt, []string{"rbind", "rprivate"}...)
+		opt = append(opt, []string{"rbind", propagation}...)
 
 		config.Mounts = append(config.Mounts, specs.Mount{
 			Destination: mount.Destination,
@@ -313,14 +377,38 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		})
 	}
 
-	// add /etc/hosts and /etc/resolv.conf if we should have networking
+	// the tmpfs mounts get the defaults of docker, before their own options
+	var tmpfs []string
+	for dest := range c.HostConfig.Tmpfs {
+		if _, ok := mounts[dest]; !ok {
+			tmpfs = append(tmpfs, dest)
+		}
+	}
+	sort.Strings(tmpfs)
+	for _, dest := range tmpfs {
+		mounts[dest] = true
+		opt := []string{"noexec", "nosuid", "nodev"}
+		if o := c.HostConfig.Tmpfs[dest]; o != "" {
+			opt = append(opt, strings.Split(o, ",")...)
+		}
+		config.Mounts = append(config.Mounts, specs.Mount{
+			Destination: dest,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     opt,
+		})
+	}
+
+	// add /etc/hosts and /etc/resolv.conf if we should have networking,
+	// copy the defaults so converting many containers does not add them twice
+	defaultMounts := ipcMounts(append([]specs.Mount{}, DefaultMounts...), c.HostConfig)
 	if c.HostConfig.NetworkMode != "none" && c.HostConfig.NetworkMode != "host" {
-		DefaultMounts = append(DefaultMounts, NetworkMounts...)
+		defaultMounts = append(defaultMounts, NetworkMounts...)
 	}
 
 	// if we aren't doing something crazy like mounting a default mount ourselves,
 	// the we can mount it the default way
-	for _, mount := range DefaultMounts {
+	for _, mount := range defaultMounts {
 		if _, ok := mounts[mount.Destination]; !ok {
 			config.Mounts = append(config.Mounts, mount)
 		}
@@ -354,5 +442,20 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		return nil, err
 	}
 
+	// parse the ulimits
+	if err := parseUlimits(config, c.HostConfig); err != nil {
+		return nil, err
+	}
+
+	// parse the cgroup limits
+	if err := parseResources(config, c.HostConfig.Resources); err != nil {
+		return nil, err
+	}
+
+	// parse the weights and throttles of block devices
+	if err := parseBlkioDevices(config, c.HostConfig); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
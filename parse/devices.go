@@ -7,6 +7,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/docker/docker/api/types/blkiodev"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
@@ -14,6 +15,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// lstat looks up the devices, the tests replace it to fake them.
+var lstat = os.Lstat
+
 func mergeDevices(defaultDevices []*configs.Device, userDevices []specs.LinuxDevice, userDeviceCgroup []specs.LinuxDeviceCgroup, hasTty bool) (devs []specs.LinuxDevice, dc []specs.LinuxDeviceCgroup) {
 	paths := map[string]specs.LinuxDevice{}
 	for _, d := range userDevices {
@@ -107,9 +111,63 @@ func getDevicesFromPath(deviceMapping containertypes.DeviceMapping) (devs []spec
 	return devs, dc, fmt.Errorf("gathering device information while adding custom device (%s) failed: %s", deviceMapping.PathOnHost, err)
 }
 
+// parseBlkioDevices sets the weights and throttles of the block devices of
+// the host config, by the numbers of the devices.
+func parseBlkioDevices(config *specs.Spec, hc *containertypes.HostConfig) error {
+	blkio := config.Linux.Resources.BlockIO
+	for _, wd := range hc.BlkioWeightDevice {
+		major, minor, err := blockDevice(wd.Path)
+		if err != nil {
+			return err
+		}
+		weight := wd.Weight
+		d := specs.LinuxWeightDevice{Weight: &weight}
+		d.Major, d.Minor = major, minor
+		blkio.WeightDevice = append(blkio.WeightDevice, d)
+	}
+
+	for _, t := range []struct {
+		devices []*blkiodev.ThrottleDevice
+		spec    *[]specs.LinuxThrottleDevice
+	}{
+		{hc.BlkioDeviceReadBps, &blkio.ThrottleReadBpsDevice},
+		{hc.BlkioDeviceWriteBps, &blkio.ThrottleWriteBpsDevice},
+		{hc.BlkioDeviceReadIOps, &blkio.ThrottleReadIOPSDevice},
+		{hc.BlkioDeviceWriteIOps, &blkio.ThrottleWriteIOPSDevice},
+	} {
+		for _, td := range t.devices {
+			major, minor, err := blockDevice(td.Path)
+			if err != nil {
+				return err
+			}
+			d := specs.LinuxThrottleDevice{Rate: td.Rate}
+			d.Major, d.Minor = major, minor
+			*t.spec = append(*t.spec, d)
+		}
+	}
+	return nil
+}
+
+// blockDevice returns the numbers of the block device at path, which can be
+// a symlink like the ones in /dev/disk.
+func blockDevice(path string) (int64, int64, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("resolving block device %s failed: %v", path, err)
+	}
+	dev, _, err := deviceFromPath(resolved, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("resolving block device %s failed: %v", path, err)
+	}
+	if dev.Type != "b" {
+		return 0, 0, fmt.Errorf("resolving block device %s failed: it is not a block device", path)
+	}
+	return dev.Major, dev.Minor, nil
+}
+
 // deviceFromPath takes the path to a device and it's cgroup_permissions(which cannot be easily queried) and looks up the information about a linux device.
 func deviceFromPath(path, permissions string) (*specs.LinuxDevice, *specs.LinuxDeviceCgroup, error) {
-	fileInfo, err := os.Lstat(path)
+	fileInfo, err := lstat(path)
 	if err != nil {
 		return nil, nil, err
 	}
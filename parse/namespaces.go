@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// NamespacePath makes the container join the existing namespace of type t at
+// path, instead of creating a new one.
+func NamespacePath(config *specs.Spec, t specs.LinuxNamespaceType, path string) {
+	for k, ns := range config.Linux.Namespaces {
+		if ns.Type == t {
+			config.Linux.Namespaces[k].Path = path
+			return
+		}
+	}
+	config.Linux.Namespaces = append(config.Linux.Namespaces, specs.LinuxNamespace{
+		Type: t,
+		Path: path,
+	})
+}
+
+// UserNamespace replaces the uid and gid mappings of the container. Without
+// any mappings the container does not get a user namespace.
+func UserNamespace(config *specs.Spec, uidMappings, gidMappings []specs.LinuxIDMapping) {
+	hadUserNS := HasNamespace(config, specs.UserNamespace)
+	hasUserNS := len(uidMappings) > 0 || len(gidMappings) > 0
+
+	config.Linux.UIDMappings = uidMappings
+	config.Linux.GIDMappings = gidMappings
+	if config.Linux.UIDMappings == nil {
+		config.Linux.UIDMappings = []specs.LinuxIDMapping{}
+	}
+	if config.Linux.GIDMappings == nil {
+		config.Linux.GIDMappings = []specs.LinuxIDMapping{}
+	}
+
+	if hadUserNS == hasUserNS {
+		return
+	}
+
+	if hasUserNS {
+		config.Linux.Namespaces = append(config.Linux.Namespaces, specs.LinuxNamespace{
+			Type: specs.UserNamespace,
+		})
+	} else {
+		var namespaces []specs.LinuxNamespace
+		for _, ns := range config.Linux.Namespaces {
+			if ns.Type != specs.UserNamespace {
+				namespaces = append(namespaces, ns)
+			}
+		}
+		config.Linux.Namespaces = namespaces
+	}
+
+	// the default mounts for cgroups and devpts differ without user namespaces
+	// see: https://github.com/opencontainers/runc/issues/225#issuecomment-136519577
+	setMountOption(config, "/sys/fs/cgroup", "ro", !hasUserNS)
+	setMountOption(config, "/dev/pts", "gid=5", !hasUserNS)
+}
+
+// HasNamespace reports whether the container gets a namespace of type t.
+func HasNamespace(config *specs.Spec, t specs.LinuxNamespaceType) bool {
+	for _, ns := range config.Linux.Namespaces {
+		if ns.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// setMountOption adds or removes the option from the mount at destination.
+func setMountOption(config *specs.Spec, destination, option string, set bool) {
+	for k, mount := range config.Mounts {
+		if mount.Destination != destination {
+			continue
+		}
+
+		var opts []string
+		for _, o := range mount.Options {
+			if o != option {
+				opts = append(opts, o)
+			}
+		}
+		if set {
+			opts = append(opts, option)
+		}
+		config.Mounts[k].Options = opts
+	}
+}
+
+// ipcMounts changes the /dev/shm of the default mounts for the ipc mode: the
+// host shares its own, none has none, and the others get one of the size of
+// the container.
+func ipcMounts(mounts []specs.Mount, hc *containertypes.HostConfig) []specs.Mount {
+	var ipc []specs.Mount
+	for _, m := range mounts {
+		if m.Destination != "/dev/shm" {
+			ipc = append(ipc, m)
+			continue
+		}
+		switch {
+		case hc.IpcMode.IsHost():
+			ipc = append(ipc, specs.Mount{
+				Destination: "/dev/shm",
+				Type:        "bind",
+				Source:      "/dev/shm",
+				Options:     []string{"rbind", "rprivate"},
+			})
+		case hc.IpcMode.IsNone():
+		default:
+			if hc.ShmSize > 0 {
+				var opts []string
+				for _, o := range m.Options {
+					if !strings.HasPrefix(o, "size=") {
+						opts = append(opts, o)
+					}
+				}
+				m.Options = append(opts, fmt.Sprintf("size=%dk", hc.ShmSize/1024))
+			}
+			ipc = append(ipc, m)
+		}
+	}
+	return ipc
+}
@@ -3,6 +3,7 @@ package parse
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	containertypes "github.com/docker/docker/api/types/container"
@@ -11,6 +12,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer/user"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/selinux/go-selinux/label"
+	"golang.org/x/sys/unix"
 )
 
 func parseDevices(config *specs.Spec, hc *containertypes.HostConfig) error {
@@ -64,11 +66,10 @@ func parseDevices(config *specs.Spec, hc *containertypes.HostConfig) error {
 func parseMappings(config *specs.Spec, hc *containertypes.HostConfig) error {
 	for _, g := range hc.GroupAdd {
 		var newGidMap = []specs.LinuxIDMapping{}
-		group, err := user.LookupGroup(g)
+		gid, err := lookupGid(g)
 		if err != nil {
 			return fmt.Errorf("looking up group %s failed: %v", g, err)
 		}
-		gid := uint32(group.Gid)
 
 		for _, gm := range config.Linux.GIDMappings {
 			if (gm.ContainerID+gm.Size) >= gid && gm.ContainerID <= gid {
@@ -107,6 +108,9 @@ func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
 
 	var customSeccompProfile bool
 	for _, opt := range hc.SecurityOpt {
+		if opt == "no-new-privileges" {
+			opt += "=true"
+		}
 		con := strings.SplitN(opt, "=", 2)
 		if len(con) <= 1 {
 			// try : instead
@@ -120,6 +124,10 @@ func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
 			labelOpts = append(labelOpts, con[1])
 		case "apparmor":
 			config.Process.ApparmorProfile = con[1]
+		case "no-new-privileges":
+			if config.Process.NoNewPrivileges, err = strconv.ParseBool(con[1]); err != nil {
+				return fmt.Errorf("invalid no-new-privileges security-opt: %q", opt)
+			}
 		case "seccomp":
 			customSeccompProfile = true
 			if con[1] != "unconfined" {
@@ -155,3 +163,88 @@ func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
 	config.Process.SelinuxLabel, _, err = label.InitLabels(labelOpts)
 	return err
 }
+
+// rlimitTypes are the rlimits of the names of docker ulimits.
+var rlimitTypes = map[string]string{
+	"as":         "RLIMIT_AS",
+	"core":       "RLIMIT_CORE",
+	"cpu":        "RLIMIT_CPU",
+	"data":       "RLIMIT_DATA",
+	"fsize":      "RLIMIT_FSIZE",
+	"locks":      "RLIMIT_LOCKS",
+	"memlock":    "RLIMIT_MEMLOCK",
+	"msgqueue":   "RLIMIT_MSGQUEUE",
+	"nice":       "RLIMIT_NICE",
+	"nofile":     "RLIMIT_NOFILE",
+	"nproc":      "RLIMIT_NPROC",
+	"rss":        "RLIMIT_RSS",
+	"rtprio":     "RLIMIT_RTPRIO",
+	"rttime":     "RLIMIT_RTTIME",
+	"sigpending": "RLIMIT_SIGPENDING",
+	"stack":      "RLIMIT_STACK",
+}
+
+// parseUlimits sets the rlimits of the process from the ulimits, the
+// defaults apply to the rlimits the ulimits do not set.
+func parseUlimits(config *specs.Spec, hc *containertypes.HostConfig) error {
+	set := map[string]bool{}
+	for _, ul := range hc.Ulimits {
+		t, ok := rlimitTypes[ul.Name]
+		if !ok {
+			return fmt.Errorf("invalid ulimit %s", ul.Name)
+		}
+		if set[t] {
+			return fmt.Errorf("ulimit %s is set more than once", ul.Name)
+		}
+		set[t] = true
+
+		soft, err := rlimitValue(ul.Soft)
+		if err != nil {
+			return fmt.Errorf("ulimit %s has an invalid soft limit: %v", ul.Name, err)
+		}
+		hard, err := rlimitValue(ul.Hard)
+		if err != nil {
+			return fmt.Errorf("ulimit %s has an invalid hard limit: %v", ul.Name, err)
+		}
+		if soft > hard {
+			return fmt.Errorf("ulimit %s has a soft limit of %d above its hard limit of %d", ul.Name, ul.Soft, ul.Hard)
+		}
+		config.Process.Rlimits = append(config.Process.Rlimits, specs.POSIXRlimit{
+			Type: t,
+			Hard: hard,
+			Soft: soft,
+		})
+	}
+
+	for _, rl := range DefaultRlimits {
+		if !set[rl.Type] {
+			config.Process.Rlimits = append(config.Process.Rlimits, rl)
+		}
+	}
+	return nil
+}
+
+// rlimitValue returns the rlimit of a ulimit, where -1 is unlimited and
+// the other negative values are invalid.
+func rlimitValue(v int64) (uint64, error) {
+	switch {
+	case v == -1:
+		return unix.RLIM_INFINITY, nil
+	case v < 0:
+		return 0, fmt.Errorf("%d is negative, only -1 means unlimited", v)
+	}
+	return uint64(v), nil
+}
+
+// lookupGid returns the gid of the group, numeric ids do not need to be in
+// /etc/group.
+func lookupGid(g string) (uint32, error) {
+	if gid, err := strconv.ParseUint(g, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+	group, err := user.LookupGroup(g)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(group.Gid), nil
+}
@@ -1,12 +1,21 @@
 package parse
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"syscall"
 	"testing"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
 	containertypes "github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
 	"github.com/opencontainers/runc/libcontainer/user"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 type mappings struct {
@@ -115,3 +124,316 @@ func TestParseMappings(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigUser(t *testing.T) {
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path:       "sh",
+			HostConfig: &containertypes.HostConfig{},
+		},
+		Config: &containertypes.Config{
+			User: "1234:5678",
+		},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := specs.User{UID: 1234, GID: 5678}
+	if !reflect.DeepEqual(config.Process.User, expected) {
+		t.Fatalf("expected user %#v, got %#v", expected, config.Process.User)
+	}
+}
+
+func TestConfigTmpfs(t *testing.T) {
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path: "sh",
+			HostConfig: &containertypes.HostConfig{
+				Tmpfs:       map[string]string{"/run": "size=64m", "/tmp": ""},
+				SecurityOpt: []string{"no-new-privileges=false"},
+			},
+		},
+		Config: &containertypes.Config{},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []specs.Mount{
+		{Destination: "/run", Type: "tmpfs", Source: "tmpfs", Options: []string{"noexec", "nosuid", "nodev", "size=64m"}},
+		{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"noexec", "nosuid", "nodev"}},
+	}
+	if !reflect.DeepEqual(config.Mounts[:2], expected) {
+		t.Fatalf("expected mounts %#v, got %#v", expected, config.Mounts[:2])
+	}
+	if config.Process.NoNewPrivileges {
+		t.Fatal("expected no-new-privileges=false to turn off no new privileges")
+	}
+}
+
+func TestConfigInit(t *testing.T) {
+	init := true
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path: "sh",
+			Args: []string{"-c", "true"},
+			HostConfig: &containertypes.HostConfig{
+				Init:        &init,
+				ConsoleSize: [2]uint{24, 80},
+			},
+		},
+		Config: &containertypes.Config{Tty: true},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{InitPath, "--", "sh", "-c", "true"}
+	if !reflect.DeepEqual(config.Process.Args, expected) {
+		t.Fatalf("expected args %v, got %v", expected, config.Process.Args)
+	}
+	if config.Mounts[0].Destination != InitPath || config.Mounts[0].Type != "bind" {
+		t.Fatalf("expected the init to be mounted at %s, got %#v", InitPath, config.Mounts[0])
+	}
+	if config.Process.ConsoleSize == nil || *config.Process.ConsoleSize != (specs.Box{Height: 24, Width: 80}) {
+		t.Fatalf("expected a console of 24x80, got %#v", config.Process.ConsoleSize)
+	}
+}
+
+func TestConfigUlimits(t *testing.T) {
+	tests := []struct {
+		ulimits  []*units.Ulimit
+		expected []specs.POSIXRlimit
+		err      bool
+	}{
+		{
+			expected: DefaultRlimits,
+		},
+		{
+			ulimits: []*units.Ulimit{
+				{Name: "nofile", Soft: 1048576, Hard: 1048576},
+				{Name: "memlock", Soft: -1, Hard: -1},
+			},
+			expected: []specs.POSIXRlimit{
+				{Type: "RLIMIT_NOFILE", Soft: 1048576, Hard: 1048576},
+				{Type: "RLIMIT_MEMLOCK", Soft: unix.RLIM_INFINITY, Hard: unix.RLIM_INFINITY},
+			},
+		},
+		{
+			ulimits: []*units.Ulimit{{Name: "nproc", Soft: 100, Hard: 200}},
+			expected: []specs.POSIXRlimit{
+				{Type: "RLIMIT_NPROC", Soft: 100, Hard: 200},
+				{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+			},
+		},
+		{
+			ulimits: []*units.Ulimit{{Name: "nofiles", Soft: 1, Hard: 1}},
+			err:     true,
+		},
+		{
+			ulimits: []*units.Ulimit{{Name: "nofile", Soft: 2048, Hard: 1024}},
+			err:     true,
+		},
+		{
+			ulimits: []*units.Ulimit{{Name: "nofile", Soft: -2, Hard: -1}},
+			err:     true,
+		},
+		{
+			ulimits: []*units.Ulimit{{Name: "core", Soft: 0, Hard: -5}},
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		c := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Path: "sh",
+				HostConfig: &containertypes.HostConfig{
+					Resources: containertypes.Resources{Ulimits: test.ulimits},
+				},
+			},
+			Config: &containertypes.Config{},
+		}
+
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error for ulimits %v", test.ulimits)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config.Process.Rlimits, test.expected) {
+			t.Fatalf("expected rlimits %v, got %v", test.expected, config.Process.Rlimits)
+		}
+	}
+}
+
+// fakeDevice is the file info of a block device that only exists for the
+// tests.
+type fakeDevice struct {
+	os.FileInfo
+	rdev uint64
+}
+
+func (d fakeDevice) Mode() os.FileMode { return os.ModeDevice | 0660 }
+func (d fakeDevice) Sys() interface{}  { return &syscall.Stat_t{Rdev: d.rdev} }
+
+func TestConfigBlkioDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-blkio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the block device is a plain file the lookup turns into /dev/sdb, its
+	// link is resolved like the ones in /dev/disk
+	dev := filepath.Join(dir, "sdb")
+	if err := ioutil.WriteFile(dev, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "disk-by-id")
+	if err := os.Symlink(dev, link); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { lstat = os.Lstat }()
+	lstat = func(path string) (os.FileInfo, error) {
+		fi, err := os.Lstat(path)
+		if err != nil || path != dev {
+			return fi, err
+		}
+		return fakeDevice{FileInfo: fi, rdev: unix.Mkdev(8, 16)}, nil
+	}
+
+	tests := []struct {
+		path string
+		err  bool
+	}{
+		{path: "/dev/riddler-does-not-exist", err: true},
+		{path: "/dev/null", err: true},
+		// a directory is not a device
+		{path: dir, err: true},
+		{path: dev},
+		{path: link},
+	}
+
+	for _, test := range tests {
+		c := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Path: "sh",
+				HostConfig: &containertypes.HostConfig{
+					Resources: containertypes.Resources{
+						BlkioWeightDevice:  []*blkiodev.WeightDevice{{Path: test.path, Weight: 200}},
+						BlkioDeviceReadBps: []*blkiodev.ThrottleDevice{{Path: test.path, Rate: 1 << 20}},
+					},
+				},
+			},
+			Config: &containertypes.Config{},
+		}
+
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error for device %s", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blkio := config.Linux.Resources.BlockIO
+		weight := uint16(200)
+		expectedWeight := specs.LinuxWeightDevice{Weight: &weight}
+		expectedWeight.Major, expectedWeight.Minor = 8, 16
+		if !reflect.DeepEqual(blkio.WeightDevice, []specs.LinuxWeightDevice{expectedWeight}) {
+			t.Fatalf("expected a weight of 200 on 8:16 for %s, got %#v", test.path, blkio.WeightDevice)
+		}
+		expectedThrottle := specs.LinuxThrottleDevice{Rate: 1 << 20}
+		expectedThrottle.Major, expectedThrottle.Minor = 8, 16
+		if !reflect.DeepEqual(blkio.ThrottleReadBpsDevice, []specs.LinuxThrottleDevice{expectedThrottle}) {
+			t.Fatalf("expected a read bps throttle of %d on 8:16 for %s, got %#v", 1<<20, test.path, blkio.ThrottleReadBpsDevice)
+		}
+	}
+}
+
+func TestConfigNamespaceModes(t *testing.T) {
+	tests := []struct {
+		hostConfig containertypes.HostConfig
+		hostname   string
+		namespaces []specs.LinuxNamespaceType
+		shm        *specs.Mount
+	}{
+		{
+			hostConfig: containertypes.HostConfig{ShmSize: 128 * 1024 * 1024},
+			hostname:   "box",
+			namespaces: []specs.LinuxNamespaceType{"mount", "ipc", "uts", "network", "pid"},
+			shm:        &specs.Mount{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=131072k"}},
+		},
+		{
+			hostConfig: containertypes.HostConfig{IpcMode: "host", UTSMode: "host"},
+			namespaces: []specs.LinuxNamespaceType{"mount", "network", "pid"},
+			shm:        &specs.Mount{Destination: "/dev/shm", Type: "bind", Source: "/dev/shm", Options: []string{"rbind", "rprivate"}},
+		},
+		{
+			hostConfig: containertypes.HostConfig{IpcMode: "none", PidMode: "host"},
+			hostname:   "box",
+			namespaces: []specs.LinuxNamespaceType{"mount", "ipc", "uts", "network"},
+		},
+		{
+			hostConfig: containertypes.HostConfig{IpcMode: "container:db", NetworkMode: "container:db"},
+			hostname:   "box",
+			namespaces: []specs.LinuxNamespaceType{"mount", "ipc", "uts", "network", "pid"},
+			shm:        &specs.Mount{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+		},
+	}
+
+	for _, test := range tests {
+		hostConfig := test.hostConfig
+		// keep the user namespace out of the way
+		hostConfig.Privileged = true
+		c := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Path:       "sh",
+				HostConfig: &hostConfig,
+			},
+			Config: &containertypes.Config{Hostname: "box"},
+		}
+
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, logrus.StandardLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.Hostname != test.hostname {
+			t.Fatalf("%#v: expected hostname %q, got %q", test.hostConfig, test.hostname, config.Hostname)
+		}
+		var namespaces []specs.LinuxNamespaceType
+		for _, ns := range config.Linux.Namespaces {
+			namespaces = append(namespaces, ns.Type)
+		}
+		if !reflect.DeepEqual(namespaces, test.namespaces) {
+			t.Fatalf("%#v: expected namespaces %v, got %v", test.hostConfig, test.namespaces, namespaces)
+		}
+
+		var shm *specs.Mount
+		for _, m := range config.Mounts {
+			if m.Destination == "/dev/shm" {
+				m := m
+				shm = &m
+			}
+		}
+		if !reflect.DeepEqual(shm, test.shm) {
+			t.Fatalf("%#v: expected /dev/shm %#v, got %#v", test.hostConfig, test.shm, shm)
+		}
+	}
+}
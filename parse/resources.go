@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// cpuPeriod is the period the docker daemon sets the quota of --cpus
+	// in, in microseconds.
+	cpuPeriod = int64(100 * time.Millisecond / time.Microsecond)
+)
+
+// parseResources sets the cgroup resources of the container the way the
+// docker daemon does, the limits that are not set are left out.
+func parseResources(config *specs.Spec, r containertypes.Resources) error {
+	memory, err := memoryResources(r)
+	if err != nil {
+		return err
+	}
+	cpu, err := cpuResources(r)
+	if err != nil {
+		return err
+	}
+
+	resources := config.Linux.Resources
+	resources.Memory = memory
+	resources.CPU = cpu
+	if r.PidsLimit > 0 {
+		resources.Pids = &specs.LinuxPids{Limit: r.PidsLimit}
+	}
+	if r.BlkioWeight > 0 {
+		weight := r.BlkioWeight
+		resources.BlockIO.Weight = &weight
+	}
+	return nil
+}
+
+// memoryResources returns the memory limits of the resources. A swap of -1
+// is unlimited, and without a swap limit docker gives as much swap as memory.
+func memoryResources(r containertypes.Resources) (*specs.LinuxMemory, error) {
+	memory := &specs.LinuxMemory{
+		DisableOOMKiller: r.OomKillDisable,
+	}
+	if r.Memory > 0 {
+		memory.Limit = int64ptr(r.Memory)
+	}
+	if r.MemoryReservation > 0 {
+		memory.Reservation = int64ptr(r.MemoryReservation)
+	}
+
+	switch {
+	case r.MemorySwap > 0:
+		if r.Memory > 0 && r.MemorySwap < r.Memory {
+			return nil, fmt.Errorf("memory and swap limit of %d is below the memory limit of %d", r.MemorySwap, r.Memory)
+		}
+		memory.Swap = int64ptr(r.MemorySwap)
+	case r.MemorySwap == -1:
+		memory.Swap = int64ptr(-1)
+	case r.MemorySwap == 0 && r.Memory > 0:
+		memory.Swap = int64ptr(r.Memory * 2)
+	case r.MemorySwap < 0:
+		return nil, fmt.Errorf("invalid memory and swap limit of %d", r.MemorySwap)
+	}
+
+	// -1 is the swappiness of the host
+	if r.MemorySwappiness != nil && *r.MemorySwappiness != -1 {
+		if *r.MemorySwappiness < 0 || *r.MemorySwappiness > 100 {
+			return nil, fmt.Errorf("invalid memory swappiness %d, it has to be between 0 and 100", *r.MemorySwappiness)
+		}
+		memory.Swappiness = uint64ptrfptr(r.MemorySwappiness)
+	}
+
+	if r.KernelMemory != 0 {
+		memory.Kernel = int64ptr(r.KernelMemory)
+	}
+	return memory, nil
+}
+
+// cpuResources returns the cpu limits of the resources. --cpus is a quota
+// of the period docker uses.
+func cpuResources(r containertypes.Resources) (*specs.LinuxCPU, error) {
+	if r.CPUShares < 0 {
+		return nil, fmt.Errorf("invalid cpu shares %d", r.CPUShares)
+	}
+	if r.NanoCPUs < 0 {
+		return nil, fmt.Errorf("invalid nano cpus %d", r.NanoCPUs)
+	}
+	if r.NanoCPUs > 0 && (r.CPUPeriod > 0 || r.CPUQuota > 0) {
+		return nil, errors.New("nano cpus cannot be set along with the cpu period or quota")
+	}
+
+	cpu := &specs.LinuxCPU{
+		Cpus: r.CpusetCpus,
+		Mems: r.CpusetMems,
+	}
+	if r.CPUShares > 0 {
+		cpu.Shares = uint64ptr(r.CPUShares)
+	}
+
+	if r.NanoCPUs > 0 {
+		cpu.Period = uint64ptr(cpuPeriod)
+		cpu.Quota = int64ptr(r.NanoCPUs * cpuPeriod / 1e9)
+	}
+	if r.CPUPeriod != 0 {
+		cpu.Period = uint64ptr(r.CPUPeriod)
+	}
+	if r.CPUQuota != 0 {
+		cpu.Quota = int64ptr(r.CPUQuota)
+	}
+
+	if r.CPURealtimePeriod != 0 {
+		cpu.RealtimePeriod = uint64ptr(r.CPURealtimePeriod)
+	}
+	if r.CPURealtimeRuntime != 0 {
+		cpu.RealtimeRuntime = int64ptr(r.CPURealtimeRuntime)
+	}
+	return cpu, nil
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestMemoryResources(t *testing.T) {
+	swappiness := func(i int64) *int64 { return &i }
+	tests := []struct {
+		resources containertypes.Resources
+		expected  *specs.LinuxMemory
+		err       bool
+	}{
+		{
+			expected: &specs.LinuxMemory{},
+		},
+		{
+			// docker gives as much swap as memory
+			resources: containertypes.Resources{Memory: 1 << 30},
+			expected:  &specs.LinuxMemory{Limit: int64ptr(1 << 30), Swap: int64ptr(2 << 30)},
+		},
+		{
+			resources: containertypes.Resources{Memory: 1 << 30, MemorySwap: -1, MemorySwappiness: swappiness(-1)},
+			expected:  &specs.LinuxMemory{Limit: int64ptr(1 << 30), Swap: int64ptr(-1)},
+		},
+		{
+			resources: containertypes.Resources{Memory: 1 << 30, MemorySwap: 1 << 31, MemorySwappiness: swappiness(0)},
+			expected:  &specs.LinuxMemory{Limit: int64ptr(1 << 30), Swap: int64ptr(1 << 31), Swappiness: uint64ptr(0)},
+		},
+		{
+			resources: containertypes.Resources{Memory: 1 << 30, MemorySwap: 1 << 20},
+			err:       true,
+		},
+		{
+			resources: containertypes.Resources{MemorySwappiness: swappiness(101)},
+			err:       true,
+		},
+	}
+
+	for _, test := range tests {
+		memory, err := memoryResources(test.resources)
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error for %#v", test.resources)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(memory, test.expected) {
+			t.Fatalf("expected memory %#v, got %#v", test.expected, memory)
+		}
+	}
+}
+
+func TestCPUResources(t *testing.T) {
+	tests := []struct {
+		resources containertypes.Resources
+		expected  *specs.LinuxCPU
+		err       bool
+	}{
+		{
+			expected: &specs.LinuxCPU{},
+		},
+		{
+			// --cpus 1.5
+			resources: containertypes.Resources{NanoCPUs: 1500000000, CpusetCpus: "0-3"},
+			expected:  &specs.LinuxCPU{Period: uint64ptr(100000), Quota: int64ptr(150000), Cpus: "0-3"},
+		},
+		{
+			resources: containertypes.Resources{CPUShares: 512, CPURealtimePeriod: 1000000, CPURealtimeRuntime: 950000},
+			expected:  &specs.LinuxCPU{Shares: uint64ptr(512), RealtimePeriod: uint64ptr(1000000), RealtimeRuntime: int64ptr(950000)},
+		},
+		{
+			resources: containertypes.Resources{NanoCPUs: 1000000000, CPUQuota: 50000},
+			err:       true,
+		},
+		{
+			resources: containertypes.Resources{CPUShares: -1},
+			err:       true,
+		},
+	}
+
+	for _, test := range tests {
+		cpu, err := cpuResources(test.resources)
+		if test.err {
+			if err == nil {
+				t.Fatalf("expected an error for %#v", test.resources)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cpu, test.expected) {
+			t.Fatalf("expected cpu %#v, got %#v", test.expected, cpu)
+		}
+	}
+}
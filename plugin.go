@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/genuinetools/riddler/version"
+)
+
+const (
+	// pluginName is the name of the docker command riddler adds as a
+	// plugin, the binary has to be installed as docker-riddler in a
+	// cli-plugins directory of the docker CLI.
+	pluginName = "riddler"
+	// pluginMetadataCommand is the command the docker CLI runs to find out
+	// about the plugin.
+	pluginMetadataCommand = "docker-cli-plugin-metadata"
+	// pluginEnv is set by the docker CLI when it runs a plugin.
+	pluginEnv = "DOCKER_CLI_PLUGIN_ORIGINAL_CLI_COMMAND"
+)
+
+// pluginMetadata is the answer to the metadata handshake of the docker CLI.
+type pluginMetadata struct {
+	SchemaVersion    string
+	Vendor           string
+	Version          string
+	ShortDescription string
+	URL              string
+}
+
+// writePluginMetadata answers the metadata handshake of the docker CLI.
+func writePluginMetadata() error {
+	return json.NewEncoder(os.Stdout).Encode(pluginMetadata{
+		SchemaVersion:    "0.1.0",
+		Vendor:           "genuinetools",
+		Version:          version.VERSION,
+		ShortDescription: "Convert containers into runtime specs",
+		URL:              "https://github.com/genuinetools/riddler",
+	})
+}
+
+// pluginArgs turns the arguments the docker CLI runs the plugin with, its
+// global flags followed by the name of the plugin and the arguments of the
+// user, into the arguments of riddler. The flags that choose the daemon are
+// set in f.
+func pluginArgs(args []string, f *dockerFlags) ([]string, error) {
+	values := map[string]*string{
+		"--config":    &f.config,
+		"-c":          &f.context,
+		"--context":   &f.context,
+		"-H":          &f.host,
+		"--host":      &f.host,
+		"--tlscacert": &f.tlsCACert,
+		"--tlscert":   &f.tlsCert,
+		"--tlskey":    &f.tlsKey,
+		"-l":          new(string),
+		"--log-level": new(string),
+	}
+	bools := map[string]*bool{
+		"--tls":       &f.tls,
+		"--tlsverify": &f.tlsVerify,
+		"-D":          &debug,
+		"--debug":     &debug,
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == pluginName {
+			return args[i+1:], nil
+		}
+
+		name, value := arg, ""
+		hasValue := false
+		if n := strings.Index(arg, "="); n > 0 && strings.HasPrefix(arg, "-") {
+			name, value, hasValue = arg[:n], arg[n+1:], true
+		}
+		if p, ok := values[name]; ok {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag %s of the docker CLI needs a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			*p = value
+			continue
+		}
+		if p, ok := bools[name]; ok {
+			*p = !hasValue || value == "true"
+			continue
+		}
+		return nil, fmt.Errorf("unknown flag %s of the docker CLI before %s", arg, pluginName)
+	}
+	return nil, fmt.Errorf("the docker CLI did not pass the %s command", pluginName)
+}
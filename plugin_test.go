@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPluginArgs(t *testing.T) {
+	defer func(d bool) { debug = d }(debug)
+
+	tests := []struct {
+		args    []string
+		rest    []string
+		flags   dockerFlags
+		debug   bool
+		wantErr bool
+	}{
+		{
+			args: []string{"riddler", "--bundle", "out", "web"},
+			rest: []string{"--bundle", "out", "web"},
+		},
+		{
+			args:  []string{"-H", "tcp://remote:2375", "--tlsverify", "--tlscacert=/certs/ca.pem", "riddler", "web"},
+			rest:  []string{"web"},
+			flags: dockerFlags{host: "tcp://remote:2375", tlsVerify: true, tlsCACert: "/certs/ca.pem"},
+		},
+		{
+			args:  []string{"--context=remote", "--config", "/cfg", "-D", "--log-level", "info", "riddler"},
+			rest:  []string{},
+			flags: dockerFlags{context: "remote", config: "/cfg"},
+			debug: true,
+		},
+		{
+			args:  []string{"--tls=false", "riddler", "-H", "ignored"},
+			rest:  []string{"-H", "ignored"},
+			flags: dockerFlags{},
+		},
+		{args: []string{"-H"}, wantErr: true},
+		{args: []string{"--bogus", "riddler"}, wantErr: true},
+		{args: []string{"-H", "tcp://remote:2375"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		debug = false
+		var f dockerFlags
+		rest, err := pluginArgs(test.args, &f)
+		if test.wantErr {
+			if err == nil {
+				t.Fatalf("expected an error for %v, got %v", test.args, rest)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+		if !reflect.DeepEqual(rest, test.rest) {
+			t.Fatalf("%v: expected the arguments %v, got %v", test.args, test.rest, rest)
+		}
+		if f != test.flags || debug != test.debug {
+			t.Fatalf("%v: expected flags %#v and debug %v, got %#v and %v", test.args, test.flags, test.debug, f, debug)
+		}
+	}
+}
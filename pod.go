@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/genuinetools/riddler/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const podHelp = `Convert a Kubernetes Pod manifest into a bundle per container, plus one for the sandbox.`
+
+func (cmd *podCommand) Name() string      { return "pod" }
+func (cmd *podCommand) Args() string      { return "[OPTIONS] POD_FILE" }
+func (cmd *podCommand) ShortHelp() string { return podHelp }
+func (cmd *podCommand) LongHelp() string  { return podHelp }
+func (cmd *podCommand) Hidden() bool      { return false }
+
+func (cmd *podCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.pauseImage, "pause-image", inspect.DefaultPauseImage, "Image of the sandbox holding the namespaces of the pod")
+	fs.StringVar(&cmd.seccompDir, "seccomp-dir", inspect.DefaultKubeletSeccompDir, "Directory of the Localhost seccomp profiles")
+}
+
+type podCommand struct {
+	pauseImage string
+	seccompDir string
+}
+
+func (cmd *podCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("pass the pod manifest")
+	}
+	if rootfsMode != "" && rootfsMode != rootfsImage {
+		return fmt.Errorf("only --rootfs %s is supported for pods", rootfsImage)
+	}
+
+	pod, err := inspect.ReadPod(args[0])
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(bundle)
+	if err != nil {
+		return err
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	dcs, err := inspect.FromPod(pod, inspect.PodOptions{
+		PauseImage: cmd.pauseImage,
+		VolumesDir: filepath.Join(abs, inspect.VolumesDir),
+		SeccompDir: cmd.seccompDir,
+		// fill in what the pod leaves out from the images, if the daemon has them
+		ImageConfig: imageConfigFunc(ctx, cli),
+		Log:         logrus.StandardLogger(),
+	})
+	if err != nil {
+		return fmt.Errorf("converting pod %s failed: %v", pod.Metadata.Name, err)
+	}
+
+	var ctrs []container
+	for _, dc := range dcs {
+		ctr := container{ContainerJSON: dc}
+		ctr.addFixup(func(config *specs.Spec) {
+			// pods do not get user namespaces
+			parse.UserNamespace(config, nil, nil)
+		})
+		ctrs = append(ctrs, ctr)
+
+		// the emptyDir volumes are shared by the containers
+		if err := createVolumeDirs(dc, ""); err != nil {
+			return err
+		}
+	}
+
+	deps, err := linkNamespaces(ctrs, bundle)
+	if err != nil {
+		return err
+	}
+
+	// the sandbox has to be started first
+	var names []string
+	for _, ctr := range ctrs {
+		names = append(names, bundleName(ctr.ContainerJSON))
+	}
+	order, err := startOrder(names, deps)
+	if err != nil {
+		return err
+	}
+	if err := writeStartOrder(bundle, order); err != nil {
+		return err
+	}
+
+	return writeBundles(ctx, bundle, ctrs, nil)
+}
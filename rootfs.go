@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/genuinetools/riddler/rootfs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rootfsExport  = "export"
+	rootfsImage   = "image"
+	rootfsOverlay = "overlay"
+
+	// overlayDir holds the upper and work directories of an overlay rootfs
+	// in the bundle.
+	overlayDir = "overlay"
+)
+
+func validateRootfsMode(mode string) error {
+	switch mode {
+	case "", rootfsExport, rootfsImage, rootfsOverlay:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid rootfs mode, try %q, %q or %q", mode, rootfsExport, rootfsImage, rootfsOverlay)
+	}
+}
+
+// checkRootfs makes sure the rootfs directory of the bundle can be populated
+// the way the user asked for with --rootfs.
+func checkRootfs(dir string) error {
+	// make sure we don't mix the filesystem with an existing one
+	if rootfsMode == "" || force {
+		return nil
+	}
+	return checkEmptyDir(dir)
+}
+
+// populateRootfs fills the rootfs directory of the bundle for the container
+// the way the user asked for with --rootfs, checkRootfs has to be called
+// before.
+func populateRootfs(ctx context.Context, ctr types.ContainerJSON, dir string) error {
+	if rootfsMode == "" {
+		return nil
+	}
+
+	switch rootfsMode {
+	case rootfsExport:
+		if fromFile != "" || fromDisk {
+			return fmt.Errorf("--rootfs %s needs the docker daemon to export the container", rootfsExport)
+		}
+
+		cli, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		rc, err := cli.ContainerExport(ctx, ctr.ID)
+		if err != nil {
+			return fmt.Errorf("exporting container (%s) failed: %v", ctr.ID, err)
+		}
+		defer rc.Close()
+
+		if err := rootfs.Unpack(rc, dir); err != nil {
+			return fmt.Errorf("unpacking the export of container (%s) failed: %v", ctr.ID, err)
+		}
+
+	case rootfsImage:
+		// use the image archive we were given, or save the image from the daemon
+		var rc io.ReadCloser
+		if imageTar != "" {
+			f, err := os.Open(imageTar)
+			if err != nil {
+				return fmt.Errorf("opening image archive failed: %v", err)
+			}
+			rc = f
+		} else {
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			rc, err = cli.ImageSave(ctx, []string{ctr.Image})
+			if err != nil {
+				return fmt.Errorf("saving image (%s) failed: %v", ctr.Image, err)
+			}
+		}
+		defer rc.Close()
+
+		if err := rootfs.FromImageArchive(rc, ctr.Image, dir); err != nil {
+			return fmt.Errorf("building rootfs from image (%s) failed: %v", ctr.Image, err)
+		}
+
+	case rootfsOverlay:
+		// reuse the layers of the container instead of copying them
+		if err := rootfs.Overlay(ctr.GraphDriver, filepath.Join(filepath.Dir(dir), overlayDir), dir); err != nil {
+			return fmt.Errorf("mounting overlay rootfs for container (%s) failed: %v", ctr.ID, err)
+		}
+		logrus.Infof("Mounted overlay on %s, unmount it with `umount %s` when done.", dir, dir)
+	}
+
+	return nil
+}
+
+func checkEmptyDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("directory %s is not empty, remove it", dir)
+	}
+	return nil
+}
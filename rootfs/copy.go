@@ -0,0 +1,43 @@
+package rootfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CopyFrom copies the directory at path in the rootfs root to dest, the way
+// docker fills a new volume with what the image has at its destination.
+// Nothing is copied if the rootfs has no directory there. A path going
+// through a symlink is refused, the link would be resolved on the host.
+func CopyFrom(root, path, dest string) error {
+	src, err := securePath(root, path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to copy %s: it is a symlink", path)
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	return copyDir(src, dest)
+}
+
+// copyDir copies the directory src to dest, keeping what Pack and Unpack
+// keep.
+func copyDir(src, dest string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Pack(src, pw))
+	}()
+	defer pr.Close()
+	return Unpack(pr, dest)
+}
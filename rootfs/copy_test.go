@@ -0,0 +1,89 @@
+package rootfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "riddler-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "riddler-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	if err := os.MkdirAll(filepath.Join(src, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "etc", "hostname"), []byte("riddler\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("hostname", filepath.Join(src, "etc", "name")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyDir(src, filepath.Join(dest, "diff")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dest, "diff", "etc", "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "riddler\n" {
+		t.Fatalf("expected the copy of the file through the symlink, got %q", data)
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	root, err := ioutil.TempDir("", "riddler-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dest, err := ioutil.TempDir("", "riddler-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	if err := os.MkdirAll(filepath.Join(root, "var", "cache", "nginx"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "var", "cache", "nginx", "index"), []byte("cached\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the link would be resolved on the host
+	if err := os.Symlink("/etc", filepath.Join(root, "etc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFrom(root, "/var/cache/nginx", filepath.Join(dest, "cache")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dest, "cache", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "cached\n" {
+		t.Fatalf("expected the content of the rootfs to be copied, got %q", data)
+	}
+
+	// nothing to copy
+	if err := CopyFrom(root, "/data", filepath.Join(dest, "data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "data")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be copied for a missing directory, got %v", err)
+	}
+
+	if err := CopyFrom(root, "/etc/ssl", filepath.Join(dest, "ssl")); err == nil {
+		t.Fatal("expected copying through a symlink to fail")
+	}
+}
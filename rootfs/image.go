@@ -0,0 +1,139 @@
+package rootfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	imageManifestFile = "manifest.json"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+)
+
+// imageManifest is an entry of the manifest.json file written by
+// `docker save`.
+type imageManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// FromImageArchive rebuilds the filesystem of the image ref from the
+// `docker save` archive r into dest by applying its layers in order. The
+// image can be referenced by its ID or one of its tags. If ref is empty the
+// archive must contain a single image.
+func FromImageArchive(r io.Reader, ref, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// the manifest can be anywhere in the archive, so unpack it next to
+	// the rootfs before applying the layers
+	tmp, err := ioutil.TempDir(filepath.Dir(dest), ".riddler-image-")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := Unpack(r, tmp); err != nil {
+		return fmt.Errorf("unpacking image archive failed: %v", err)
+	}
+
+	var manifests []imageManifest
+	data, err := ioutil.ReadFile(filepath.Join(tmp, imageManifestFile))
+	if err != nil {
+		return fmt.Errorf("reading %s of image archive failed: %v", imageManifestFile, err)
+	}
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return fmt.Errorf("decoding %s of image archive failed: %v", imageManifestFile, err)
+	}
+
+	m, err := findImageManifest(manifests, ref)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("creating rootfs directory %s failed: %v", dest, err)
+	}
+	for _, layer := range m.Layers {
+		path, err := securePath(tmp, layer)
+		if err != nil {
+			return err
+		}
+		if err := ApplyLayerFile(path, dest); err != nil {
+			return fmt.Errorf("applying layer %s failed: %v", layer, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyLayerFile applies the image layer saved in the file at path on top of
+// dest, see ApplyLayer. The layer can be gzip compressed.
+func ApplyLayerFile(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return ApplyLayer(r, dest)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return ApplyLayer(gz, dest)
+}
+
+// findImageManifest returns the manifest of the image ref.
+func findImageManifest(manifests []imageManifest, ref string) (imageManifest, error) {
+	if ref == "" {
+		if len(manifests) != 1 {
+			return imageManifest{}, fmt.Errorf("image archive contains %d images, pass the image to use", len(manifests))
+		}
+		return manifests[0], nil
+	}
+
+	id := strings.TrimPrefix(ref, "sha256:")
+	tag := ref
+	if !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		tag = ref + ":latest"
+	}
+
+	for _, m := range manifests {
+		// the config is named after the image ID
+		config := strings.TrimSuffix(filepath.Base(m.Config), ".json")
+		if config == id || (len(id) >= 12 && strings.HasPrefix(config, id)) {
+			return m, nil
+		}
+		for _, t := range m.RepoTags {
+			if t == ref || t == tag {
+				return m, nil
+			}
+		}
+	}
+
+	return imageManifest{}, fmt.Errorf("image %s not found in image archive", ref)
+}
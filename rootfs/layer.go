@@ -0,0 +1,65 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// whiteoutPrefix marks a file or directory of a lower layer as deleted.
+	whiteoutPrefix = ".wh."
+	// whiteoutMetaPrefix is used for the special files of the aufs driver.
+	whiteoutMetaPrefix = whiteoutPrefix + whiteoutPrefix
+	// whiteoutOpaqueDir marks a directory as opaque, hiding everything the
+	// lower layers put in it.
+	whiteoutOpaqueDir = whiteoutMetaPrefix + ".opq"
+)
+
+// ApplyLayer extracts the image layer r on top of the layers already
+// unpacked in dest. Whiteout files remove the matching paths of the lower
+// layers and opaque directories hide their lower contents.
+func ApplyLayer(r io.Reader, dest string) error {
+	// the paths written by this layer, an opaque whiteout only hides
+	// what the lower layers put in the directory
+	unpacked := map[string]bool{}
+
+	return unpack(r, dest, func(hdr *tar.Header, path string) (bool, error) {
+		dir, base := filepath.Split(path)
+
+		switch {
+		case base == whiteoutOpaqueDir:
+			files, err := ioutil.ReadDir(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			for _, f := range files {
+				p := filepath.Join(dir, f.Name())
+				if unpacked[p] {
+					continue
+				}
+				if err := os.RemoveAll(p); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+
+		case strings.HasPrefix(base, whiteoutMetaPrefix):
+			// aufs metadata, nothing to do with the filesystem itself
+			return false, nil
+
+		case strings.HasPrefix(base, whiteoutPrefix):
+			p := filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			if err := os.RemoveAll(p); err != nil {
+				return false, err
+			}
+			return false, nil
+		}
+
+		unpacked[path] = true
+		return true, nil
+	})
+}
@@ -0,0 +1,136 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromImageArchive(t *testing.T) {
+	dest, err := ioutil.TempDir("", "riddler-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	base := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/removed", Typeflag: tar.TypeReg}, data: "x"},
+		{hdr: tar.Header{Name: "etc/kept", Typeflag: tar.TypeReg}, data: "x"},
+		{hdr: tar.Header{Name: "opaque/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "opaque/hidden", Typeflag: tar.TypeReg}, data: "x"},
+	})
+	top := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "etc/.wh.removed", Typeflag: tar.TypeReg}},
+		{hdr: tar.Header{Name: "opaque/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "opaque/new", Typeflag: tar.TypeReg}, data: "x"},
+		{hdr: tar.Header{Name: "opaque/.wh..wh..opq", Typeflag: tar.TypeReg}},
+	})
+	archive := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "base/layer.tar", Typeflag: tar.TypeReg}, data: base.String()},
+		{hdr: tar.Header{Name: "top/layer.tar", Typeflag: tar.TypeReg}, data: top.String()},
+		{hdr: tar.Header{Name: "0123456789abcdef.json", Typeflag: tar.TypeReg}, data: "{}"},
+		{hdr: tar.Header{Name: imageManifestFile, Typeflag: tar.TypeReg}, data: `[{"Config": "0123456789abcdef.json", "RepoTags": ["busybox:latest"], "Layers": ["base/layer.tar", "top/layer.tar"]}]`},
+	})
+
+	rootfs := filepath.Join(dest, "rootfs")
+	if err := FromImageArchive(archive, "busybox", rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, exists := range map[string]bool{
+		"etc/kept":            true,
+		"etc/removed":         false,
+		"etc/.wh.removed":     false,
+		"opaque/new":          true,
+		"opaque/hidden":       false,
+		"opaque/.wh..wh..opq": false,
+	} {
+		_, err := os.Lstat(filepath.Join(rootfs, path))
+		if exists && err != nil {
+			t.Fatalf("expected %s to exist: %v", path, err)
+		}
+		if !exists && !os.IsNotExist(err) {
+			t.Fatalf("expected %s to not exist", path)
+		}
+	}
+
+	// the temporary directory for the archive is cleaned up
+	files, err := ioutil.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected only the rootfs in %s, got %d files", dest, len(files))
+	}
+}
+
+func TestFindImageManifest(t *testing.T) {
+	manifests := []imageManifest{
+		{Config: "0123456789abcdef.json", RepoTags: []string{"busybox:latest"}},
+		{Config: "fedcba9876543210.json", RepoTags: []string{"example.com:5000/app:1.0"}},
+	}
+
+	tests := map[string]string{
+		"busybox":                  "0123456789abcdef.json",
+		"busybox:latest":           "0123456789abcdef.json",
+		"sha256:0123456789abcdef":  "0123456789abcdef.json",
+		"fedcba987654":             "fedcba9876543210.json",
+		"example.com:5000/app:1.0": "fedcba9876543210.json",
+	}
+	for ref, expected := range tests {
+		m, err := findImageManifest(manifests, ref)
+		if err != nil {
+			t.Fatalf("finding %s failed: %v", ref, err)
+		}
+		if m.Config != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, ref, m.Config)
+		}
+	}
+
+	for _, ref := range []string{"", "alpine", "example.com:5000/app"} {
+		if _, err := findImageManifest(manifests, ref); err == nil {
+			t.Fatalf("expected an error finding %q", ref)
+		}
+	}
+}
+
+func TestApplyLayerFileGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layer := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "hello", Typeflag: tar.TypeReg}, data: "world"},
+	})
+	f, err := os.Create(filepath.Join(dir, "layer.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(layer.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := ApplyLayerFile(f.Name(), rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(rootfs, "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "world" {
+		t.Fatalf("expected hello to contain world, got %q", string(data))
+	}
+}
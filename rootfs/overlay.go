@@ -0,0 +1,119 @@
+package rootfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"golang.org/x/sys/unix"
+)
+
+// Overlay mounts a fresh overlay filesystem on dest that reuses the layer
+// directories of a container using the overlay or overlay2 graph driver.
+// All the layers, the container's own writable layer included, are mounted
+// as read-only lower directories. The changes made through dest are written
+// to a new upper directory in workdir, nothing is copied.
+func Overlay(gd types.GraphDriverData, workdir, dest string) error {
+	if gd.Name != "overlay" && gd.Name != "overlay2" {
+		return fmt.Errorf("graph driver %q does not use overlay mounts", gd.Name)
+	}
+
+	lower := []string{}
+	if d := gd.Data["UpperDir"]; d != "" {
+		lower = append(lower, d)
+	}
+	if d := gd.Data["LowerDir"]; d != "" {
+		lower = append(lower, strings.Split(d, ":")...)
+	}
+	if len(lower) == 0 {
+		return fmt.Errorf("graph driver data has no layer directories")
+	}
+	for _, d := range lower {
+		if _, err := os.Stat(d); err != nil {
+			return fmt.Errorf("layer directory is not available: %v", err)
+		}
+	}
+
+	upper := filepath.Join(workdir, "upper")
+	work := filepath.Join(workdir, "work")
+	for _, d := range []string{upper, work, dest} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("creating directory %s failed: %v", d, err)
+		}
+	}
+
+	opts := overlayOpts(lower, upper, work)
+	if len(opts) < unix.Getpagesize() {
+		return mountOverlay(dest, opts)
+	}
+
+	// the kernel only accepts mount data up to a page, the layers are given
+	// relative to their directory, through a descriptor of it so the working
+	// directory of the process is left alone
+	root, rel := relativeLayers(lower)
+	if root == "" {
+		return fmt.Errorf("overlay mount options are too long (%d bytes), the container has too many layers", len(opts))
+	}
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening layer directory %s failed: %v", root, err)
+	}
+	defer unix.Close(fd)
+	for i, d := range rel {
+		if !filepath.IsAbs(d) {
+			rel[i] = fmt.Sprintf("/proc/self/fd/%d/%s", fd, d)
+		}
+	}
+
+	opts = overlayOpts(rel, upper, work)
+	if len(opts) >= unix.Getpagesize() {
+		return fmt.Errorf("overlay mount options are too long (%d bytes), the container has too many layers", len(opts))
+	}
+	return mountOverlay(dest, opts)
+}
+
+// overlayOpts returns the options of an overlay mount.
+func overlayOpts(lower []string, upper, work string) string {
+	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(lower, ":"), upper, work)
+}
+
+// relativeLayers returns the directory holding the layers of the graph
+// driver, along with the paths of the layers relative to it. The overlay2
+// driver links the layers in l/ under short names, those are used when they
+// are there. The layers outside of the directory keep their paths.
+func relativeLayers(lower []string) (string, []string) {
+	// the layers of the image are the last ones, <root>/<id>/diff
+	root := filepath.Dir(filepath.Dir(lower[len(lower)-1]))
+	if root == "/" || root == "." {
+		return "", lower
+	}
+
+	var rel []string
+	for _, d := range lower {
+		if filepath.Base(d) != "diff" || filepath.Dir(filepath.Dir(d)) != root {
+			rel = append(rel, d)
+			continue
+		}
+		layer := filepath.Dir(d)
+		if link, err := ioutil.ReadFile(filepath.Join(layer, "link")); err == nil {
+			short := filepath.Join("l", strings.TrimSpace(string(link)))
+			if _, err := os.Stat(filepath.Join(root, short)); err == nil {
+				rel = append(rel, short)
+				continue
+			}
+		}
+		rel = append(rel, filepath.Join(filepath.Base(layer), "diff"))
+	}
+	return root, rel
+}
+
+// mountOverlay mounts the overlay on dest.
+func mountOverlay(dest, opts string) error {
+	if err := unix.Mount("overlay", dest, "overlay", 0, opts); err != nil {
+		return fmt.Errorf("mounting overlay on %s failed: %v", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package rootfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestOverlayErrors(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler-overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tests := []types.GraphDriverData{
+		{Name: "devicemapper", Data: map[string]string{"DeviceName": "docker-abc"}},
+		{Name: "overlay2", Data: map[string]string{}},
+		{Name: "overlay2", Data: map[string]string{"LowerDir": filepath.Join(tmp, "missing")}},
+	}
+	for _, gd := range tests {
+		if err := Overlay(gd, filepath.Join(tmp, "work"), filepath.Join(tmp, "rootfs")); err == nil {
+			t.Fatalf("expected an error for %#v", gd)
+		}
+	}
+}
+
+func TestRelativeLayers(t *testing.T) {
+	root, err := ioutil.TempDir("", "riddler-overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// the layout of the overlay2 driver, one layer has a short link
+	for _, d := range []string{"l", "abc/diff", "def/diff"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "abc", "link"), []byte("SHORT1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../abc/diff", filepath.Join(root, "l", "SHORT1")); err != nil {
+		t.Fatal(err)
+	}
+
+	lower := []string{"/bundle/.overlay/diff", filepath.Join(root, "abc", "diff"), filepath.Join(root, "def", "diff")}
+	dir, rel := relativeLayers(lower)
+	if dir != root {
+		t.Fatalf("expected the layers to be mounted from %s, got %s", root, dir)
+	}
+	expected := []string{"/bundle/.overlay/diff", "l/SHORT1", "def/diff"}
+	if !reflect.DeepEqual(rel, expected) {
+		t.Fatalf("expected layers %v, got %v", expected, rel)
+	}
+}
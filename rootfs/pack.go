@@ -0,0 +1,141 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Pack writes the directory dir as a tar stream to w, the way Unpack reads
+// it back. Symlinks, hardlinks, device nodes, ownership and extended
+// attributes are preserved.
+func Pack(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	// the first path of every inode, later ones are written as hardlinks
+	inodes := map[uint64]string{}
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		// tar has no entry for sockets, they are created by the processes
+		// that listen on them
+		if fi.Mode()&os.ModeSocket != 0 {
+			logrus.Warnf("skipping %s: sockets cannot be packed", rel)
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("creating tar header for %s failed: %v", rel, err)
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Format = tar.FormatPAX
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			hdr.Uid, hdr.Gid = int(st.Uid), int(st.Gid)
+			hdr.Uname, hdr.Gname = "", ""
+			if fi.Mode().IsRegular() && st.Nlink > 1 {
+				if target, ok := inodes[st.Ino]; ok {
+					hdr.Typeflag = tar.TypeLink
+					hdr.Linkname = target
+					hdr.Size = 0
+				} else {
+					inodes[st.Ino] = hdr.Name
+				}
+			}
+		}
+
+		if err := packXattrs(path, hdr); err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing tar header for %s failed: %v", rel, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("writing %s failed: %v", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// packXattrs adds the extended attributes of the file at path to hdr.
+func packXattrs(path string, hdr *tar.Header) error {
+	size, err := unix.Llistxattr(path, nil)
+	if err == unix.ENOTSUP {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("listing xattrs of %s failed: %v", path, err)
+	}
+	if size <= 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return fmt.Errorf("listing xattrs of %s failed: %v", path, err)
+	}
+
+	start := 0
+	for i, b := range buf[:size] {
+		if b != 0 {
+			continue
+		}
+		attr := string(buf[start:i])
+		start = i + 1
+
+		value := make([]byte, 256)
+		n, err := unix.Lgetxattr(path, attr, value)
+		if err == unix.ERANGE {
+			if n, err = unix.Lgetxattr(path, attr, nil); err == nil {
+				value = make([]byte, n)
+				n, err = unix.Lgetxattr(path, attr, value)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("reading xattr %s of %s failed: %v", attr, path, err)
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords[xattrPrefix+attr] = string(value[:n])
+	}
+	return nil
+}
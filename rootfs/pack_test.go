@@ -0,0 +1,90 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	src, err := ioutil.TempDir("", "riddler-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	buf := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg}, data: "riddler\n"},
+		{hdr: tar.Header{Name: "etc/hostname.link", Typeflag: tar.TypeLink, Linkname: "etc/hostname"}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "/bin/busybox"}},
+		{hdr: tar.Header{Name: "run/fifo", Typeflag: tar.TypeFifo}},
+	})
+	if err := Unpack(buf, src); err != nil {
+		t.Fatal(err)
+	}
+	// a socket left behind by a process of the container
+	l, err := net.Listen("unix", filepath.Join(src, "run/app.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var packed bytes.Buffer
+	if err := Pack(src, &packed); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := ioutil.TempDir("", "riddler-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	if err := Unpack(&packed, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dest, "etc/hostname"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "riddler\n" {
+		t.Fatalf("expected contents to be riddler, got %q", string(data))
+	}
+
+	a, err := os.Stat(filepath.Join(dest, "etc/hostname"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(filepath.Join(dest, "etc/hostname.link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Sys().(*syscall.Stat_t).Ino != b.Sys().(*syscall.Stat_t).Ino {
+		t.Fatal("expected the hardlink to stay a hardlink")
+	}
+
+	link, err := os.Readlink(filepath.Join(dest, "bin/sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "/bin/busybox" {
+		t.Fatalf("expected symlink to /bin/busybox, got %s", link)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dest, "run/fifo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("expected a fifo, got %s", fi.Mode())
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "run/app.sock")); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package rootfs populates the root filesystem of a bundle from the tar
+// archives docker produces.
+package rootfs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	xattrPrefix = "SCHILY.xattr."
+)
+
+// Unpack extracts the tar stream r into the directory dest, creating it if
+// needed. Symlinks, hardlinks, device nodes, ownership and extended
+// attributes are preserved. Entries that would be written outside of dest,
+// either directly or through a symlink, are refused.
+func Unpack(r io.Reader, dest string) error {
+	return unpack(r, dest, nil)
+}
+
+// entryFilter is called with every entry and the path it would be written
+// to before it is extracted. If it returns false the entry is skipped.
+type entryFilter func(hdr *tar.Header, path string) (bool, error)
+
+func unpack(r io.Reader, dest string, filter entryFilter) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("creating rootfs directory %s failed: %v", dest, err)
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	// directory times have to be set once all their children are written
+	type dirTimes struct {
+		path  string
+		atime time.Time
+		mtime time.Time
+	}
+	var dirs []dirTimes
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry failed: %v", err)
+		}
+
+		path, err := securePath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		// the root itself is always a directory we already created
+		if path == dest {
+			continue
+		}
+
+		if filter != nil {
+			ok, err := filter(hdr, path)
+			if err != nil {
+				return fmt.Errorf("applying %s failed: %v", hdr.Name, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if err := extractEntry(tr, hdr, dest, path); err != nil {
+			return fmt.Errorf("extracting %s failed: %v", hdr.Name, err)
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTimes{path: path, atime: hdr.AccessTime, mtime: hdr.ModTime})
+		}
+	}
+
+	for _, d := range dirs {
+		if err := lutimes(d.path, d.atime, d.mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// securePath returns the path in dest that the entry name should be written
+// to. It fails if the name would point outside of dest, or if one of its
+// parents inside dest is a symlink that could be used to escape it.
+func securePath(dest, name string) (string, error) {
+	clean := filepath.Clean(string(filepath.Separator) + name)
+	if rel := filepath.Clean(name); rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to extract %s: path is outside of the rootfs", name)
+	}
+	path := filepath.Join(dest, clean)
+
+	// walk the parents and make sure none of them are symlinks
+	parent := dest
+	for _, part := range strings.Split(filepath.Dir(clean), string(filepath.Separator)) {
+		if part == "" {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		fi, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to extract %s: parent %s is a symlink", name, strings.TrimPrefix(parent, dest))
+		}
+	}
+
+	return path, nil
+}
+
+func extractEntry(r io.Reader, hdr *tar.Header, dest, path string) error {
+	// make sure the parent exists, the archive does not have to contain it
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// remove whatever is in the way, unless it is a directory we are
+	// about to write as well
+	if fi, err := os.Lstat(path); err == nil {
+		if !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(path, mode.Perm()); err != nil && !os.IsExist(err) {
+			return err
+		}
+
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+	case tar.TypeSymlink:
+		// the target is resolved inside the container, leave it as is
+		if err := os.Symlink(hdr.Linkname, path); err != nil {
+			return err
+		}
+
+	case tar.TypeLink:
+		target, err := securePath(dest, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(target, path); err != nil {
+			return err
+		}
+		// a hardlink shares the metadata of its target
+		return nil
+
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		m := uint32(mode.Perm())
+		switch hdr.Typeflag {
+		case tar.TypeChar:
+			m |= unix.S_IFCHR
+		case tar.TypeBlock:
+			m |= unix.S_IFBLK
+		case tar.TypeFifo:
+			m |= unix.S_IFIFO
+		}
+		if err := unix.Mknod(path, m, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))); err != nil {
+			return fmt.Errorf("creating device node failed: %v", err)
+		}
+
+	case tar.TypeXGlobalHeader:
+		return nil
+
+	default:
+		logrus.Warnf("skipping %s: unsupported tar entry type %q", hdr.Name, hdr.Typeflag)
+		return nil
+	}
+
+	if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+		// unprivileged users can only extract files as themselves
+		if os.Geteuid() == 0 {
+			return err
+		}
+		logrus.Debugf("changing owner of %s failed: %v", hdr.Name, err)
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, xattrPrefix) {
+			continue
+		}
+		attr := strings.TrimPrefix(key, xattrPrefix)
+		if err := unix.Lsetxattr(path, attr, []byte(value), 0); err != nil {
+			// not every filesystem supports every attribute namespace
+			if err == unix.ENOTSUP || err == unix.EPERM {
+				logrus.Debugf("setting xattr %s on %s failed: %v", attr, hdr.Name, err)
+				continue
+			}
+			return fmt.Errorf("setting xattr %s failed: %v", attr, err)
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeSymlink {
+		return lutimes(path, hdr.AccessTime, hdr.ModTime)
+	}
+
+	// chmod after chown, since chown clears the setuid and setgid bits
+	if err := os.Chmod(path, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+
+	if hdr.Typeflag == tar.TypeDir {
+		// set once the directory contents are written
+		return nil
+	}
+	return lutimes(path, hdr.AccessTime, hdr.ModTime)
+}
+
+func lutimes(path string, atime, mtime time.Time) error {
+	if atime.IsZero() {
+		atime = mtime
+	}
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(atime.UnixNano()),
+		unix.NsecToTimespec(mtime.UnixNano()),
+	}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("setting times on %s failed: %v", path, err)
+	}
+	return nil
+}
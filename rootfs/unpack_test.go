@@ -0,0 +1,110 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	hdr  tar.Header
+	data string
+}
+
+func makeTar(t *testing.T, entries []entry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.data))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUnpack(t *testing.T) {
+	dest, err := ioutil.TempDir("", "riddler-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	buf := makeTar(t, []entry{
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg}, data: "riddler\n"},
+		{hdr: tar.Header{Name: "etc/hostname.link", Typeflag: tar.TypeLink, Linkname: "etc/hostname"}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "/bin/busybox"}},
+		{hdr: tar.Header{Name: "run/fifo", Typeflag: tar.TypeFifo}},
+	})
+	if err := Unpack(buf, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dest, "etc/hostname.link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "riddler\n" {
+		t.Fatalf("expected hardlink contents to be riddler, got %q", string(data))
+	}
+
+	link, err := os.Readlink(filepath.Join(dest, "bin/sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "/bin/busybox" {
+		t.Fatalf("expected symlink to /bin/busybox, got %s", link)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dest, "run/fifo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("expected a fifo, got %s", fi.Mode())
+	}
+}
+
+func TestUnpackRefusesTraversal(t *testing.T) {
+	tests := [][]entry{
+		{
+			{hdr: tar.Header{Name: "../escape", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		{
+			{hdr: tar.Header{Name: "etc/../../escape", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		{
+			{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/"}},
+			{hdr: tar.Header{Name: "link/escape", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		{
+			{hdr: tar.Header{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+		},
+	}
+
+	for i, entries := range tests {
+		dest, err := ioutil.TempDir("", "riddler-rootfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dest)
+
+		if err := Unpack(makeTar(t, entries), dest); err == nil {
+			t.Fatalf("expected test %d to be refused", i)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+)
+
+func TestConvertSpecNonEmptyRootfs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riddler-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "rootfs", "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(mode string) { rootfsMode = mode }(rootfsMode)
+	rootfsMode = rootfsExport
+
+	ctr := container{ContainerJSON: types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "abc",
+			Name:       "/web",
+			Path:       "sh",
+			HostConfig: &containertypes.HostConfig{},
+		},
+		Config: &containertypes.Config{},
+	}}
+	if _, err := convertSpec(ctr, dir); err == nil {
+		t.Fatal("expected converting into a bundle with a non-empty rootfs to fail")
+	}
+	// the bundle is left alone
+	if _, err := os.Stat(filepath.Join(dir, specConfig)); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s to be written, got %v", specConfig, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	runArgsHelp = `Convert a docker run command line into a spec, without creating a container.`
+	// -h is taken by the help of riddler
+	runArgsHostname = `Pass the hostname of the container with --hostname, -h shows this help.`
+)
+
+func (cmd *runArgsCommand) Name() string      { return "run-args" }
+func (cmd *runArgsCommand) Args() string      { return "[OPTIONS] -- docker run [FLAGS] IMAGE [ARG...]" }
+func (cmd *runArgsCommand) ShortHelp() string { return runArgsHelp }
+func (cmd *runArgsCommand) LongHelp() string  { return runArgsHelp + "\n\n" + runArgsHostname }
+func (cmd *runArgsCommand) Hidden() bool      { return false }
+
+func (cmd *runArgsCommand) Register(fs *flag.FlagSet) {}
+
+type runArgsCommand struct{}
+
+func (cmd *runArgsCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("pass the docker run command line")
+	}
+	// the container does not exist, so it cannot be exported
+	if rootfsMode != "" && rootfsMode != rootfsImage {
+		return fmt.Errorf("only --rootfs %s is supported for docker run command lines", rootfsImage)
+	}
+
+	abs, err := filepath.Abs(bundle)
+	if err != nil {
+		return err
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctr, err := inspect.FromRunArgs(args, inspect.RunOptions{
+		VolumesDir: filepath.Join(abs, inspect.VolumesDir),
+		// fill in what the command line leaves out from the image, if the
+		// daemon has it
+		ImageConfig: imageConfigFunc(ctx, cli),
+		Log:         logrus.StandardLogger(),
+	})
+	if err != nil {
+		return fmt.Errorf("converting docker run command line failed: %v", err)
+	}
+
+	if err := convert(ctx, container{ContainerJSON: ctr}, bundle); err != nil {
+		return err
+	}
+
+	if err := createVolumeDirs(ctr, ""); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has been saved.\n", filepath.Join(bundle, specConfig))
+	return nil
+}
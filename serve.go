@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/ghodss/yaml"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	serveHelp = `Serve an HTTP API to convert inspect JSON, or containers of the daemon, into specs.`
+
+	serveEndpoints = `Endpoints:
+
+  GET  /_ping                    Check the server is up.
+  POST /v1/convert               Convert the inspect JSON in the body, pass
+                                 ?input=docker|podman|cri to skip detecting it.
+  GET  /v1/containers/{id}/spec  Convert a container of the daemon of --host.
+
+Both conversions take ?render=json|yaml, more than once, to also return the
+spec rendered in those formats.`
+
+	defaultServeListen = "unix:///run/riddler.sock"
+)
+
+func (cmd *serveCommand) Name() string      { return "serve" }
+func (cmd *serveCommand) Args() string      { return "[OPTIONS]" }
+func (cmd *serveCommand) ShortHelp() string { return serveHelp }
+func (cmd *serveCommand) LongHelp() string  { return serveHelp + "\n\n" + serveEndpoints }
+func (cmd *serveCommand) Hidden() bool      { return false }
+
+func (cmd *serveCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.listen, "listen", defaultServeListen, "Address to listen on (unix:///path or tcp://host:port)")
+	fs.Int64Var(&cmd.maxRequestSize, "max-request-size", 10<<20, "Largest request body accepted, in bytes")
+	fs.StringVar(&cmd.seccompDir, "seccomp-dir", "", "Directory to read the localhost seccomp profiles of CRI input from (they are refused if not set)")
+}
+
+type serveCommand struct {
+	listen         string
+	maxRequestSize int64
+	seccompDir     string
+}
+
+func (cmd *serveCommand) Run(ctx context.Context, args []string) error {
+	// the server only returns specs, there is no bundle to put a rootfs in
+	if rootfsMode != "" {
+		return errors.New("--rootfs is not supported for serve")
+	}
+	if cmd.maxRequestSize <= 0 {
+		return errors.New("--max-request-size has to be positive")
+	}
+
+	l, err := listen(cmd.listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	s := &server{
+		cli:            cli,
+		maxRequestSize: cmd.maxRequestSize,
+		// the input is posted by clients, do not let them read the files
+		// of the host
+		cri: inspect.CRIOptions{
+			SeccompDir:  cmd.seccompDir,
+			NoHostFiles: true,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", s.ping)
+	mux.HandleFunc("/v1/convert", s.convertHandler)
+	mux.HandleFunc("/v1/containers/", s.containerHandler)
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if strings.HasPrefix(cmd.listen, "tcp://") {
+		logrus.Warnf("Listening on %s without authentication, anyone who can reach it can read the specs, and the env, of the containers of the daemon", cmd.listen)
+	}
+	logrus.Infof("Listening on %s", cmd.listen)
+	return srv.Serve(l)
+}
+
+// listen opens the listener for an address of the form unix:///path or
+// tcp://host:port.
+func listen(addr string) (net.Listener, error) {
+	parts := strings.SplitN(addr, "://", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("%s is not a valid address, try unix:///path or tcp://host:port", addr)
+	}
+
+	switch parts[0] {
+	case "unix":
+		// remove the socket left behind by a previous server
+		if fi, err := os.Lstat(parts[1]); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+	case "tcp":
+	default:
+		return nil, fmt.Errorf("%s is not a supported protocol, try unix or tcp", parts[0])
+	}
+
+	l, err := net.Listen(parts[0], parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s failed: %v", addr, err)
+	}
+	return l, nil
+}
+
+// server serves the conversions of the HTTP API. Every request logs to a
+// logger of its own, so the conversions run concurrently and the warnings
+// of each one are returned with it.
+type server struct {
+	cli            *client.Client
+	maxRequestSize int64
+	cri            inspect.CRIOptions
+}
+
+// convertResponse is the response to a conversion.
+type convertResponse struct {
+	// Warnings are the warnings about the input, before it is converted.
+	Warnings   []string        `json:"warnings"`
+	Containers []convertResult `json:"containers"`
+}
+
+// convertResult is the result of converting one container.
+type convertResult struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Spec     *specs.Spec       `json:"spec,omitempty"`
+	Warnings []string          `json:"warnings"`
+	Rendered map[string]string `json:"rendered,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+func (s *server) ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, "OK")
+}
+
+func (s *server) convertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed, use POST", r.Method))
+		return
+	}
+
+	format := r.URL.Query().Get("input")
+	switch format {
+	case "", inputDocker, inputPodman, inputCRI:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not a valid input format, try %q, %q or %q", format, inputDocker, inputPodman, inputCRI))
+		return
+	}
+	render, err := renderFormats(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// read one byte more than allowed to know if the body is too large
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, s.maxRequestSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("reading request failed: %v", err))
+		return
+	}
+	if int64(len(data)) > s.maxRequestSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request is larger than %d bytes", s.maxRequestSize))
+		return
+	}
+
+	log, warnings := newWarningLog()
+	ctrs, err := decodeContainers(data, detectInput(data, format), s.cri, log)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	resp, err := s.convert(ctrs, log, warnings, render)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) containerHandler(w http.ResponseWriter, r *http.Request) {
+	// /v1/containers/{id}/spec
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/containers/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "spec" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed, use GET", r.Method))
+		return
+	}
+	render, err := renderFormats(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	log, warnings := newWarningLog()
+	ctr, err := inspectContainer(r.Context(), s.cli, parts[0], log)
+	if err != nil {
+		code := http.StatusBadGateway
+		if client.IsErrNotFound(err) {
+			code = http.StatusNotFound
+		}
+		writeError(w, code, fmt.Errorf("inspecting container (%s) failed: %v", parts[0], err))
+		return
+	}
+	if err := joinNamespaces(r.Context(), s.cli, &ctr, nil); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	resp, err := s.convert([]container{ctr}, log, warnings, render)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// convert generates the specs of the containers, along with the warnings
+// logged to log while doing so. The warnings logged before, while getting
+// the containers, are the ones about the input.
+func (s *server) convert(ctrs []container, log logrus.FieldLogger, warnings *warningHook, render []string) (*convertResponse, error) {
+	resp := &convertResponse{
+		Warnings:   warnings.take(),
+		Containers: []convertResult{},
+	}
+	for _, ctr := range ctrs {
+		result := convertResult{
+			ID:   ctr.ID,
+			Name: bundleName(ctr.ContainerJSON),
+		}
+		spec, err := generateSpec(ctr, log)
+		result.Warnings = warnings.take()
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Spec = spec
+		}
+		resp.Containers = append(resp.Containers, result)
+	}
+
+	for i, result := range resp.Containers {
+		if result.Spec == nil || len(render) == 0 {
+			continue
+		}
+		resp.Containers[i].Rendered = map[string]string{}
+		for _, format := range render {
+			data, err := renderSpec(result.Spec, format)
+			if err != nil {
+				return nil, fmt.Errorf("rendering spec of %s as %s failed: %v", result.Name, format, err)
+			}
+			resp.Containers[i].Rendered[format] = string(data)
+		}
+	}
+	return resp, nil
+}
+
+// renderFormats returns the formats to render the specs in.
+func renderFormats(r *http.Request) ([]string, error) {
+	formats := r.URL.Query()["render"]
+	for _, format := range formats {
+		if format != "json" && format != "yaml" {
+			return nil, fmt.Errorf("%s is not a valid render format, try %q or %q", format, "json", "yaml")
+		}
+	}
+	return formats, nil
+}
+
+// renderSpec renders the spec the way it would be saved in the format.
+func renderSpec(spec *specs.Spec, format string) ([]byte, error) {
+	if format == "yaml" {
+		return yaml.Marshal(spec)
+	}
+	return json.MarshalIndent(spec, "", "    ")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Debugf("Writing response failed: %v", err)
+	}
+}
+
+// writeError writes the error the way the docker API does.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"message": err.Error()})
+}
+
+// newWarningLog returns a logger that logs like the standard one, along with
+// the hook collecting the warnings logged to it.
+func newWarningLog() (*logrus.Logger, *warningHook) {
+	std := logrus.StandardLogger()
+	log := logrus.New()
+	log.Out = std.Out
+	log.Formatter = std.Formatter
+	log.Level = std.Level
+
+	hook := &warningHook{warnings: []string{}}
+	log.AddHook(hook)
+	return log, hook
+}
+
+// warningHook collects the warnings logged to a logger. The logger is used
+// for one request, which logs to it from one goroutine at a time.
+type warningHook struct {
+	warnings []string
+}
+
+func (h *warningHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.WarnLevel}
+}
+
+func (h *warningHook) Fire(entry *logrus.Entry) error {
+	h.warnings = append(h.warnings, entry.Message)
+	return nil
+}
+
+// take returns the warnings logged since the last call.
+func (h *warningHook) take() []string {
+	warnings := h.warnings
+	h.warnings = []string{}
+	return warnings
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConvertHandlerWarnings(t *testing.T) {
+	s := &server{maxRequestSize: 1 << 20}
+
+	// the requests run at the same time, each gets only its own warnings
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			field := fmt.Sprintf("Unknown%d", i)
+			body := fmt.Sprintf(`{"Id": "abc%d", "Name": "/web%d", "Path": "sh", "HostConfig": {}, "Config": {}, "%s": true}`, i, i, field)
+			r := httptest.NewRequest(http.MethodPost, "/v1/convert?input=docker", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			s.convertHandler(w, r)
+
+			var resp convertResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				errs <- err
+				return
+			}
+			expected := fmt.Sprintf("Ignoring field %s of /web%d, it is not understood", field, i)
+			if len(resp.Warnings) != 1 || resp.Warnings[0] != expected {
+				errs <- fmt.Errorf("expected the warning %q, got %q", expected, resp.Warnings)
+			}
+			if len(resp.Containers) != 1 || resp.Containers[0].Spec == nil {
+				errs <- fmt.Errorf("expected the spec of web%d, got %#v", i, resp.Containers)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/genuinetools/riddler/inspect"
+	"github.com/sirupsen/logrus"
+)
+
+const serviceHelp = `Convert the container spec of a swarm service into a spec, with its secrets and configs.`
+
+func (cmd *serviceCommand) Name() string      { return "service" }
+func (cmd *serviceCommand) Args() string      { return "[OPTIONS] SERVICE" }
+func (cmd *serviceCommand) ShortHelp() string { return serviceHelp }
+func (cmd *serviceCommand) LongHelp() string  { return serviceHelp }
+func (cmd *serviceCommand) Hidden() bool      { return false }
+
+func (cmd *serviceCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.dataDir, "data-dir", "", "Directory holding the data of the secrets and configs, in files named after them (the API does not return the data of secrets)")
+}
+
+type serviceCommand struct {
+	dataDir string
+}
+
+func (cmd *serviceCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 && fromFile == "" {
+		return errors.New("pass the service name or ID")
+	}
+	// the tasks do not exist here, so they cannot be exported
+	if rootfsMode != "" && rootfsMode != rootfsImage {
+		return fmt.Errorf("only --rootfs %s is supported for services", rootfsImage)
+	}
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// get the service spec from the saved inspect output or the daemon
+	var data []byte
+	if fromFile != "" {
+		data, err = inspect.ReadFile(fromFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, data, err = cli.ServiceInspectWithRaw(ctx, name, types.ServiceInspectOptions{})
+		if err != nil {
+			return fmt.Errorf("inspecting service (%s) failed: %v", name, err)
+		}
+	}
+	svc, err := inspect.DecodeService(data, name)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(bundle)
+	if err != nil {
+		return err
+	}
+
+	ctr, err := inspect.FromService(svc, inspect.ServiceOptions{
+		VolumesDir: filepath.Join(abs, inspect.VolumesDir),
+		SecretsDir: filepath.Join(abs, inspect.SecretsDir),
+		ConfigsDir: filepath.Join(abs, inspect.ConfigsDir),
+		SecretData: func(ref *swarm.SecretReference) ([]byte, error) {
+			if cmd.dataDir != "" {
+				return ioutil.ReadFile(filepath.Join(cmd.dataDir, ref.SecretName))
+			}
+			logrus.Warnf("The data of secret %s is not available, leaving it empty, pass it with --data-dir", ref.SecretName)
+			return nil, nil
+		},
+		ConfigData: func(ref *swarm.ConfigReference) ([]byte, error) {
+			if cmd.dataDir != "" {
+				return ioutil.ReadFile(filepath.Join(cmd.dataDir, ref.ConfigName))
+			}
+			if fromFile != "" {
+				return nil, errors.New("pass the data of the configs with --data-dir")
+			}
+			config, _, err := cli.ConfigInspectWithRaw(ctx, ref.ConfigID)
+			if err != nil {
+				return nil, err
+			}
+			return config.Spec.Data, nil
+		},
+		// fill in what the service leaves out from the image, if the daemon
+		// has it
+		ImageConfig: imageConfigFunc(ctx, cli),
+		Log:         logrus.StandardLogger(),
+	})
+	if err != nil {
+		return fmt.Errorf("converting service %s failed: %v", svc.Spec.Name, err)
+	}
+
+	if err := convert(ctx, container{ContainerJSON: ctr.ContainerJSON}, bundle); err != nil {
+		return err
+	}
+
+	if err := createVolumeDirs(ctr.ContainerJSON, ""); err != nil {
+		return err
+	}
+	if err := writeServiceFiles(ctr.Files); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has been saved.\n", filepath.Join(bundle, specConfig))
+	return nil
+}
+
+// writeServiceFiles writes the secrets and configs of a service into the
+// bundle, with the mode and owner the service gives them.
+func writeServiceFiles(files []inspect.ServiceFile) error {
+	for _, f := range files {
+		// only the runtime needs to get to the files
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+			return fmt.Errorf("creating directory for %s failed: %v", f.Path, err)
+		}
+		// the old file can be read-only
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := ioutil.WriteFile(f.Path, f.Data, f.Mode); err != nil {
+			return err
+		}
+		// the umask is applied on create
+		if err := os.Chmod(f.Path, f.Mode); err != nil {
+			return err
+		}
+		if err := os.Lchown(f.Path, f.UID, f.GID); err != nil {
+			logrus.Warnf("Changing the owner of %s to %d:%d failed: %v", f.Path, f.UID, f.GID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSSHArgs(t *testing.T) {
+	tests := []struct {
+		host    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			host: "ssh://example.com",
+			args: []string{"--", "example.com", "docker", "system", "dial-stdio"},
+		},
+		{
+			host: "ssh://me@example.com:2222",
+			args: []string{"-l", "me", "-p", "2222", "--", "example.com", "docker", "system", "dial-stdio"},
+		},
+		{
+			host: "ssh://me@example.com/",
+			args: []string{"-l", "me", "--", "example.com", "docker", "system", "dial-stdio"},
+		},
+		{host: "ssh://", wantErr: true},
+		{host: "ssh://example.com/var/run/docker.sock", wantErr: true},
+		{host: "ssh://exa mple.com", wantErr: true},
+	}
+
+	for _, test := range tests {
+		args, err := sshArgs(test.host)
+		if test.wantErr {
+			if err == nil {
+				t.Fatalf("expected an error for %s, got %v", test.host, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.host, err)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("%s: expected %v, got %v", test.host, test.args, args)
+		}
+	}
+}
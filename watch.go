@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	watchHelp = `Watch the events of the daemon and keep a bundle for every container in sync.`
+
+	// lastEventFile holds the time of the last event handled, in the
+	// seconds.nanoseconds form of the events API, so watching resumes
+	// from there.
+	lastEventFile = ".last-event"
+	// archiveDir holds the bundles of the removed containers, when they
+	// are archived.
+	archiveDir = ".archive"
+
+	// watchRetry is the time to wait before watching the events again when
+	// the connection to the daemon is lost.
+	watchRetry = 5 * time.Second
+)
+
+// watchActions are the events of containers that change their bundles.
+var watchActions = []string{"create", "update", "rename", "start", "destroy"}
+
+// watchFilters are the filters of the containers the events of the daemon
+// can be filtered by as well. The events API rejects the others, like status,
+// or matches them against the other types of events, like network.
+var watchFilters = map[string]bool{"label": true}
+
+func (cmd *watchCommand) Name() string      { return "watch" }
+func (cmd *watchCommand) Args() string      { return "[OPTIONS]" }
+func (cmd *watchCommand) ShortHelp() string { return watchHelp }
+func (cmd *watchCommand) LongHelp() string  { return watchHelp }
+func (cmd *watchCommand) Hidden() bool      { return false }
+
+func (cmd *watchCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.out, "out", "", "Directory to keep the bundles in, one directory per container")
+	fs.BoolVar(&cmd.archive, "archive", false, "Move the bundles of removed containers into "+archiveDir+" in the out directory instead of deleting them")
+}
+
+type watchCommand struct {
+	out     string
+	archive bool
+}
+
+func (cmd *watchCommand) Run(ctx context.Context, args []string) error {
+	if cmd.out == "" {
+		return errors.New("pass the directory to keep the bundles in with --out")
+	}
+	if fromFile != "" || fromDisk {
+		return errors.New("watch needs the events of the docker daemon")
+	}
+	// the rootfs would be copied again on every change
+	if rootfsMode != "" {
+		return errors.New("--rootfs is not supported for watch, the bundles only get their spec")
+	}
+	// the bundles are rewritten on every change
+	force = true
+
+	f, err := filterflags.ParseFilters()
+	if err != nil {
+		return err
+	}
+	if err := f.Validate(watchFilters); err != nil {
+		return fmt.Errorf("%v, the events of the daemon can only be filtered by label for watch", err)
+	}
+	// the events are filtered like the containers, they only need the
+	// events that change the bundles on top
+	ef, err := filterflags.ParseFilters()
+	if err != nil {
+		return err
+	}
+	ef.Add("type", events.ContainerEventType)
+	for _, action := range watchActions {
+		ef.Add("event", action)
+	}
+
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	w := &watcher{
+		cli:     cli,
+		out:     cmd.out,
+		archive: cmd.archive,
+		filters: f,
+		events:  ef,
+		index:   map[string]indexEntry{},
+	}
+	if err := w.readState(); err != nil {
+		return err
+	}
+
+	// the daemon could not be reached at all
+	if err := w.start(ctx); err != nil {
+		return err
+	}
+	for {
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logrus.Warnf("Watching the events failed, retrying in %s: %v", watchRetry, err)
+		time.Sleep(watchRetry)
+
+		if err := w.start(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logrus.Warnf("Syncing the containers failed, retrying in %s: %v", watchRetry, err)
+			time.Sleep(watchRetry)
+		}
+	}
+}
+
+// watcher keeps the bundles in the out directory in sync with the
+// containers of the daemon.
+type watcher struct {
+	cli     *client.Client
+	out     string
+	archive bool
+	filters filters.Args
+	events  filters.Args
+
+	// index holds the bundles by the id of their container.
+	index map[string]indexEntry
+	since string
+}
+
+// readState reads the bundles and the last event handled by a previous
+// watch.
+func (w *watcher) readState() error {
+	data, err := ioutil.ReadFile(filepath.Join(w.out, indexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var index []indexEntry
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("decoding %s failed: %v", filepath.Join(w.out, indexFile), err)
+		}
+		for _, entry := range index {
+			w.index[entry.ID] = entry
+		}
+	}
+
+	since, err := ioutil.ReadFile(filepath.Join(w.out, lastEventFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.since = strings.TrimSpace(string(since))
+	return nil
+}
+
+// saveSince records the time of the last event handled, in nanoseconds.
+func (w *watcher) saveSince(t int64) error {
+	w.since = fmt.Sprintf("%d.%09d", t/int64(time.Second), t%int64(time.Second))
+
+	// write it in one go, so a crash does not leave half of it
+	file := filepath.Join(w.out, lastEventFile)
+	if err := ioutil.WriteFile(file+".tmp", []byte(w.since+"\n"), 0666); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// start syncs the bundles with the containers there are now, before the
+// events are replayed. The events since the last one handled might have been
+// dropped by the daemon, or never sent while it was down.
+func (w *watcher) start(ctx context.Context) error {
+	start := time.Now()
+	if err := w.sync(ctx); err != nil {
+		return err
+	}
+	// without a last event there is nothing to replay, the sync covers
+	// everything until it started
+	if w.since == "" {
+		return w.saveSince(start.UnixNano())
+	}
+	return nil
+}
+
+// sync converts all the containers, and removes the bundles of the ones that
+// are gone.
+func (w *watcher) sync(ctx context.Context) error {
+	list, err := w.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: w.filters,
+	})
+	if err != nil {
+		return fmt.Errorf("listing containers failed: %v", err)
+	}
+
+	ids := map[string]bool{}
+	for _, c := range list {
+		ids[c.ID] = true
+		if err := w.update(ctx, c.ID); err != nil {
+			return err
+		}
+	}
+	for id := range w.index {
+		if !ids[id] {
+			if err := w.remove(id); err != nil {
+				return err
+			}
+		}
+	}
+	return w.writeIndex()
+}
+
+// watch handles the events of the containers until the connection to the
+// daemon is lost.
+func (w *watcher) watch(ctx context.Context) error {
+	msgs, errs := w.cli.Events(ctx, types.EventsOptions{
+		Since:   w.since,
+		Filters: w.events,
+	})
+	for {
+		select {
+		case msg := <-msgs:
+			if err := w.handle(ctx, msg); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// handle changes the bundle of the container of the event.
+func (w *watcher) handle(ctx context.Context, msg events.Message) error {
+	logrus.Debugf("Handling %s event of container (%s)", msg.Action, msg.Actor.ID)
+
+	var err error
+	if msg.Action == "destroy" {
+		err = w.remove(msg.Actor.ID)
+	} else {
+		err = w.update(ctx, msg.Actor.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.writeIndex(); err != nil {
+		return err
+	}
+	return w.saveSince(msg.TimeNano)
+}
+
+// update converts the container into its bundle. A container that fails to
+// convert is recorded in the index, it does not stop the watch.
+func (w *watcher) update(ctx context.Context, id string) error {
+	ctr, err := inspectContainer(ctx, w.cli, id, logrus.StandardLogger())
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			// it is gone already, its destroy event removes it
+			return nil
+		}
+		return fmt.Errorf("inspecting container (%s) failed: %v", id, err)
+	}
+
+	entry := indexEntry{
+		ID:     ctr.ID,
+		Name:   bundleName(ctr.ContainerJSON),
+		Bundle: filepath.Join(w.out, bundleName(ctr.ContainerJSON)),
+	}
+
+	// the container was renamed
+	if old, ok := w.index[ctr.ID]; ok && old.Bundle != entry.Bundle {
+		if err := os.RemoveAll(old.Bundle); err != nil {
+			return fmt.Errorf("removing bundle %s failed: %v", old.Bundle, err)
+		}
+	}
+
+	// the containers it shares namespaces with are joined where they run
+	err = joinNamespaces(ctx, w.cli, &ctr, nil)
+	if err == nil {
+		_, err = convertSpec(ctr, entry.Bundle)
+	}
+	if err != nil {
+		logrus.Warnf("converting container (%s) failed: %v", entry.Name, err)
+		entry.Error = err.Error()
+	} else {
+		fmt.Printf("%s has been saved.\n", filepath.Join(entry.Bundle, specConfig))
+	}
+
+	w.index[ctr.ID] = entry
+	return nil
+}
+
+// remove deletes or archives the bundle of the container.
+func (w *watcher) remove(id string) error {
+	entry, ok := w.index[id]
+	if !ok {
+		return nil
+	}
+	delete(w.index, id)
+
+	if !w.archive {
+		if err := os.RemoveAll(entry.Bundle); err != nil {
+			return fmt.Errorf("removing bundle %s failed: %v", entry.Bundle, err)
+		}
+		fmt.Printf("%s has been removed.\n", entry.Bundle)
+		return nil
+	}
+
+	dir := filepath.Join(w.out, archiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating archive directory %s failed: %v", dir, err)
+	}
+	// the name can be used again by another container
+	dest := filepath.Join(dir, entry.Name+"-"+shortID(id))
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.Rename(entry.Bundle, dest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("archiving bundle %s failed: %v", entry.Bundle, err)
+	}
+	fmt.Printf("%s has been archived to %s.\n", entry.Bundle, dest)
+	return nil
+}
+
+// writeIndex writes the index of the bundles, sorted by name.
+func (w *watcher) writeIndex() error {
+	index := []indexEntry{}
+	for _, entry := range w.index {
+		index = append(index, entry)
+	}
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].Name < index[j].Name
+	})
+	return writeIndex(w.out, index)
+}
+
+// shortID returns the short form of the id of a container.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}